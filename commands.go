@@ -0,0 +1,694 @@
+package main
+
+import (
+	"PoolHelper/src/arbitrage"
+	"PoolHelper/src/cache"
+	"PoolHelper/src/cache/uniswap"
+	"PoolHelper/src/config"
+	"PoolHelper/src/multicall/generic"
+	unipool "PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/provider"
+	"PoolHelper/src/router"
+	"PoolHelper/src/server"
+	"PoolHelper/src/structs/subscription"
+	"PoolHelper/src/structs/token"
+	"PoolHelper/src/tokenlist"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidUsage   = errors.New("invalid usage")
+	UnknownToken   = errors.New("unknown token")
+	AmbiguousToken = errors.New("ambiguous token symbol")
+	NotCached      = errors.New("address is neither a cached pool nor a cached token")
+	UnknownChain   = errors.New("chain is not configured")
+)
+
+///
+/// Node
+///
+
+// node is the RPC connection and the caches of one chain
+type node struct {
+	cfg config.Config
+	// prefix prefixes the progress with the chain name when several chains run side by side
+	prefix bool
+
+	client *provider.Dispatcher
+	m      *generic.MulticallContract
+	cV2    *uniswap.V2Cache
+	cV3    *uniswap.V3Cache
+}
+
+// discovery is the pool discovery of a factory
+type discovery struct {
+	Cache   string         `json:"cache"`
+	Factory string         `json:"factory"`
+	Address common.Address `json:"address"`
+	cache.DiscoveryReport
+}
+
+// connect dials the endpoints of a chain and creates empty caches
+// endpoints that cannot be dialed are skipped, the requests are balanced over the others
+func connect(c config.Config) (*node, error) {
+	endpoints := make([]provider.Endpoint, 0, len(c.Endpoints))
+	var dialErr error
+	for i, e := range c.Endpoints {
+		rpcClient, err := rpc.Dial(e.URL)
+		if err != nil {
+			// the url is not logged, it usually contains an api key
+			logf("(%s) Skipping endpoint %d: %s", c.Name(), i, err)
+			dialErr = err
+			continue
+		}
+		endpoints = append(endpoints, provider.Endpoint{
+			URL:        e.URL,
+			Client:     ethclient.NewClient(rpcClient),
+			Subscriber: rpcClient,
+			Weight:     e.Weight,
+			RateLimit:  e.RateLimit,
+		})
+	}
+	if len(endpoints) == 0 {
+		return nil, dialErr
+	}
+
+	client := provider.NewDispatcher(endpoints)
+	client.SetStrategy(provider.Strategy(c.RPC.Strategy))
+	client.SetHedge(time.Duration(c.RPC.Hedge))
+	client.SetHealth(c.RPC.MaxFailures, time.Duration(c.RPC.Cooldown))
+
+	n := &node{
+		cfg:    c,
+		client: client,
+		m:      newCaller(client, c.Multicall),
+		cV2:    uniswap.NewV2Cache(),
+		cV3:    uniswap.NewV3Cache(),
+	}
+	n.cV2.SetHistoryDepth(c.Sync.HistoryDepth)
+	n.cV3.SetHistoryDepth(c.Sync.HistoryDepth)
+	n.cV2.SetPoolHistorySize(c.Sync.PoolHistory)
+	n.cV3.SetPoolHistorySize(c.Sync.PoolHistory)
+	return n, nil
+}
+
+// logf prints the progress of the chain
+func (n *node) logf(format string, args ...any) {
+	if n.prefix {
+		format = "[" + n.cfg.Name() + "] " + format
+	}
+	logf(format, args...)
+}
+
+// header returns the header of a block, 0 is the latest block
+func (n *node) header(ctx context.Context, block uint64) (*types.Header, error) {
+	if block == 0 {
+		return n.client.HeaderByNumber(ctx, nil)
+	}
+	return n.client.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+}
+
+// tokens returns the configured tokens followed by the tokens of the configured token lists
+// a token configured or listed several times is only returned once, with the metadata of its first listing
+func (n *node) tokens() ([]token.ERC20, error) {
+	tokens := make([]token.ERC20, 0, len(n.cfg.Tokens))
+	seen := make(map[common.Address]bool)
+	for _, address := range n.cfg.TokenAddresses() {
+		if !seen[address] {
+			seen[address] = true
+			tokens = append(tokens, token.ERC20{Address: address})
+		}
+	}
+
+	for _, l := range n.cfg.TokenLists {
+		lists, err := tokenlist.Load(l.Path)
+		if err != nil {
+			return nil, err
+		}
+		listed, report := tokenlist.Select(lists, tokenlist.Filter{ChainID: n.cfg.ChainID, Tags: l.Tags})
+		for _, t := range listed {
+			if !seen[t.Address] {
+				seen[t.Address] = true
+				tokens = append(tokens, t)
+			}
+		}
+		n.logf("Selected %d/%d listed tokens from %s (duplicates %d, invalid %d)", report.Selected, report.Listed, l.Path, report.Duplicates, report.Invalid)
+	}
+	return tokens, nil
+}
+
+// discover imports the configured tokens and discovers the pools of the configured factories
+func (n *node) discover(ctx context.Context, block uint64) ([]discovery, error) {
+	tokenList, err := n.tokens()
+	if err != nil {
+		return nil, err
+	}
+
+	importStart := time.Now()
+	imported, err := n.cV2.ImportTokenList(ctx, n.m, tokenList)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := n.cV3.ImportTokenList(ctx, n.m, tokenList); err != nil {
+		return nil, err
+	}
+	n.logf("Imported %d/%d tokens in %s", imported.Imported, len(tokenList), time.Since(importStart))
+	for _, skipped := range imported.Skipped {
+		n.logf("Skipped token %s: %s", skipped.Address.Hex(), skipped.Reason)
+	}
+	for _, mismatch := range imported.Mismatched {
+		n.logf("Token %s: listed %s %q does not match on-chain %q", mismatch.Address.Hex(), mismatch.Field, mismatch.Listed, mismatch.OnChain)
+	}
+
+	discoveries := make([]discovery, 0)
+	for _, f := range n.cfg.V2Factories() {
+		initStart := time.Now()
+		report, err := n.cV2.DiscoverPools(ctx, n.m, f, block)
+		if err != nil {
+			return nil, err
+		}
+		n.logf("(V2) Discovered %d/%d pools for %s in %s (skipped %d, mismatched %d, failed %d)", report.Deployed, report.Candidates, f.Name, time.Since(initStart), report.Skipped, report.Mismatched, report.Failed)
+		discoveries = append(discoveries, discovery{"v2", f.Name, f.Address, report})
+	}
+	for _, f := range n.cfg.V3Factories() {
+		initStart := time.Now()
+		report, err := n.cV3.DiscoverPools(ctx, n.m, f, block)
+		if err != nil {
+			return nil, err
+		}
+		n.logf("(V3) Discovered %d/%d pools for %s in %s (skipped %d, mismatched %d, failed %d)", report.Deployed, report.Candidates, f.Name, time.Since(initStart), report.Skipped, report.Mismatched, report.Failed)
+		discoveries = append(discoveries, discovery{"v3", f.Name, f.Address, report})
+	}
+	return discoveries, nil
+}
+
+// load fills the caches and syncs them to the given block
+// the caches are restored from their snapshots if useSnapshot is set and the snapshots are usable, otherwise the pools are discovered
+func (n *node) load(ctx context.Context, block cache.Block, useSnapshot bool) error {
+	restored := false
+	if useSnapshot {
+		var err error
+		if restored, err = restoreSnapshots(n.cfg, n.client, n.cV2, n.cV3, block.Number); err != nil {
+			return err
+		}
+	}
+
+	if restored {
+		tokens, _ := n.cV2.Tokens()
+		n.logf("Restored %d tokens and %d pools at block %d", len(tokens), len(n.cV2.Pools())+len(n.cV3.Pools()), n.cV2.LastSynced())
+	} else if _, err := n.discover(ctx, block.Number); err != nil {
+		return err
+	}
+	n.logf("Total pools: %d (V2 %d, V3 %d)", len(n.cV2.Pools())+len(n.cV3.Pools()), len(n.cV2.Pools()), len(n.cV3.Pools()))
+
+	return n.sync(ctx, block, restored && n.cfg.Sync.FromLogs)
+}
+
+// sync brings the caches to the given block
+// fromLogs applies the logs since the last synced block instead of syncing every pool
+func (n *node) sync(ctx context.Context, block cache.Block, fromLogs bool) error {
+	syncStart := time.Now()
+	if fromLogs {
+		from := min(n.cV2.LastSynced(), n.cV3.LastSynced()) + 1
+		if err := catchUp(ctx, n.cfg, n.client, n.cV2, n.cV3, block); err != nil {
+			return err
+		}
+		n.logf("Applied logs of blocks %d-%d in %s", from, block.Number, time.Since(syncStart))
+
+		// the synced tick words follow the price
+		recentred, err := n.cV3.RecenterTicks(ctx, n.m)
+		if err != nil {
+			return err
+		}
+		if recentred > 0 {
+			n.logf("(V3) Re-synced the ticks of %d pools", recentred)
+		}
+		return nil
+	}
+
+	if n.cV2.LastSynced() < block.Number {
+		if err := n.cV2.SyncAll(ctx, n.m, block); err != nil {
+			return err
+		}
+		n.logf("(V2) Synced %d pools in %s", len(n.cV2.Pools()), time.Since(syncStart))
+	}
+	syncStart = time.Now()
+	if n.cV3.LastSynced() < block.Number {
+		if err := n.cV3.SyncAll(ctx, n.m, block); err != nil {
+			return err
+		}
+		n.logf("(V3) Synced %d pools in %s", len(n.cV3.Pools()), time.Since(syncStart))
+	}
+	return nil
+}
+
+// connectChain connects to a configured chain
+func connectChain(id uint64) (*node, error) {
+	c, ok := cfg.Chain(id)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s: %d", UnknownChain, id))
+	}
+	return connect(c)
+}
+
+// server creates a server and router over both caches
+func (n *node) server() (*server.Server, *router.Router) {
+	r := router.NewRouter()
+	router.AddPools(r, n.cV2.Pools())
+	router.AddPools(r, n.cV3.Pools())
+
+	srv := server.NewServer(r)
+	server.AddCache[unipool.Reserves, any](srv, "v2", n.cV2)
+	server.AddCache[unipool.V3State, unipool.V3FeeType](srv, "v3", n.cV3)
+	return srv, r
+}
+
+///
+/// Commands
+///
+
+// parseFlags parses the flags of a command, flag errors are already printed by the flag set
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return InvalidUsage
+	}
+	return nil
+}
+
+// runImport imports the configured tokens, discovers the pools of the configured factories and prints the discovery reports
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	chainID := fs.Uint64("chain", cfg.ChainID, "id of the configured chain")
+	block := fs.Uint64("block", 0, "block to discover the pools at, 0 is the latest block")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	n, err := connectChain(*chainID)
+	if err != nil {
+		return err
+	}
+	header, err := n.header(ctx, *block)
+	if err != nil {
+		return err
+	}
+	discoveries, err := n.discover(ctx, header.Number.Uint64())
+	if err != nil {
+		return err
+	}
+	tokens, err := n.cV2.Tokens()
+	if err != nil {
+		return err
+	}
+
+	return printJSON(struct {
+		Block       uint64         `json:"block"`
+		BlockHash   common.Hash    `json:"blockHash"`
+		Tokens      []server.Token `json:"tokens"`
+		Discoveries []discovery    `json:"discoveries"`
+	}{header.Number.Uint64(), header.Hash(), tokens, discoveries})
+}
+
+// runSync syncs every pool at a block and prints the tokens and pools
+func runSync(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	chainID := fs.Uint64("chain", cfg.ChainID, "id of the configured chain")
+	block := fs.Uint64("block", 0, "block to sync, 0 is the latest block")
+	useSnapshot := fs.Bool("snapshot", true, "start from the snapshots if they are not newer than the block")
+	save := fs.Bool("save", false, "save the synced caches as snapshots")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	n, err := connectChain(*chainID)
+	if err != nil {
+		return err
+	}
+	header, err := n.header(ctx, *block)
+	if err != nil {
+		return err
+	}
+	if err := n.load(ctx, cache.HeaderBlock(header), *useSnapshot); err != nil {
+		return err
+	}
+	if *save {
+		if err := saveSnapshots(n.cfg, n.cV2, n.cV3); err != nil {
+			return err
+		}
+	}
+
+	srv, _ := n.server()
+	tokens, err := srv.Tokens()
+	if err != nil {
+		return err
+	}
+
+	return printJSON(struct {
+		Block     uint64         `json:"block"`
+		BlockHash common.Hash    `json:"blockHash"`
+		Tokens    []server.Token `json:"tokens"`
+		Pools     []server.Pool  `json:"pools"`
+	}{header.Number.Uint64(), header.Hash(), tokens, srv.Pools()})
+}
+
+// runQuote syncs every pool and prints the best routes between two tokens
+func runQuote(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("quote", flag.ContinueOnError)
+	chainID := fs.Uint64("chain", cfg.ChainID, "id of the configured chain")
+	tokenIn := fs.String("in", "", "input token address or symbol")
+	tokenOut := fs.String("out", "", "output token address or symbol")
+	amount := fs.String("amount", "", "input amount in the smallest unit of the input token")
+	maxHops := fs.Int("hops", server.DefaultMaxHops, "maximum number of hops of a route")
+	limit := fs.Int("limit", server.DefaultLimit, "number of routes to print")
+	block := fs.Uint64("block", 0, "block to quote at, 0 is the latest block")
+	useSnapshot := fs.Bool("snapshot", true, "start from the snapshots if they are not newer than the block")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	amountIn, ok := new(big.Int).SetString(*amount, 10)
+	if !ok || amountIn.Sign() <= 0 {
+		return server.InvalidAmount
+	}
+	if *maxHops <= 0 || *limit <= 0 {
+		return server.InvalidParam
+	}
+
+	n, err := connectChain(*chainID)
+	if err != nil {
+		return err
+	}
+	header, err := n.header(ctx, *block)
+	if err != nil {
+		return err
+	}
+	if err := n.load(ctx, cache.HeaderBlock(header), *useSnapshot); err != nil {
+		return err
+	}
+
+	srv, _ := n.server()
+	tokens, err := srv.Tokens()
+	if err != nil {
+		return err
+	}
+	in, err := resolveToken(tokens, *tokenIn)
+	if err != nil {
+		return err
+	}
+	out, err := resolveToken(tokens, *tokenOut)
+	if err != nil {
+		return err
+	}
+
+	quotes, err := srv.Quote(in, out, amountIn, *maxHops, min(*limit, server.MaxLimit))
+	if err != nil {
+		return err
+	}
+	return printJSON(quotes)
+}
+
+// runInspect syncs every pool and prints a cached pool, or a cached token with its pools
+func runInspect(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	chainID := fs.Uint64("chain", cfg.ChainID, "id of the configured chain")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: poolhelper inspect [flags] <address>")
+		fs.PrintDefaults()
+	}
+	block := fs.Uint64("block", 0, "block to inspect at, 0 is the latest block")
+	useSnapshot := fs.Bool("snapshot", true, "start from the snapshots if they are not newer than the block")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || !common.IsHexAddress(fs.Arg(0)) {
+		fs.Usage()
+		return InvalidUsage
+	}
+	address := common.HexToAddress(fs.Arg(0))
+
+	n, err := connectChain(*chainID)
+	if err != nil {
+		return err
+	}
+	header, err := n.header(ctx, *block)
+	if err != nil {
+		return err
+	}
+	if err := n.load(ctx, cache.HeaderBlock(header), *useSnapshot); err != nil {
+		return err
+	}
+
+	srv, _ := n.server()
+	tokens, err := srv.Tokens()
+	if err != nil {
+		return err
+	}
+	i, err := inspect(srv.Pools(), tokens, address)
+	if err != nil {
+		return err
+	}
+	return printJSON(i)
+}
+
+// runWatch watches every configured chain, or a single one, side by side until one of them fails
+func runWatch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	chainID := fs.Uint64("chain", 0, "id of the configured chain to watch, 0 watches every chain")
+	sinkName := fs.String("sink", "text", "output of every block: text, json or none")
+	out := fs.String("out", "", "append the output to a file instead of stdout")
+	serve := fs.Bool("serve", true, "serve the caches of each chain on its server.addr")
+	useSnapshot := fs.Bool("snapshot", true, "start from the snapshots and save them periodically")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	s, err := newSink(*sinkName, w)
+	if err != nil {
+		return err
+	}
+
+	chains := cfg.All()
+	if *chainID != 0 {
+		c, ok := cfg.Chain(*chainID)
+		if !ok {
+			return errors.New(fmt.Sprintf("%s: %d", UnknownChain, *chainID))
+		}
+		chains = []config.Config{c}
+	}
+
+	// the first failing chain stops the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(chains))
+	for _, c := range chains {
+		go func(c config.Config) {
+			n, err := connect(c)
+			if err == nil {
+				n.prefix = len(chains) > 1
+				err = n.watch(ctx, s, *serve, *useSnapshot)
+			}
+			if err != nil && !errors.Is(err, context.Canceled) {
+				err = errors.New(fmt.Sprintf("%s: %s", c.Name(), err))
+			}
+			errs <- err
+		}(c)
+	}
+
+	err = <-errs
+	cancel()
+	for range chains[1:] {
+		<-errs
+	}
+	return err
+}
+
+// watch syncs every new block of the chain, reports the changed pools and arbitrage opportunities to a sink and serves the caches
+func (n *node) watch(ctx context.Context, s sink, serve bool, useSnapshot bool) error {
+	header, err := n.header(ctx, 0)
+	if err != nil {
+		return err
+	}
+	if err := n.load(ctx, cache.HeaderBlock(header), useSnapshot); err != nil {
+		return err
+	}
+
+	// save the synced caches for the next restart
+	if useSnapshot {
+		if err := saveSnapshots(n.cfg, n.cV2, n.cV3); err != nil {
+			return err
+		}
+	}
+
+	// create the arbitrage scanner over both caches
+	srv, r := n.server()
+	scanner, err := arbitrage.NewScanner(r, n.cfg.Arbitrage.Hops, n.cfg.Arbitrage.Probe.Int(), n.cfg.Arbitrage.MaxIn.Int())
+	if err != nil {
+		return err
+	}
+	report := func(update server.BlockUpdate) error {
+		scanStart := time.Now()
+		opportunities := scanner.Scan(common.HexToAddress(n.cfg.Arbitrage.Base))
+		n.logf("Found %d arbitrage opportunities in %s", len(opportunities), time.Since(scanStart))
+		return s.Block(n.cfg.ChainID, update, opportunities[:min(n.cfg.Arbitrage.Top, len(opportunities))])
+	}
+	if err := report(srv.Publish(header.Number.Uint64(), header.Hash())); err != nil {
+		return err
+	}
+
+	// serve the caches over HTTP
+	if serve && n.cfg.Server.Addr != "" {
+		go func() {
+			if err := http.ListenAndServe(n.cfg.Server.Addr, srv); err != nil {
+				n.logf("server error: %s", err)
+			}
+		}()
+		n.logf("Serving caches on %s", n.cfg.Server.Addr)
+	}
+
+	// create subscription
+	sub := subscription.NewBlockSubscription(n.client, time.Duration(n.cfg.Subscription.Timeout), time.Duration(n.cfg.Subscription.MaxTimeout), n.cfg.Subscription.MaxRetries)
+	if err = sub.Subscribe(ctx); err != nil {
+		return err
+	}
+
+	// listen for new blocks
+	lastHash := header.Hash()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _err := <-sub.Err():
+			n.logf("subscription error: %s", _err)
+		case header := <-sub.Items():
+			// check if the block has changed, a sibling block at the same height is a reorg
+			if header.Item.Hash() == lastHash {
+				continue
+			}
+
+			// update the last block
+			block := cache.HeaderBlock(header.Item)
+			lastHash = block.Hash
+			n.logf("Block: %d", block.Number)
+
+			// roll back the caches to the common ancestor if the block is on another branch
+			reorg, err := cache.HandleReorg(header.Context, n.client, block, n.cV2, n.cV3)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					n.logf("block passed")
+					continue
+				}
+				return err
+			}
+			if reorg != nil {
+				n.logf("Reorg: dropped %d blocks after block %d", len(reorg.Dropped), reorg.Ancestor.Number)
+				srv.PublishReorg(*reorg)
+				if err := s.Reorg(n.cfg.ChainID, *reorg); err != nil {
+					return err
+				}
+			}
+
+			// sync the caches to the block
+			if err := n.sync(header.Context, block, n.cfg.Sync.FromLogs); err != nil {
+				if errors.Is(err, context.Canceled) {
+					n.logf("block passed")
+					continue
+				}
+				return err
+			}
+
+			// publish the changed pools to the feed
+			update := srv.Publish(block.Number, block.Hash)
+
+			// save the synced caches periodically
+			if useSnapshot && block.Number%n.cfg.Sync.SnapshotInterval == 0 {
+				if err := saveSnapshots(n.cfg, n.cV2, n.cV3); err != nil {
+					n.logf("snapshot error: %s", err)
+				}
+			}
+			if err := report(update); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+///
+/// Utils
+///
+
+// resolveToken resolves a token address or a case insensitive symbol of a cached token
+func resolveToken(tokens []server.Token, s string) (common.Address, error) {
+	if common.IsHexAddress(s) {
+		return common.HexToAddress(s), nil
+	}
+
+	found := make([]server.Token, 0)
+	for _, t := range tokens {
+		if strings.EqualFold(t.Symbol, s) {
+			found = append(found, t)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return common.Address{}, errors.New(fmt.Sprintf("%s: %q", UnknownToken, s))
+	case 1:
+		return found[0].Address, nil
+	default:
+		return common.Address{}, errors.New(fmt.Sprintf("%s: %q matches %d tokens", AmbiguousToken, s, len(found)))
+	}
+}
+
+// inspection is the output of the inspect command
+type inspection struct {
+	Pool  *server.Pool  `json:"pool,omitempty"`
+	Token *server.Token `json:"token,omitempty"`
+	Pools []server.Pool `json:"pools,omitempty"`
+}
+
+// inspect finds the pool or the token with its pools of an address
+func inspect(pools []server.Pool, tokens []server.Token, address common.Address) (inspection, error) {
+	for _, p := range pools {
+		if p.Address == address {
+			return inspection{Pool: &p}, nil
+		}
+	}
+
+	for _, t := range tokens {
+		if t.Address != address {
+			continue
+		}
+
+		i := inspection{Token: &t, Pools: make([]server.Pool, 0)}
+		for _, p := range pools {
+			if p.Token0.Address == address || p.Token1.Address == address {
+				i.Pools = append(i.Pools, p)
+			}
+		}
+		return i, nil
+	}
+
+	return inspection{}, NotCached
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/server"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+var (
+	usdc = server.Token{Address: common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"), Symbol: "USDC", Decimals: big.NewInt(6)}
+	weth = server.Token{Address: common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"), Symbol: "WETH", Decimals: big.NewInt(18)}
+	fake = server.Token{Address: common.HexToAddress("0x0000000000000000000000000000000000000001"), Symbol: "usdc", Decimals: big.NewInt(6)}
+)
+
+func TestResolveToken(t *testing.T) {
+	tokens := []server.Token{usdc, weth}
+
+	if a, err := resolveToken(tokens, "weth"); err != nil || a != weth.Address {
+		t.Errorf("wrong token for symbol: %s %v", a, err)
+	}
+	if a, err := resolveToken(tokens, "0xdac17f958d2ee523a2206206994597c13d831ec7"); err != nil || a != common.HexToAddress("0xdac17f958d2ee523a2206206994597c13d831ec7") {
+		t.Errorf("wrong token for address: %s %v", a, err)
+	}
+	if _, err := resolveToken(tokens, "DAI"); err == nil || !strings.Contains(err.Error(), UnknownToken.Error()) {
+		t.Errorf("expected unknown token, got %v", err)
+	}
+	if _, err := resolveToken(append(tokens, fake), "USDC"); err == nil || !strings.Contains(err.Error(), AmbiguousToken.Error()) {
+		t.Errorf("expected ambiguous token, got %v", err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	pools := []server.Pool{
+		{Address: common.HexToAddress("0x01"), Token0: usdc, Token1: weth},
+		{Address: common.HexToAddress("0x02"), Token0: fake, Token1: weth},
+	}
+	tokens := []server.Token{fake, usdc, weth}
+
+	if i, err := inspect(pools, tokens, pools[1].Address); err != nil || i.Pool == nil || i.Pool.Address != pools[1].Address || i.Token != nil {
+		t.Errorf("wrong pool inspection: %+v %v", i, err)
+	}
+	if i, err := inspect(pools, tokens, weth.Address); err != nil || i.Token == nil || i.Token.Symbol != "WETH" || len(i.Pools) != 2 {
+		t.Errorf("wrong token inspection: %+v %v", i, err)
+	}
+	if i, err := inspect(pools, tokens, usdc.Address); err != nil || len(i.Pools) != 1 || i.Pools[0].Address != pools[0].Address {
+		t.Errorf("wrong token pools: %+v %v", i, err)
+	}
+	if _, err := inspect(pools, tokens, common.HexToAddress("0x03")); !errors.Is(err, NotCached) {
+		t.Errorf("expected not cached, got %v", err)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	update := server.BlockUpdate{
+		Block:     100,
+		BlockHash: common.HexToHash("0x64"),
+		Pools:     []server.PoolUpdate{{Address: common.HexToAddress("0x01"), New: json.RawMessage(`{"reserve0":1,"reserve1":2}`)}},
+	}
+
+	// json writes one line per block
+	buf := new(bytes.Buffer)
+	s, err := newSink("json", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Block(8453, update, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Block(8453, update, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	r := blockReport{}
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || r.ChainID != 8453 || r.Block != 100 || len(r.Pools) != 1 || r.Opportunities == nil {
+		t.Errorf("wrong json output: %s", buf)
+	}
+
+	// text prints a summary
+	buf.Reset()
+	if s, err = newSink("text", buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Block(8453, update, nil); err != nil || !strings.HasPrefix(buf.String(), "[base] Block 100 ") || !strings.Contains(buf.String(), "1 pools changed") {
+		t.Errorf("wrong text output: %q %v", buf, err)
+	}
+
+	// reorgs are reported by every sink
+	reorg := cache.Reorg{
+		Ancestor: cache.Block{Number: 99, Hash: common.HexToHash("0x63")},
+		Dropped:  []cache.Block{{Number: 100, Hash: common.HexToHash("0x64")}},
+		Head:     cache.Block{Number: 100, Hash: common.HexToHash("0x65")},
+	}
+	buf.Reset()
+	if err := s.Reorg(8453, reorg); err != nil || !strings.HasPrefix(buf.String(), "[base] Reorg at block 100 ") || !strings.Contains(buf.String(), "dropped 1 blocks after block 99") {
+		t.Errorf("wrong text reorg: %q %v", buf, err)
+	}
+	buf.Reset()
+	if s, err = newSink("json", buf); err != nil {
+		t.Fatal(err)
+	}
+	rr := reorgReport{}
+	if err := s.Reorg(8453, reorg); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rr); err != nil || rr.ChainID != 8453 || rr.Reorg.Ancestor.Number != 99 {
+		t.Errorf("wrong json reorg: %s %v", buf, err)
+	}
+
+	if _, err := newSink("stdout", buf); err == nil || !strings.Contains(err.Error(), UnknownSink.Error()) {
+		t.Errorf("expected unknown sink, got %v", err)
+	}
+}
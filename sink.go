@@ -0,0 +1,134 @@
+package main
+
+import (
+	"PoolHelper/src/arbitrage"
+	"PoolHelper/src/cache"
+	"PoolHelper/src/chain"
+	"PoolHelper/src/server"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	UnknownSink = errors.New("unknown sink")
+)
+
+// sink receives the changed pools and the best arbitrage opportunities of every block of the watch command
+// and the reorgs rolling back the caches, the chains of a multi-chain watch report to the same sink concurrently
+type sink interface {
+	Block(chainID uint64, update server.BlockUpdate, opportunities []arbitrage.Opportunity) error
+	Reorg(chainID uint64, reorg cache.Reorg) error
+}
+
+// newSink creates a sink by name writing to w
+func newSink(name string, w io.Writer) (sink, error) {
+	switch name {
+	case "text":
+		return &textSink{w: w}, nil
+	case "json":
+		return &jsonSink{enc: json.NewEncoder(w)}, nil
+	case "none":
+		return noneSink{}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("%s: %q", UnknownSink, name))
+	}
+}
+
+// textSink prints a human readable summary of every block
+type textSink struct {
+	w io.Writer
+	m sync.Mutex
+}
+
+func (s *textSink) Block(chainID uint64, update server.BlockUpdate, opportunities []arbitrage.Opportunity) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := fmt.Fprintf(s.w, "[%s] Block %d (%s): %d pools changed\n", chain.Name(chainID), update.Block, update.BlockHash, len(update.Pools)); err != nil {
+		return err
+	}
+
+	for i, o := range opportunities {
+		symbols := make([]string, 0)
+		for _, t := range o.Cycle.Tokens() {
+			symbols = append(symbols, t.Symbol)
+		}
+		if _, err := fmt.Fprintf(s.w, "  #%d %s in: %s out: %s profit: %s\n", i+1, strings.Join(symbols, " -> "), o.AmountIn, o.AmountOut, o.Profit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *textSink) Reorg(chainID uint64, reorg cache.Reorg) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "[%s] Reorg at block %d (%s): dropped %d blocks after block %d (%s)\n", chain.Name(chainID), reorg.Head.Number, reorg.Head.Hash, len(reorg.Dropped), reorg.Ancestor.Number, reorg.Ancestor.Hash)
+	return err
+}
+
+// opportunity is the JSON of an arbitrage opportunity, the quote is the cycle through the base token
+type opportunity struct {
+	Profit *big.Int `json:"profit"`
+	server.Quote
+}
+
+// blockReport is the JSON of a block
+type blockReport struct {
+	ChainID uint64 `json:"chainId"`
+	server.BlockUpdate
+	Opportunities []opportunity `json:"opportunities"`
+}
+
+// reorgReport is the JSON of a reorg
+type reorgReport struct {
+	ChainID uint64      `json:"chainId"`
+	Reorg   cache.Reorg `json:"reorg"`
+}
+
+// jsonSink writes every block and reorg as a line of JSON
+type jsonSink struct {
+	enc *json.Encoder
+	m   sync.Mutex
+}
+
+func (s *jsonSink) Block(chainID uint64, update server.BlockUpdate, opportunities []arbitrage.Opportunity) error {
+	r := blockReport{
+		ChainID:       chainID,
+		BlockUpdate:   update,
+		Opportunities: make([]opportunity, 0, len(opportunities)),
+	}
+	for _, o := range opportunities {
+		r.Opportunities = append(r.Opportunities, opportunity{
+			Profit: o.Profit,
+			Quote:  server.NewQuote(o.Cycle),
+		})
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.enc.Encode(r)
+}
+
+func (s *jsonSink) Reorg(chainID uint64, reorg cache.Reorg) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.enc.Encode(reorgReport{ChainID: chainID, Reorg: reorg})
+}
+
+// noneSink discards every block and reorg, e.g. when only serving the caches
+type noneSink struct{}
+
+func (noneSink) Block(uint64, server.BlockUpdate, []arbitrage.Opportunity) error {
+	return nil
+}
+
+func (noneSink) Reorg(uint64, cache.Reorg) error {
+	return nil
+}
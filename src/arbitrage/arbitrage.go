@@ -0,0 +1,200 @@
+package arbitrage
+
+import (
+	"PoolHelper/src/router"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sort"
+)
+
+var (
+	InvalidHops  = errors.New("cycles need at least 2 hops")
+	InvalidInput = errors.New("invalid probe or max input amount")
+)
+
+// Opportunity is a profitable cycle starting and ending at the base token
+type Opportunity struct {
+	Base      common.Address
+	Cycle     router.Route
+	AmountIn  *big.Int
+	AmountOut *big.Int
+
+	// Profit is the output minus the input in the base token
+	Profit *big.Int
+}
+
+// Scanner searches the router graph for profitable cycles
+type Scanner struct {
+	router   *router.Router
+	maxHops  int
+	probe    *big.Int
+	maxInput *big.Int
+}
+
+// NewScanner creates a new cycle scanner
+// maxHops bounds the cycle length (2 for cross pool, 3 for triangular cycles)
+// probe is the base token amount used to screen cycles by their marginal rate
+// maxInput is the upper bound of the optimal input search
+func NewScanner(r *router.Router, maxHops int, probe *big.Int, maxInput *big.Int) (*Scanner, error) {
+	if maxHops < 2 {
+		return nil, InvalidHops
+	}
+	if probe == nil || maxInput == nil || probe.Sign() <= 0 || maxInput.Cmp(probe) < 0 {
+		return nil, InvalidInput
+	}
+
+	return &Scanner{
+		router:   r,
+		maxHops:  maxHops,
+		probe:    probe,
+		maxInput: maxInput,
+	}, nil
+}
+
+// Scan returns the profitable cycles through the base token ranked by profit
+// each cycle is sized with the input that maximizes its profit
+func (s *Scanner) Scan(base common.Address) []Opportunity {
+	opportunities := make([]Opportunity, 0)
+	for _, cycle := range s.cycles(base) {
+		if o, ok := s.optimize(base, cycle); ok {
+			opportunities = append(opportunities, o)
+		}
+	}
+
+	sort.SliceStable(opportunities, func(i, j int) bool {
+		return opportunities[i].Profit.Cmp(opportunities[j].Profit) > 0
+	})
+	return opportunities
+}
+
+// cycles returns the cycles through the base token that are profitable for the probe amount
+// cycles do not use a pool twice and only visit the base token at both ends
+func (s *Scanner) cycles(base common.Address) [][]router.Edge {
+	cycles := make([][]router.Edge, 0)
+
+	var walk func(path []router.Edge, amount *big.Int)
+	walk = func(path []router.Edge, amount *big.Int) {
+		last := base
+		if len(path) > 0 {
+			last = path[len(path)-1].TokenOut.Address
+		}
+
+		for _, e := range s.router.Edges(last) {
+			if !canVisit(path, base, e) {
+				continue
+			}
+
+			amountOut, err := e.AmountOut(amount)
+			if err != nil || amountOut.Sign() <= 0 {
+				continue
+			}
+
+			// close the cycle if it is profitable at the margin
+			if e.TokenOut.Address == base {
+				if len(path) > 0 && amountOut.Cmp(s.probe) > 0 {
+					cycles = append(cycles, append(append([]router.Edge(nil), path...), e))
+				}
+				continue
+			}
+
+			if len(path)+1 < s.maxHops {
+				walk(append(path, e), amountOut)
+			}
+		}
+	}
+	walk(make([]router.Edge, 0, s.maxHops), s.probe)
+
+	return cycles
+}
+
+// optimize finds the input that maximizes the profit of a cycle
+// the profit of a cycle is concave in its input, so a ternary search finds the optimum
+func (s *Scanner) optimize(base common.Address, cycle []router.Edge) (Opportunity, bool) {
+	lo, hi := new(big.Int).Set(s.probe), new(big.Int).Set(s.maxInput)
+	three := big.NewInt(3)
+
+	for new(big.Int).Sub(hi, lo).Cmp(three) > 0 {
+		third := new(big.Int).Quo(new(big.Int).Sub(hi, lo), three)
+		m1 := new(big.Int).Add(lo, third)
+		m2 := new(big.Int).Sub(hi, third)
+
+		if profitLess(quote(cycle, m1), quote(cycle, m2)) {
+			lo = m1
+		} else {
+			hi = m2
+		}
+	}
+
+	// pick the best input of the remaining range
+	var best *router.Route
+	for x := new(big.Int).Set(lo); x.Cmp(hi) <= 0; x = new(big.Int).Add(x, big.NewInt(1)) {
+		if r := quote(cycle, x); r != nil && profitLess(best, r) {
+			best = r
+		}
+	}
+	if best == nil || best.AmountOut.Cmp(best.AmountIn) <= 0 {
+		return Opportunity{}, false
+	}
+
+	return Opportunity{
+		Base:      base,
+		Cycle:     *best,
+		AmountIn:  best.AmountIn,
+		AmountOut: best.AmountOut,
+		Profit:    new(big.Int).Sub(best.AmountOut, best.AmountIn),
+	}, true
+}
+
+///
+/// Utils
+///
+
+// quote quotes a cycle for the given input, returns nil if a pool can not fill it
+func quote(cycle []router.Edge, amountIn *big.Int) *router.Route {
+	route := router.Route{
+		Hops:      make([]router.Hop, 0, len(cycle)),
+		AmountIn:  amountIn,
+		AmountOut: amountIn,
+	}
+
+	for i, e := range cycle {
+		amountOut, err := e.AmountOut(route.AmountOut)
+		if err != nil {
+			return nil
+		}
+
+		route.Hops = append(route.Hops, router.Hop{Edge: e, AmountIn: route.AmountOut, AmountOut: amountOut})
+		route.AmountOut = amountOut
+		if block := e.LastBlock(); i == 0 || block < route.Block {
+			route.Block = block
+		}
+	}
+
+	return &route
+}
+
+// profitLess returns true if route a is less profitable than route b
+// unquotable routes are the least profitable
+func profitLess(a *router.Route, b *router.Route) bool {
+	if b == nil {
+		return false
+	}
+	if a == nil {
+		return true
+	}
+
+	profitA := new(big.Int).Sub(a.AmountOut, a.AmountIn)
+	profitB := new(big.Int).Sub(b.AmountOut, b.AmountIn)
+	return profitA.Cmp(profitB) < 0
+}
+
+// canVisit returns true if the edge does not reuse a pool or revisit a token of the path
+func canVisit(path []router.Edge, base common.Address, e router.Edge) bool {
+	for _, p := range path {
+		if p.Pool == e.Pool || p.TokenOut.Address == e.TokenOut.Address {
+			return false
+		}
+	}
+	return e.TokenOut.Address != base || len(path) > 0
+}
@@ -0,0 +1,89 @@
+package arbitrage_test
+
+import (
+	"PoolHelper/src/arbitrage"
+	"PoolHelper/src/pool"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/router"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"bytes"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func newPool(f common.Address, tokenA, tokenB common.Address, reserveA, reserveB int64) pool.Pool[uniswap.Reserves, any] {
+	p := uniswap.NewV2Pool(f, common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"), 30, pair.Pair[any]{
+		TokenA: token.ERC20{Address: tokenA},
+		TokenB: token.ERC20{Address: tokenB},
+	})
+
+	// reserves are sorted by address
+	if bytes.Compare(tokenB.Bytes(), tokenA.Bytes()) < 0 {
+		reserveA, reserveB = reserveB, reserveA
+	}
+	p.Update(uniswap.Reserves{Reserve0: big.NewInt(reserveA), Reserve1: big.NewInt(reserveB)}, 1)
+	return p
+}
+
+func TestScanner_Scan(t *testing.T) {
+	base, a, b := common.HexToAddress("0x01"), common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	f0, f1 := common.HexToAddress("0xf0"), common.HexToAddress("0xf1")
+
+	// base/a is 10% cheaper on f1, the triangle through b is balanced
+	r := router.NewRouter()
+	router.AddPools(r, []pool.Pool[uniswap.Reserves, any]{
+		newPool(f0, base, a, 1_000_000_000, 1_000_000_000),
+		newPool(f1, base, a, 1_000_000_000, 1_100_000_000),
+		newPool(f0, a, b, 1_000_000_000, 1_000_000_000),
+		newPool(f0, b, base, 1_000_000_000, 1_000_000_000),
+	})
+
+	s, err := arbitrage.NewScanner(r, 3, big.NewInt(1_000), big.NewInt(1_000_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opportunities := s.Scan(base)
+	if len(opportunities) == 0 {
+		t.Fatal("expected opportunities")
+	}
+
+	// best cycle buys a on f1 and sells it on f0
+	best := opportunities[0]
+	if len(best.Cycle.Hops) != 2 || best.Cycle.Hops[0].Factory != f1 || best.Cycle.Hops[1].Factory != f0 {
+		t.Errorf("expected the cross factory cycle, got %v", best.Cycle.Tokens())
+	}
+	for i := 1; i < len(opportunities); i++ {
+		if opportunities[i].Profit.Cmp(opportunities[i-1].Profit) > 0 {
+			t.Errorf("opportunities are not ranked")
+		}
+	}
+
+	// the optimal input beats nearby inputs
+	for _, scale := range []int64{90, 110} {
+		amountIn := new(big.Int).Quo(new(big.Int).Mul(best.AmountIn, big.NewInt(scale)), big.NewInt(100))
+		amountOut := amountIn
+		for _, h := range best.Cycle.Hops {
+			amountOut, err = h.Edge.AmountOut(amountOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if profit := new(big.Int).Sub(amountOut, amountIn); profit.Cmp(best.Profit) > 0 {
+			t.Errorf("input %v is more profitable than the optimum %v", amountIn, best.AmountIn)
+		}
+	}
+
+	// balanced pools have no opportunities
+	r = router.NewRouter()
+	router.AddPools(r, []pool.Pool[uniswap.Reserves, any]{
+		newPool(f0, base, a, 1_000_000_000, 1_000_000_000),
+		newPool(f1, base, a, 1_000_000_000, 1_000_000_000),
+	})
+	s, _ = arbitrage.NewScanner(r, 3, big.NewInt(1_000), big.NewInt(1_000_000_000))
+	if opportunities := s.Scan(base); len(opportunities) != 0 {
+		t.Errorf("expected no opportunities, got %d", len(opportunities))
+	}
+}
@@ -6,35 +6,130 @@ import (
 	"PoolHelper/src/structs/factory"
 	"PoolHelper/src/structs/token"
 	"context"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
 )
 
 // TokenCache is an interface for adding and removing ERC20 tokens
 type TokenCache interface {
 	AddToken(token.ERC20) error
-	ImportTokens(context.Context, generic.Multicall, []common.Address) error
+	ImportTokens(context.Context, generic.Multicall, []common.Address) (ImportReport, error)
+	ImportTokenList(context.Context, generic.Multicall, []token.ERC20) (ImportReport, error)
 	RemoveToken(common.Address) error
 	Token(common.Address) (token.ERC20, error)
 	Tokens() ([]token.ERC20, error)
 }
 
+// ImportReport lists the tokens added by a token import and the tokens it skipped
+type ImportReport struct {
+	// Imported is the number of tokens added to the cache
+	Imported int `json:"imported"`
+	// Skipped are the tokens whose metadata could not be fetched or decoded, they are not added to the cache
+	Skipped []SkippedToken `json:"skipped"`
+	// Mismatched are the listed metadata that differ from the on-chain metadata, the tokens are added with the on-chain metadata
+	Mismatched []MismatchedToken `json:"mismatched"`
+}
+
+// SkippedToken is a token left out of an import and the reason it was skipped
+type SkippedToken struct {
+	Address common.Address `json:"address"`
+	Reason  string         `json:"reason"`
+}
+
+// MismatchedToken is a field of a token whose listed value differs from its on-chain value
+type MismatchedToken struct {
+	Address common.Address `json:"address"`
+	Field   string         `json:"field"`
+	Listed  string         `json:"listed"`
+	OnChain string         `json:"onChain"`
+}
+
 // PoolCache is an interface for adding and removing pools
 type PoolCache[ReserveType any, OptionType any] interface {
 	InitializePools(factory.Factory[OptionType]) error
+	DiscoverPools(context.Context, generic.Multicall, factory.Factory[OptionType], uint64) (DiscoveryReport, error)
 	RemovePool(common.Address) error
 	Pool(common.Address) (pool.Pool[ReserveType, OptionType], error)
 	Pools() []pool.Pool[ReserveType, OptionType]
 }
 
+// DiscoveryReport counts the candidate pools checked by a pool discovery
+type DiscoveryReport struct {
+	// Candidates is the number of token pairs (and fee tiers) looked up on the factory
+	Candidates int `json:"candidates"`
+	// Deployed is the number of candidates deployed on chain and added to the cache
+	Deployed int `json:"deployed"`
+	// Skipped is the number of candidates without a deployed pool
+	Skipped int `json:"skipped"`
+	// Mismatched is the number of deployed pools whose address does not match the CREATE2 address
+	// (e.g. a wrong init code hash), these pools are skipped as well
+	Mismatched int `json:"mismatched"`
+	// Failed is the number of candidates whose factory lookup failed, they are looked up again by the next discovery
+	Failed int `json:"failed"`
+}
+
 // ReserveCache is an interface for updating pool reserves
 type ReserveCache[ReserveType any] interface {
-	SyncAll(context.Context, generic.Multicall, uint64) error
-	Sync(context.Context, generic.Multicall, []common.Address, uint64) error
+	SyncAll(context.Context, generic.Multicall, Block) error
+	Sync(context.Context, generic.Multicall, []common.Address, Block) error
 	LastSynced() uint64
 }
 
+// LogCache is an interface for updating pool reserves from event logs
+type LogCache interface {
+	LogTopics() []common.Hash
+	ValidateLogs([]types.Log, Block) error
+	ApplyLogs([]types.Log, Block) error
+}
+
 type DEXCache[ReserveType any, OptionType any] interface {
 	TokenCache
 	PoolCache[ReserveType, OptionType]
 	ReserveCache[ReserveType]
+	LogCache
+	HistoryCache
+	SnapshotCache[ReserveType, OptionType]
+}
+
+// LogDispatcher is an interface for fetching event logs
+type LogDispatcher interface {
+	FilterLogs(context.Context, ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// SyncLogs fetches the event logs of the caches between two blocks (inclusive)
+// and applies them to the cached pools
+// logs are filtered by topic only, the caches skip logs of pools they do not track
+// the logs are validated by every cache before any applies them, so the caches are left at the same head
+func SyncLogs(ctx context.Context, d LogDispatcher, from uint64, to Block, caches ...LogCache) error {
+	// collect topics
+	topics := make([]common.Hash, 0)
+	for _, c := range caches {
+		topics = append(topics, c.LogTopics()...)
+	}
+
+	// fetch logs
+	logs, err := d.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to.Number),
+		Topics:    [][]common.Hash{topics},
+	})
+	if err != nil {
+		return err
+	}
+
+	// validate logs, then apply them
+	for _, c := range caches {
+		if err := c.ValidateLogs(logs, to); err != nil {
+			return err
+		}
+	}
+	for _, c := range caches {
+		if err := c.ApplyLogs(logs, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultHistoryDepth is the default number of synced blocks a cache can roll back
+const DefaultHistoryDepth = 64
+
+var (
+	ReorgTooDeep = errors.New("reorg is deeper than the block history")
+)
+
+// Block is a synced block
+type Block struct {
+	Number     uint64      `json:"number"`
+	Hash       common.Hash `json:"hash"`
+	ParentHash common.Hash `json:"parentHash"`
+}
+
+// HeaderBlock returns the block of a header
+func HeaderBlock(h *types.Header) Block {
+	return Block{
+		Number:     h.Number.Uint64(),
+		Hash:       h.Hash(),
+		ParentHash: h.ParentHash,
+	}
+}
+
+// HistoryCache is an interface for rolling back a cache to a previously synced block
+type HistoryCache interface {
+	Head() Block
+	History() []Block
+	Rollback(Block) error
+}
+
+///
+/// History
+///
+
+// PoolState is the state of a pool with the block it was synced at
+type PoolState[ReserveType any] struct {
+	State ReserveType
+	Block uint64
+}
+
+// History is a bounded journal of the blocks synced by a cache
+// every block keeps the previous states of the pools it changed, so the cache can be rolled back to any block of the history
+// the caches guard their history with their own lock
+type History[ReserveType any] struct {
+	depth int
+	// base is the oldest block the history can be rolled back to
+	base   Block
+	blocks []historyBlock[ReserveType]
+}
+
+// historyBlock is a synced block with the states of the pools before it
+type historyBlock[ReserveType any] struct {
+	block    Block
+	previous map[common.Address]PoolState[ReserveType]
+}
+
+// NewHistory creates an empty history keeping the last depth blocks
+func NewHistory[ReserveType any](depth int) *History[ReserveType] {
+	return &History[ReserveType]{
+		depth:  max(depth, 0),
+		blocks: make([]historyBlock[ReserveType], 0),
+	}
+}
+
+// SetDepth sets the number of blocks kept, older blocks are dropped
+func (h *History[ReserveType]) SetDepth(depth int) {
+	h.depth = max(depth, 0)
+	h.trim()
+}
+
+// Head returns the last synced block
+func (h *History[ReserveType]) Head() Block {
+	if len(h.blocks) == 0 {
+		return h.base
+	}
+	return h.blocks[len(h.blocks)-1].block
+}
+
+// Blocks returns the blocks the history can be rolled back to, oldest first
+func (h *History[ReserveType]) Blocks() []Block {
+	blocks := make([]Block, 0, len(h.blocks)+1)
+	blocks = append(blocks, h.base)
+	for _, b := range h.blocks {
+		blocks = append(blocks, b.block)
+	}
+	return blocks
+}
+
+// Reset drops the history and starts it at a block, e.g. a restored snapshot
+func (h *History[ReserveType]) Reset(b Block) {
+	h.base = b
+	h.blocks = make([]historyBlock[ReserveType], 0)
+}
+
+// Push appends a synced block with the states of the pools it changed before the block
+func (h *History[ReserveType]) Push(b Block, previous map[common.Address]PoolState[ReserveType]) {
+	h.blocks = append(h.blocks, historyBlock[ReserveType]{block: b, previous: previous})
+	h.trim()
+}
+
+// Rollback drops the blocks after a block of the history
+// returns the states of the pools changed by the dropped blocks at the block
+func (h *History[ReserveType]) Rollback(to Block) (map[common.Address]PoolState[ReserveType], error) {
+	// find the block
+	i := len(h.blocks) - 1
+	for ; i >= 0; i-- {
+		if b := h.blocks[i].block; b.Number == to.Number && b.Hash == to.Hash {
+			break
+		}
+	}
+	if i < 0 && (h.base.Number != to.Number || h.base.Hash != to.Hash) {
+		return nil, ReorgTooDeep
+	}
+
+	// undo the dropped blocks from the newest, so the oldest previous state wins
+	states := make(map[common.Address]PoolState[ReserveType])
+	for j := len(h.blocks) - 1; j > i; j-- {
+		for address, state := range h.blocks[j].previous {
+			states[address] = state
+		}
+	}
+	h.blocks = h.blocks[:i+1]
+
+	return states, nil
+}
+
+// trim drops the oldest blocks exceeding the depth
+func (h *History[ReserveType]) trim() {
+	if drop := len(h.blocks) - h.depth; drop > 0 {
+		h.base = h.blocks[drop-1].block
+		h.blocks = append([]historyBlock[ReserveType](nil), h.blocks[drop:]...)
+	}
+}
+
+///
+/// Reorg
+///
+
+// HeaderReader is an interface for fetching block headers
+type HeaderReader interface {
+	HeaderByHash(context.Context, common.Hash) (*types.Header, error)
+}
+
+// Reorg is a chain reorganization, the blocks after the common ancestor were replaced by another branch
+type Reorg struct {
+	// Ancestor is the last block of both branches, the caches were rolled back to it
+	Ancestor Block `json:"ancestor"`
+	// Dropped are the synced blocks of the old branch, oldest first
+	Dropped []Block `json:"dropped"`
+	// Head is the head of the new branch
+	Head Block `json:"head"`
+}
+
+// HandleReorg checks if a new head extends the last synced block of the caches
+// if it does not, the caches are rolled back to the common ancestor of both branches and the reorg is returned,
+// the new branch is applied by syncing the caches to the head afterwards
+// returns nil if the head extends the caches or the caches have no block hash yet
+func HandleReorg(ctx context.Context, r HeaderReader, head Block, caches ...HistoryCache) (*Reorg, error) {
+	if len(caches) == 0 {
+		return nil, nil
+	}
+
+	// collect the blocks every cache can be rolled back to
+	histories := make([]map[uint64]Block, len(caches))
+	oldest, top := uint64(0), 0
+	for i, c := range caches {
+		h := c.Head()
+		if h.Hash == (common.Hash{}) {
+			return nil, nil
+		}
+		if h.Number > caches[top].Head().Number {
+			top = i
+		}
+
+		histories[i] = make(map[uint64]Block)
+		for _, b := range c.History() {
+			histories[i][b.Number] = b
+		}
+		if blocks := c.History(); blocks[0].Number > oldest {
+			oldest = blocks[0].Number
+		}
+	}
+	known := func(number uint64, hash common.Hash) (Block, bool) {
+		for _, h := range histories {
+			if b, ok := h[number]; !ok || b.Hash != hash {
+				return Block{}, false
+			}
+		}
+		return histories[0][number], true
+	}
+
+	// walk the new branch back until a synced block
+	var ancestor Block
+	for cursor := head; ; {
+		if b, ok := known(cursor.Number, cursor.Hash); ok {
+			ancestor = b
+			break
+		}
+		if cursor.Number <= oldest {
+			return nil, ReorgTooDeep
+		}
+		if b, ok := known(cursor.Number-1, cursor.ParentHash); ok {
+			ancestor = b
+			break
+		}
+
+		parent, err := r.HeaderByHash(ctx, cursor.ParentHash)
+		if err != nil {
+			return nil, err
+		}
+		cursor = HeaderBlock(parent)
+	}
+
+	// the head extends every cache
+	extends := true
+	for _, c := range caches {
+		if c.Head().Hash != ancestor.Hash {
+			extends = false
+		}
+	}
+	if extends {
+		return nil, nil
+	}
+
+	// roll back to the ancestor
+	reorg := &Reorg{
+		Ancestor: ancestor,
+		Dropped:  make([]Block, 0),
+		Head:     head,
+	}
+	for _, b := range caches[top].History() {
+		if b.Number > ancestor.Number {
+			reorg.Dropped = append(reorg.Dropped, b)
+		}
+	}
+	for _, c := range caches {
+		if err := c.Rollback(ancestor); err != nil {
+			return nil, err
+		}
+	}
+
+	return reorg, nil
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"os"
+	"path/filepath"
+)
+
+// SnapshotVersion is the version of the snapshot format
+// snapshots of other versions are rejected when loaded
+const SnapshotVersion = 1
+
+var (
+	InvalidSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+// SnapshotCache is an interface for saving and restoring the cache content
+type SnapshotCache[ReserveType any, OptionType any] interface {
+	Snapshot() (Snapshot[ReserveType, OptionType], error)
+	Restore(Snapshot[ReserveType, OptionType]) error
+}
+
+// Snapshot is the content of a cache at its last synced block
+type Snapshot[ReserveType any, OptionType any] struct {
+	Version   int         `json:"version"`
+	Block     uint64      `json:"block"`
+	BlockHash common.Hash `json:"blockHash"`
+
+	Tokens    []token.ERC20                           `json:"tokens"`
+	Factories []factory.Factory[OptionType]           `json:"factories"`
+	Pools     []PoolSnapshot[ReserveType, OptionType] `json:"pools"`
+}
+
+// PoolSnapshot is the state of a cached pool, tokens and factory refer to the snapshot entries
+type PoolSnapshot[ReserveType any, OptionType any] struct {
+	Address common.Address `json:"address"`
+	Factory common.Address `json:"factory"`
+	TokenA  common.Address `json:"tokenA"`
+	TokenB  common.Address `json:"tokenB"`
+	Options OptionType     `json:"options"`
+
+	State ReserveType `json:"state"`
+	Block uint64      `json:"block"`
+}
+
+// SaveSnapshot writes a snapshot to a file
+// the file is replaced atomically, so a failed write keeps the previous snapshot
+func SaveSnapshot[ReserveType any, OptionType any](path string, s Snapshot[ReserveType, OptionType]) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file & replace the snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads a snapshot from a file
+func LoadSnapshot[ReserveType any, OptionType any](path string) (Snapshot[ReserveType, OptionType], error) {
+	s := Snapshot[ReserveType, OptionType]{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, err
+	}
+
+	// check the snapshot format
+	if s.Version != SnapshotVersion {
+		return s, InvalidSnapshotVersion
+	}
+
+	return s, nil
+}
@@ -0,0 +1,165 @@
+package uniswap_test
+
+import (
+	"PoolHelper/src/cache/uniswap"
+	"PoolHelper/src/multicall/generic"
+	poolUniswap "PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"bytes"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+var (
+	weth  = token.ERC20{Address: common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"), Decimals: big.NewInt(18), Symbol: "WETH", Name: "Wrapped Ether"}
+	usdc  = token.ERC20{Address: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Decimals: big.NewInt(6), Symbol: "USDC", Name: "USD Coin"}
+	bnb   = token.ERC20{Address: common.HexToAddress("0xB8c77482e45F1F44dE1745F52C74426C631bDD52"), Decimals: big.NewInt(18), Symbol: "BNB", Name: "BNB"}
+	steth = token.ERC20{Address: common.HexToAddress("0xae7ab96520DE3A18E5e111B5EaAb095312D7fE84"), Decimals: big.NewInt(18), Symbol: "stETH", Name: "Liquid staked Ether 2.0"}
+)
+
+// factoryMulticall answers getPair and getPool calls from a fixed set of deployed pools
+type factoryMulticall struct {
+	pools map[string]common.Address
+}
+
+func (m factoryMulticall) Aggregate(_ context.Context, calls []generic.Call3, _ uint64) ([]generic.Result, error) {
+	results := make([]generic.Result, len(calls))
+	for i, call := range calls {
+		results[i].Success = true
+		key := string(call.CallData[4:])
+		if deployed, ok := m.pools[key]; ok {
+			results[i].ReturnData = common.LeftPadBytes(deployed.Bytes(), 32)
+		} else {
+			results[i].ReturnData = make([]byte, 32)
+		}
+	}
+	return results, nil
+}
+
+// deploy registers a pool for both token orders of the lookup
+func (m factoryMulticall) deploy(a common.Address, b common.Address, fee []byte, deployed common.Address) {
+	for _, tokens := range [][2]common.Address{{a, b}, {b, a}} {
+		key := append(common.LeftPadBytes(tokens[0].Bytes(), 32), common.LeftPadBytes(tokens[1].Bytes(), 32)...)
+		if fee != nil {
+			key = append(key, common.LeftPadBytes(fee, 32)...)
+		}
+		m.pools[string(key)] = deployed
+	}
+}
+
+// create2 computes the pool address like the factory, sorting tokens by their bytes
+func create2(f common.Address, initHash common.Hash, a common.Address, b common.Address, fee []byte) common.Address {
+	if bytes.Compare(b.Bytes(), a.Bytes()) < 0 {
+		a, b = b, a
+	}
+
+	salt := append(a.Bytes(), b.Bytes()...)
+	if fee != nil {
+		salt = append(common.LeftPadBytes(a.Bytes(), 32), common.LeftPadBytes(b.Bytes(), 32)...)
+		salt = append(salt, common.LeftPadBytes(fee, 32)...)
+	}
+	return crypto.CreateAddress2(f, crypto.Keccak256Hash(salt), initHash.Bytes())
+}
+
+func TestV2Cache_DiscoverPools(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, nil, create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil))
+	m.deploy(steth.Address, bnb.Address, nil, create2(f.Address, f.InitHash, steth.Address, bnb.Address, nil))
+	m.deploy(weth.Address, bnb.Address, nil, common.HexToAddress("0x01"))
+
+	c := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc, bnb, steth} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := c.DiscoverPools(context.Background(), m, f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Candidates != 6 || report.Deployed != 2 || report.Skipped != 3 || report.Mismatched != 1 {
+		t.Errorf("wrong report: %+v", report)
+	}
+
+	// only the deployed pools are cached
+	if pools := c.Pools(); len(pools) != 2 {
+		t.Fatalf("wrong number of pools: %v", len(pools))
+	}
+	for _, addr := range []common.Address{
+		create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil),
+		create2(f.Address, f.InitHash, steth.Address, bnb.Address, nil),
+	} {
+		if _, err := c.Pool(addr); err != nil {
+			t.Errorf("pool %s not discovered: %v", addr.Hex(), err)
+		}
+	}
+
+	// a token added after the discovery gets no pools until the next discovery
+	dai := token.ERC20{Address: common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"), Decimals: big.NewInt(18), Symbol: "DAI", Name: "Dai Stablecoin"}
+	if err := c.AddToken(dai); err != nil {
+		t.Fatal(err)
+	}
+	if pools := c.Pools(); len(pools) != 2 {
+		t.Fatalf("wrong number of pools after adding a token: %v", len(pools))
+	}
+	m.deploy(weth.Address, dai.Address, nil, create2(f.Address, f.InitHash, weth.Address, dai.Address, nil))
+	if report, err = c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	if report.Candidates != 10 || report.Deployed != 3 || len(c.Pools()) != 3 {
+		t.Errorf("wrong rediscovery: %+v", report)
+	}
+}
+
+func TestV3Cache_DiscoverPools(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.LOW, poolUniswap.NORMAL},
+	}
+
+	low := big.NewInt(int64(poolUniswap.LOW)).Bytes()
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, low, create2(f.Address, f.InitHash, weth.Address, usdc.Address, low))
+
+	c := uniswap.NewV3Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := c.DiscoverPools(context.Background(), m, f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Candidates != 2 || report.Deployed != 1 || report.Skipped != 1 || report.Mismatched != 0 {
+		t.Errorf("wrong report: %+v", report)
+	}
+
+	// the discovered pool is the known WETH/USDC 0.05% pool
+	if _, err := c.Pool(common.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640")); err != nil {
+		t.Errorf("pool not discovered: %v", err)
+	}
+
+	// a token added after the discovery gets no pools until the next discovery
+	if err := c.AddToken(bnb); err != nil {
+		t.Fatal(err)
+	}
+	if pools := c.Pools(); len(pools) != 1 {
+		t.Errorf("wrong number of pools after adding a token: %v", len(pools))
+	}
+}
@@ -0,0 +1,332 @@
+package uniswap_test
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/cache/uniswap"
+	poolUniswap "PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+// logDispatcher answers every log filter with fixed logs
+type logDispatcher []types.Log
+
+func (d logDispatcher) FilterLogs(context.Context, ethereum.FilterQuery) ([]types.Log, error) {
+	return d, nil
+}
+
+// headerChain answers header lookups from a fixed set of headers
+type headerChain map[common.Hash]*types.Header
+
+func (c headerChain) HeaderByHash(_ context.Context, hash common.Hash) (*types.Header, error) {
+	if h, ok := c[hash]; ok {
+		return h, nil
+	}
+	return nil, errors.New("header not found")
+}
+
+// child creates a header on top of a parent, branch tells siblings apart
+func (c headerChain) child(parent *types.Header, branch byte) *types.Header {
+	h := &types.Header{
+		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+		ParentHash: parent.Hash(),
+		Difficulty: big.NewInt(0),
+		Extra:      []byte{branch},
+	}
+	c[h.Hash()] = h
+	return h
+}
+
+// syncLog creates a Sync log of a pool
+func syncLog(pool common.Address, topic common.Hash, reserve int64, block uint64) types.Log {
+	data := append(common.LeftPadBytes(big.NewInt(reserve).Bytes(), 32), common.LeftPadBytes(big.NewInt(reserve).Bytes(), 32)...)
+	return types.Log{Address: pool, Topics: []common.Hash{topic}, Data: data, BlockNumber: block}
+}
+
+func TestV2Cache_Reorg(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, nil, poolAddr)
+
+	c := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	topic := c.LogTopics()[0]
+	reserve := func() int64 {
+		p, _ := c.Pool(poolAddr)
+		state, _, _ := p.State()
+		return state.Reserve0.Int64()
+	}
+
+	// sync blocks 100 - 102
+	chain := headerChain{}
+	h100 := &types.Header{Number: big.NewInt(100), Difficulty: big.NewInt(0)}
+	chain[h100.Hash()] = h100
+	h101 := chain.child(h100, 0)
+	h102 := chain.child(h101, 0)
+	for i, h := range []*types.Header{h100, h101, h102} {
+		logs := []types.Log{syncLog(poolAddr, topic, int64(i+1), h.Number.Uint64())}
+		if err := c.ApplyLogs(logs, cache.HeaderBlock(h)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Head().Hash != h102.Hash() || len(c.History()) != 4 || reserve() != 3 {
+		t.Fatalf("wrong synced head: %+v %v", c.Head(), reserve())
+	}
+
+	// the next block extends the cache
+	if reorg, err := cache.HandleReorg(context.Background(), chain, cache.HeaderBlock(chain.child(h102, 0)), c); err != nil || reorg != nil {
+		t.Errorf("expected no reorg, got %+v %v", reorg, err)
+	}
+
+	// a sibling of the head rolls back a block
+	sibling := chain.child(h101, 1)
+	reorg, err := cache.HandleReorg(context.Background(), chain, cache.HeaderBlock(sibling), c)
+	if err != nil || reorg == nil {
+		t.Fatalf("expected a reorg, got %v", err)
+	}
+	if reorg.Ancestor.Hash != h101.Hash() || len(reorg.Dropped) != 1 || reorg.Dropped[0].Hash != h102.Hash() {
+		t.Errorf("wrong reorg: %+v", reorg)
+	}
+	if c.LastSynced() != 101 || reserve() != 2 {
+		t.Errorf("wrong rolled back state: %v %v", c.LastSynced(), reserve())
+	}
+
+	// the new branch is applied on top of the ancestor
+	if err := c.ApplyLogs([]types.Log{syncLog(poolAddr, topic, 30, 102)}, cache.HeaderBlock(sibling)); err != nil {
+		t.Fatal(err)
+	}
+	if reserve() != 30 {
+		t.Errorf("wrong new branch state: %v", reserve())
+	}
+
+	// a longer branch is walked back to the common ancestor
+	fork := chain.child(chain.child(h100, 2), 2)
+	if reorg, err = cache.HandleReorg(context.Background(), chain, cache.HeaderBlock(fork), c); err != nil || reorg == nil {
+		t.Fatalf("expected a reorg, got %v", err)
+	}
+	if reorg.Ancestor.Hash != h100.Hash() || len(reorg.Dropped) != 2 || c.LastSynced() != 100 || reserve() != 1 {
+		t.Errorf("wrong reorg: %+v %v", reorg, reserve())
+	}
+
+	// reorgs deeper than the history are rejected
+	forkParent := chain[fork.ParentHash]
+	for _, h := range []*types.Header{forkParent, fork} {
+		if err := c.ApplyLogs(nil, cache.HeaderBlock(h)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.SetHistoryDepth(0)
+	if _, err := cache.HandleReorg(context.Background(), chain, cache.HeaderBlock(chain.child(forkParent, 3)), c); !errors.Is(err, cache.ReorgTooDeep) {
+		t.Errorf("expected a too deep reorg, got %v", err)
+	}
+}
+
+func TestV3Cache_Rollback(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.LOW},
+	}
+	low := big.NewInt(int64(poolUniswap.LOW)).Bytes()
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, low)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, low, poolAddr)
+
+	c := uniswap.NewV3Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Pool(poolAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sync the pool to block 100 & apply a swap in block 101
+	state := poolUniswap.V3State{
+		Slot0:       poolUniswap.Slot0{SqrtPriceX96: new(big.Int).Lsh(big.NewInt(1), 96), Tick: big.NewInt(0)},
+		Liquidity:   big.NewInt(1_000),
+		TickSpacing: 10,
+	}
+	p.Update(state, 100)
+	b100 := cache.Block{Number: 100, Hash: common.HexToHash("0x64")}
+	if err := c.ApplyLogs(nil, b100); err != nil {
+		t.Fatal(err)
+	}
+
+	swap := types.Log{
+		Address:     poolAddr,
+		Topics:      []common.Hash{c.LogTopics()[0]},
+		Data:        make([]byte, 32*5),
+		BlockNumber: 101,
+	}
+	copy(swap.Data[64:96], common.LeftPadBytes(new(big.Int).Lsh(big.NewInt(2), 96).Bytes(), 32))
+	copy(swap.Data[96:128], common.LeftPadBytes(big.NewInt(500).Bytes(), 32))
+	if err := c.ApplyLogs([]types.Log{swap}, cache.Block{Number: 101, Hash: common.HexToHash("0x65"), ParentHash: b100.Hash}); err != nil {
+		t.Fatal(err)
+	}
+	if swapped, _, _ := p.State(); swapped.Equal(state) {
+		t.Fatalf("swap not applied")
+	}
+
+	// roll back to block 100
+	if err := c.Rollback(b100); err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack, block, _ := p.State(); !rolledBack.Equal(state) || block != 100 || c.Head() != b100 {
+		t.Errorf("wrong rolled back state: %+v %v", rolledBack, block)
+	}
+	if err := c.Rollback(cache.Block{Number: 99}); !errors.Is(err, cache.ReorgTooDeep) {
+		t.Errorf("expected a too deep rollback, got %v", err)
+	}
+}
+
+func TestV2Cache_ApplyLogs_Malformed(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, nil, poolAddr)
+
+	c := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	topic := c.LogTopics()[0]
+	b100 := cache.Block{Number: 100, Hash: common.HexToHash("0x64")}
+	if err := c.ApplyLogs([]types.Log{syncLog(poolAddr, topic, 1, 100)}, b100); err != nil {
+		t.Fatal(err)
+	}
+
+	// a malformed log after a valid one leaves the cache unchanged
+	malformed := syncLog(poolAddr, topic, 3, 101)
+	malformed.Data = malformed.Data[:32]
+	logs := []types.Log{syncLog(poolAddr, topic, 2, 101), malformed}
+	if err := c.ApplyLogs(logs, cache.Block{Number: 101, Hash: common.HexToHash("0x65"), ParentHash: b100.Hash}); err == nil {
+		t.Fatal("expected a malformed log error")
+	}
+	p, _ := c.Pool(poolAddr)
+	if state, block, _ := p.State(); state.Reserve0.Int64() != 1 || block != 100 || c.Head() != b100 {
+		t.Errorf("malformed logs partially applied: %v at %v", state.Reserve0, block)
+	}
+}
+
+func TestV3Cache_ApplyLogs_Unsynced(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.LOW},
+	}
+	low := big.NewInt(int64(poolUniswap.LOW)).Bytes()
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, low)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, low, poolAddr)
+
+	c := uniswap.NewV3Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// a mint of a pool that was never synced is skipped
+	mint := types.Log{
+		Address:     poolAddr,
+		Topics:      []common.Hash{c.LogTopics()[1], {}, common.BigToHash(big.NewInt(0)), common.BigToHash(big.NewInt(10))},
+		Data:        make([]byte, 32*4),
+		BlockNumber: 101,
+	}
+	copy(mint.Data[32:64], common.LeftPadBytes(big.NewInt(1_000).Bytes(), 32))
+	if err := c.ApplyLogs([]types.Log{mint}, cache.Block{Number: 101, Hash: common.HexToHash("0x65")}); err != nil {
+		t.Fatal(err)
+	}
+	p, _ := c.Pool(poolAddr)
+	if state, block, _ := p.State(); block != 0 || len(state.Ticks) != 0 {
+		t.Errorf("unsynced pool updated: %+v at %v", state, block)
+	}
+}
+
+func TestSyncLogs_Atomic(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, nil, poolAddr)
+
+	cV2 := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := cV2.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cV2.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	topic := cV2.LogTopics()[0]
+	b100 := cache.Block{Number: 100, Hash: common.HexToHash("0x64")}
+	b101 := cache.Block{Number: 101, Hash: common.HexToHash("0x65"), ParentHash: b100.Hash}
+	if err := cV2.ApplyLogs([]types.Log{syncLog(poolAddr, topic, 1, 100)}, b100); err != nil {
+		t.Fatal(err)
+	}
+
+	// the V3 cache already synced the block, so the V2 cache must not apply it either
+	cV3 := uniswap.NewV3Cache()
+	if err := cV3.ApplyLogs(nil, b101); err != nil {
+		t.Fatal(err)
+	}
+	d := logDispatcher{syncLog(poolAddr, topic, 2, 101)}
+	if err := cache.SyncLogs(context.Background(), d, 101, b101, cV2, cV3); !errors.Is(err, uniswap.BlockAlreadySynced) {
+		t.Fatalf("expected an already synced block, got %v", err)
+	}
+	p, _ := cV2.Pool(poolAddr)
+	if state, block, _ := p.State(); state.Reserve0.Int64() != 1 || block != 100 || cV2.Head() != b100 {
+		t.Errorf("logs applied to the V2 cache: %v at %v", state.Reserve0, block)
+	}
+}
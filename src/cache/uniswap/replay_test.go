@@ -0,0 +1,172 @@
+package uniswap_test
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/cache/uniswap"
+	"PoolHelper/src/chain"
+	"PoolHelper/src/multicall"
+	"PoolHelper/src/multicall/generic"
+	"PoolHelper/src/multicall/replay"
+	poolUniswap "PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"context"
+	"flag"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"math/big"
+	"os"
+	"testing"
+)
+
+var (
+	record      = flag.String("record", "", "record the replay fixtures from this RPC endpoint instead of replaying them")
+	recordBlock = flag.Uint64("record-block", 0, "block to record the replay fixtures at, 0 is the latest block")
+)
+
+// mkr returns its symbol and name as bytes32 instead of strings
+var mkr = token.ERC20{Address: common.HexToAddress("0x9f8F72aA9304c8B593d555F12eF6589cC3A579A2"), Decimals: big.NewInt(18), Symbol: "MKR", Name: "Maker"}
+
+// replayDispatcher returns the dispatcher of a fixture and the block its calls were made at
+// with -record, the calls are made to the endpoint and saved to the fixture when the test ends
+// every call is pinned to the recorded block, calls at the latest block included
+func replayDispatcher(t *testing.T, fixture string) (multicall.ClientDispatcher, uint64) {
+	path := "testdata/" + fixture + ".json"
+	if *record == "" {
+		calls, err := replay.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) == 0 || calls[0].Block == nil {
+			t.Fatalf("%s: calls are not pinned to a block", path)
+		}
+		block := calls[0].Block.Uint64()
+		return replay.NewPinned(replay.NewReplayer(calls), block), block
+	}
+
+	client, err := ethclient.Dial(*record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	block := *recordBlock
+	if block == 0 {
+		header, err := client.HeaderByNumber(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = header.Number.Uint64()
+	}
+
+	recorder := replay.NewRecorder(client)
+	t.Cleanup(func() {
+		if err := recorder.Save(path); err != nil {
+			t.Error(err)
+		}
+	})
+	return replay.NewPinned(recorder, block), block
+}
+
+// replayCaller creates a caller over a dispatcher, the fixtures hold single calls so the chunking may change
+func replayCaller(t *testing.T, client multicall.ClientDispatcher) *generic.MulticallContract {
+	rawABI, err := os.Open("../../../abi/IMulticaller3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawABI.Close()
+
+	cAbi, err := abi.JSON(rawABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generic.NewCaller(chain.Multicall3, 10_000, 5_000_000, cAbi, client)
+}
+
+func TestV2Cache_Replay(t *testing.T) {
+	client, block := replayDispatcher(t, "replay_v2")
+	m := replayCaller(t, client)
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+
+	c := uniswap.NewV2Cache()
+	if _, err := c.ImportTokens(context.Background(), m, tokenAddresses(weth, usdc, mkr)); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []token.ERC20{weth, usdc, mkr} {
+		tkn, err := c.Token(expected.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tkn.Symbol != expected.Symbol || tkn.Name != expected.Name || tkn.Decimals.Cmp(expected.Decimals) != 0 {
+			t.Errorf("wrong token: %+v", tkn)
+		}
+	}
+
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), m, cache.Block{Number: block}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every pool is synced, WETH/USDC and WETH/MKR have liquidity
+	for _, p := range c.Pools() {
+		reserves, syncBlock, _ := p.State()
+		if syncBlock != block {
+			t.Errorf("%s not synced: %v", p.Pair(), syncBlock)
+		}
+		if p.Pair().Contains(weth.Address) && (reserves.Reserve0.Sign() <= 0 || reserves.Reserve1.Sign() <= 0) {
+			t.Errorf("wrong reserves of %s: %v %v", p.Pair(), reserves.Reserve0, reserves.Reserve1)
+		}
+	}
+}
+
+func TestV3Cache_Replay(t *testing.T) {
+	client, block := replayDispatcher(t, "replay_v3")
+	m := replayCaller(t, client)
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.LOW, poolUniswap.NORMAL},
+	}
+
+	c := uniswap.NewV3Cache()
+	if _, err := c.ImportTokens(context.Background(), m, tokenAddresses(weth, usdc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), m, cache.Block{Number: block}); err != nil {
+		t.Fatal(err)
+	}
+
+	pools := c.Pools()
+	if len(pools) != 2 {
+		t.Fatalf("wrong number of pools: %v", len(pools))
+	}
+	for _, p := range pools {
+		state, syncBlock, _ := p.State()
+		if state.Slot0.SqrtPriceX96.Sign() <= 0 || state.Liquidity.Sign() <= 0 || syncBlock != block {
+			t.Errorf("wrong state of %s: %+v at %v", p.Pair(), state.Slot0, syncBlock)
+		}
+
+		// the ticks are sorted, aligned to the spacing and inside the synced words
+		minTick, maxTick := state.MinWord<<8*state.TickSpacing, ((state.MaxWord+1)<<8)*state.TickSpacing
+		for i, tick := range state.Ticks {
+			if tick.Index%state.TickSpacing != 0 || tick.Index < minTick || tick.Index >= maxTick || (i > 0 && tick.Index <= state.Ticks[i-1].Index) {
+				t.Errorf("wrong tick of %s: %v", p.Pair(), tick.Index)
+			}
+		}
+		if len(state.Ticks) == 0 {
+			t.Errorf("no ticks of %s", p.Pair())
+		}
+	}
+}
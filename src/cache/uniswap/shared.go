@@ -1,6 +1,16 @@
 package uniswap
 
-import "errors"
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/multicall/generic"
+	"PoolHelper/src/structs/token"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"sort"
+)
 
 var (
 	TokenAlreadyExists = errors.New("token already exists in cache")
@@ -10,3 +20,158 @@ var (
 	PoolNotFound       = errors.New("pool not found")
 	BlockAlreadySynced = errors.New("block already synced")
 )
+
+///
+/// Tokens
+///
+
+var (
+	decimalsSelector = crypto.Keccak256([]byte("decimals()"))[:4]
+	symbolSelector   = crypto.Keccak256([]byte("symbol()"))[:4]
+	nameSelector     = crypto.Keccak256([]byte("name()"))[:4]
+)
+
+// tokenCalls creates the decimals, symbol and name calls of a token
+// the calls may fail, a token without valid metadata is skipped without failing the whole import
+func tokenCalls(target common.Address) []generic.Call3 {
+	calls := make([]generic.Call3, 0, 3)
+	for _, selector := range [][]byte{decimalsSelector, symbolSelector, nameSelector} {
+		calls = append(calls, generic.Call3{
+			Target:       target,
+			CallData:     selector,
+			AllowFailure: true,
+		})
+	}
+	return calls
+}
+
+// decodeToken decodes the results of the token calls of a token
+// a missing symbol or name falls back to the other one, the error is the reason the token is skipped
+func decodeToken(address common.Address, results []generic.Result) (token.ERC20, error) {
+	if !succeededCall(results[0]) {
+		return token.ERC20{}, errors.New(fmt.Sprintf("decimals() failed: %s", callFailure(results[0])))
+	}
+	decimals, err := token.DecodeDecimals(results[0].ReturnData)
+	if err != nil {
+		return token.ERC20{}, err
+	}
+
+	// decode the symbol and the name, failures are kept for the skip reason
+	texts := make([]string, 2)
+	failures := make([]string, 2)
+	for i, result := range results[1:3] {
+		if !succeededCall(result) {
+			failures[i] = callFailure(result)
+			continue
+		}
+		if texts[i], err = token.DecodeString(result.ReturnData); err != nil {
+			failures[i] = err.Error()
+		} else if texts[i] == "" {
+			failures[i] = "empty"
+		}
+	}
+	symbol, name := texts[0], texts[1]
+	if symbol == "" && name == "" {
+		return token.ERC20{}, errors.New(fmt.Sprintf("no symbol (%s) and no name (%s)", failures[0], failures[1]))
+	}
+	if symbol == "" {
+		symbol = name
+	}
+	if name == "" {
+		name = symbol
+	}
+
+	t := token.ERC20{
+		Address:  address,
+		Decimals: decimals,
+		Symbol:   symbol,
+		Name:     name,
+	}
+	if !t.IsValid() {
+		return token.ERC20{}, errors.New(fmt.Sprintf("%s: %s (%s) with %v decimals", InvalidToken, symbol, name, decimals))
+	}
+	return t, nil
+}
+
+// reconcileToken returns the fields of a listed token that differ from the on-chain token
+// fields that are not listed (nil decimals, empty symbol) are not compared, names are not compared since lists often shorten them
+func reconcileToken(listed token.ERC20, onChain token.ERC20) []cache.MismatchedToken {
+	mismatches := make([]cache.MismatchedToken, 0)
+	mismatch := func(field string, listedValue string, onChainValue string) {
+		mismatches = append(mismatches, cache.MismatchedToken{Address: onChain.Address, Field: field, Listed: listedValue, OnChain: onChainValue})
+	}
+
+	if listed.Decimals != nil && listed.Decimals.Cmp(onChain.Decimals) != 0 {
+		mismatch("decimals", listed.Decimals.String(), onChain.Decimals.String())
+	}
+	if listed.Symbol != "" && listed.Symbol != onChain.Symbol {
+		mismatch("symbol", listed.Symbol, onChain.Symbol)
+	}
+	return mismatches
+}
+
+// callFailure describes why a call did not succeed
+func callFailure(result generic.Result) string {
+	if result.Err != nil {
+		return result.Err.Error()
+	}
+	if len(result.ReturnData) == 0 {
+		return "reverted"
+	}
+	return fmt.Sprintf("reverted with %d bytes", len(result.ReturnData))
+}
+
+///
+/// Discovery
+///
+
+// factoryCall creates a call to a factory view function with static word arguments
+func factoryCall(factory common.Address, selector []byte, args ...[]byte) generic.Call3 {
+	data := append([]byte(nil), selector...)
+	for _, arg := range args {
+		data = append(data, common.LeftPadBytes(arg, 32)...)
+	}
+
+	return generic.Call3{
+		Target:       factory,
+		CallData:     data,
+		AllowFailure: true,
+	}
+}
+
+// decodeAddress decodes an address return value, failed calls decode to the zero address
+func decodeAddress(data []byte) common.Address {
+	if len(data) != 32 {
+		return common.Address{}
+	}
+	return common.BytesToAddress(data[12:32])
+}
+
+///
+/// Sync
+///
+
+// sortAddresses sorts pool addresses, so the sync calls do not depend on the map order of the cache
+func sortAddresses(addresses []common.Address) {
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+}
+
+// succeededCall returns true if a call was made and did not revert
+func succeededCall(result generic.Result) bool {
+	return result.Err == nil && result.Success
+}
+
+// succeeded returns the pools and states of the pools whose calls did not fail
+// failed pools are left out of the update and keep their previous state
+func succeeded[StateType any](pools []common.Address, states []StateType, failed []bool) ([]common.Address, []StateType) {
+	okPools, okStates := make([]common.Address, 0, len(pools)), make([]StateType, 0, len(states))
+	for i := range pools {
+		if !failed[i] {
+			okPools = append(okPools, pools[i])
+			okStates = append(okStates, states[i])
+		}
+	}
+	return okPools, okStates
+}
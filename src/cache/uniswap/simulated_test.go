@@ -0,0 +1,588 @@
+package uniswap_test
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/cache/uniswap"
+	poolUniswap "PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/simulated"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+// tokenAddresses returns the addresses of the tokens
+func tokenAddresses(tokens ...token.ERC20) []common.Address {
+	addresses := make([]common.Address, len(tokens))
+	for i, t := range tokens {
+		addresses[i] = t.Address
+	}
+	return addresses
+}
+
+func TestV2Cache_Simulated(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+
+	g := simulated.NewGenesis()
+	for _, tkn := range []token.ERC20{weth, usdc, bnb} {
+		g.AddToken(tkn)
+	}
+	// a bytes32 token without name() and an address without code
+	mkrLike := common.HexToAddress("0x9f8F72aA9304c8B593d555F12eF6589cC3A579A2")
+	g.Respond(mkrLike, crypto.Keccak256([]byte("decimals()"))[:4], big.NewInt(18).Bytes())
+	g.Respond(mkrLike, crypto.Keccak256([]byte("symbol()"))[:4], common.RightPadBytes([]byte("MKR"), 32))
+	noDecimals := token.ERC20{Address: common.HexToAddress("0x0000000000000000000000000000000000000d00"), Decimals: big.NewInt(0), Symbol: "ND", Name: "No Decimals"}
+	g.AddToken(noDecimals)
+	noCode := common.HexToAddress("0x0000000000000000000000000000000000000bad")
+	wethUsdc := g.AddV2Pair(f, pair.NewPair[any](weth, usdc, nil), poolUniswap.Reserves{Reserve0: big.NewInt(2_000), Reserve1: big.NewInt(1)})
+	wethBnb := g.AddV2Pair(f, pair.NewPair[any](weth, bnb, nil), poolUniswap.Reserves{Reserve0: big.NewInt(5), Reserve1: big.NewInt(20)})
+
+	chain, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	head := chain.Commit()
+	m := chain.Caller(10_000, 1_000_000)
+
+	// import the tokens from the chain and sync every pair
+	c := uniswap.NewV2Cache()
+	report, err := c.ImportTokens(context.Background(), m, append(tokenAddresses(weth, usdc, bnb, noDecimals), mkrLike, noCode, weth.Address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 5 || len(report.Skipped) != 2 || report.Skipped[0].Address != noCode || report.Skipped[1].Reason != uniswap.TokenAlreadyExists.Error() {
+		t.Errorf("wrong import report: %+v", report)
+	}
+	if tkn, err := c.Token(noDecimals.Address); err != nil || tkn.Decimals.Sign() != 0 {
+		t.Errorf("wrong token without decimals: %+v %v", tkn, err)
+	}
+	if tkn, err := c.Token(mkrLike); err != nil || tkn.Symbol != "MKR" || tkn.Name != "MKR" {
+		t.Errorf("wrong bytes32 token: %+v %v", tkn, err)
+	}
+	if tkn, err := c.Token(usdc.Address); err != nil || tkn.Symbol != "USDC" || tkn.Name != "USD Coin" || tkn.Decimals.Int64() != 6 {
+		t.Errorf("wrong token: %+v %v", tkn, err)
+	}
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(head)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reserves change in the next block
+	if err := chain.SetReserves(wethUsdc, poolUniswap.Reserves{Reserve0: big.NewInt(2_100), Reserve1: big.NewInt(1)}); err != nil {
+		t.Fatal(err)
+	}
+	next := chain.Commit()
+	if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(next)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []struct {
+		pool     common.Address
+		reserve0 int64
+		reserve1 int64
+	}{
+		{wethUsdc, 2_100, 1},
+		{wethBnb, 5, 20},
+		{create2(f.Address, f.InitHash, usdc.Address, bnb.Address, nil), 0, 0},
+	} {
+		p, err := c.Pool(expected.pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reserves, block, _ := p.State()
+		if reserves.Reserve0.Int64() != expected.reserve0 || reserves.Reserve1.Int64() != expected.reserve1 || block != next.Number.Uint64() {
+			t.Errorf("wrong state of %s: %v %v at %v", expected.pool.Hex(), reserves.Reserve0, reserves.Reserve1, block)
+		}
+	}
+}
+
+func TestV3Cache_Simulated(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.NORMAL},
+	}
+
+	state := poolUniswap.V3State{
+		Slot0: poolUniswap.Slot0{
+			SqrtPriceX96:               new(big.Int).Lsh(big.NewInt(1), 96),
+			Tick:                       big.NewInt(0),
+			ObservationIndex:           big.NewInt(0),
+			ObservationCardinality:     big.NewInt(1),
+			ObservationCardinalityNext: big.NewInt(1),
+			FeeProtocol:                big.NewInt(0),
+			Unlocked:                   true,
+		},
+		Liquidity:   big.NewInt(1_000_000),
+		TickSpacing: 60,
+		Ticks: []poolUniswap.Tick{
+			{Index: -120, LiquidityGross: big.NewInt(1_000_000), LiquidityNet: big.NewInt(1_000_000)},
+			{Index: 120, LiquidityGross: big.NewInt(1_000_000), LiquidityNet: big.NewInt(-1_000_000)},
+		},
+	}
+
+	g := simulated.NewGenesis()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		g.AddToken(tkn)
+	}
+	address := g.AddV3Pool(f, pair.NewPair(weth, usdc, poolUniswap.NORMAL), state)
+
+	chain, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	head := chain.Commit()
+	m := chain.Caller(10_000, 1_000_000)
+
+	// import listed tokens, the listed metadata differing from the chain is reported and the on-chain metadata is kept
+	c := uniswap.NewV3Cache()
+	listedUsdc := token.ERC20{Address: usdc.Address, Decimals: big.NewInt(18), Symbol: "USDC.e", Name: "Bridged USDC"}
+	report, err := c.ImportTokenList(context.Background(), m, []token.ERC20{weth, listedUsdc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || len(report.Mismatched) != 2 || report.Mismatched[0].Field != "decimals" || report.Mismatched[0].OnChain != "6" || report.Mismatched[1].Listed != "USDC.e" {
+		t.Errorf("wrong import report: %+v", report)
+	}
+	if tkn, err := c.Token(usdc.Address); err != nil || tkn.Decimals.Int64() != 6 || tkn.Symbol != "USDC" {
+		t.Errorf("wrong token: %+v %v", tkn, err)
+	}
+
+	// sync the pool with its ticks
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(head)); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := c.Pool(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced, block, _ := p.State()
+	if block != head.Number.Uint64() || synced.Liquidity.Cmp(state.Liquidity) != 0 || synced.TickSpacing != 60 || !synced.Slot0.Unlocked {
+		t.Errorf("wrong state at %v: %+v", block, synced)
+	}
+	if len(synced.Ticks) != 2 || synced.Ticks[0].Index != -120 || synced.Ticks[1].LiquidityNet.Int64() != -1_000_000 {
+		t.Errorf("wrong ticks: %+v", synced.Ticks)
+	}
+
+	// ticks removed in the next block are cleared
+	state.Ticks = state.Ticks[:1]
+	if err := chain.SetV3State(address, state); err != nil {
+		t.Fatal(err)
+	}
+	next := chain.Commit()
+	if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(next)); err != nil {
+		t.Fatal(err)
+	}
+	if synced, _, _ = p.State(); len(synced.Ticks) != 1 {
+		t.Errorf("wrong ticks after the change: %+v", synced.Ticks)
+	}
+}
+
+func TestV3Cache_RecenterTicks(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.NORMAL},
+	}
+
+	// one tick next to the price and one 3 bitmap words above it
+	far := 3 * 256 * 60
+	state := poolUniswap.V3State{
+		Slot0: poolUniswap.Slot0{
+			SqrtPriceX96:               new(big.Int).Lsh(big.NewInt(1), 96),
+			Tick:                       big.NewInt(0),
+			ObservationIndex:           big.NewInt(0),
+			ObservationCardinality:     big.NewInt(1),
+			ObservationCardinalityNext: big.NewInt(1),
+			FeeProtocol:                big.NewInt(0),
+			Unlocked:                   true,
+		},
+		Liquidity:   big.NewInt(1_000_000),
+		TickSpacing: 60,
+		Ticks: []poolUniswap.Tick{
+			{Index: -120, LiquidityGross: big.NewInt(1_000_000), LiquidityNet: big.NewInt(1_000_000)},
+			{Index: far, LiquidityGross: big.NewInt(1_000_000), LiquidityNet: big.NewInt(-1_000_000)},
+		},
+	}
+
+	g := simulated.NewGenesis()
+	g.AddToken(weth)
+	g.AddToken(usdc)
+	address := g.AddV3Pool(f, pair.NewPair(weth, usdc, poolUniswap.NORMAL), state)
+
+	chain, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	head := chain.Commit()
+	m := chain.Caller(10_000, 1_000_000)
+
+	c := uniswap.NewV3Cache()
+	c.SetTickWordRadius(1)
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(head)); err != nil {
+		t.Fatal(err)
+	}
+	if recentred, err := c.RecenterTicks(context.Background(), m); err != nil || recentred != 0 {
+		t.Fatalf("centred pool re-synced: %v %v", recentred, err)
+	}
+
+	// a swap moves the price past the synced words
+	sqrtPrice, err := poolUniswap.GetSqrtRatioAtTick(far + 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap := types.Log{Address: address, Topics: []common.Hash{c.LogTopics()[0]}, Data: make([]byte, 32*5)}
+	copy(swap.Data[64:96], common.LeftPadBytes(sqrtPrice.Bytes(), 32))
+	copy(swap.Data[96:128], common.LeftPadBytes(big.NewInt(1_000).Bytes(), 32))
+	copy(swap.Data[128:160], common.LeftPadBytes(big.NewInt(int64(far+60)).Bytes(), 32))
+	next := chain.Commit()
+	swap.BlockNumber = next.Number.Uint64()
+	if err := c.ApplyLogs([]types.Log{swap}, cache.HeaderBlock(next)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the words are re-centred on the new tick at the last synced block
+	if recentred, err := c.RecenterTicks(context.Background(), m); err != nil || recentred != 1 {
+		t.Fatalf("pool not re-synced: %v %v", recentred, err)
+	}
+	p, err := c.Pool(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced, block, _ := p.State()
+	if synced.MinWord != 2 || synced.MaxWord != 4 || block != next.Number.Uint64() || synced.Liquidity.Int64() != 1_000 {
+		t.Errorf("wrong re-centred state at %v: %v-%v %v", block, synced.MinWord, synced.MaxWord, synced.Liquidity)
+	}
+	if len(synced.Ticks) != 1 || synced.Ticks[0].Index != far {
+		t.Errorf("wrong re-centred ticks: %+v", synced.Ticks)
+	}
+}
+
+func TestV3Cache_ApplyLogs_Initialize(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.NORMAL},
+	}
+
+	// a deployed pool that is not initialized yet only answers its tick spacing
+	g := simulated.NewGenesis()
+	g.AddToken(weth)
+	g.AddToken(usdc)
+	address := g.AddV3Pool(f, pair.NewPair(weth, usdc, poolUniswap.NORMAL), poolUniswap.V3State{TickSpacing: 60})
+
+	chain, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	head := chain.Commit()
+	m := chain.Caller(10_000, 1_000_000)
+
+	c := uniswap.NewV3Cache()
+	c.SetTickWordRadius(1)
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(head)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pool is initialized at tick -100 and a position is minted around it in the next block
+	sqrtPrice, err := poolUniswap.GetSqrtRatioAtTick(-100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := chain.Commit()
+	initialize := types.Log{Address: address, Topics: []common.Hash{c.LogTopics()[3]}, Data: make([]byte, 32*2), BlockNumber: next.Number.Uint64()}
+	copy(initialize.Data[0:32], common.LeftPadBytes(sqrtPrice.Bytes(), 32))
+	copy(initialize.Data[32:64], common.BigToHash(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(100))).Bytes())
+	mint := types.Log{
+		Address:     address,
+		Topics:      []common.Hash{c.LogTopics()[1], {}, common.BigToHash(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(120))), common.BigToHash(big.NewInt(60))},
+		Data:        make([]byte, 32*4),
+		BlockNumber: next.Number.Uint64(),
+	}
+	copy(mint.Data[32:64], common.LeftPadBytes(big.NewInt(1_000).Bytes(), 32))
+	if err := c.ApplyLogs([]types.Log{initialize, mint}, cache.HeaderBlock(next)); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := c.Pool(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, block, _ := p.State()
+	if block != next.Number.Uint64() || state.Slot0.Tick.Int64() != -100 || state.Slot0.SqrtPriceX96.Cmp(sqrtPrice) != 0 || state.TickSpacing != 60 {
+		t.Fatalf("pool not initialized at %v: %+v", block, state.Slot0)
+	}
+	if state.Liquidity.Int64() != 1_000 || len(state.Ticks) != 2 || state.MinWord != -2 || state.MaxWord != 0 {
+		t.Errorf("wrong state after the mint: %v %+v %v-%v", state.Liquidity, state.Ticks, state.MinWord, state.MaxWord)
+	}
+
+	// the initialized pool quotes
+	if _, err := p.AmountOut(weth.Address, big.NewInt(10)); err != nil {
+		t.Errorf("initialized pool does not quote: %v", err)
+	}
+}
+
+func TestV2Cache_SyncLogs_Simulated(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+
+	g := simulated.NewGenesis()
+	g.AddToken(weth)
+	g.AddToken(usdc)
+	address := g.AddV2Pair(f, pair.NewPair[any](weth, usdc, nil), poolUniswap.Reserves{Reserve0: big.NewInt(2_000), Reserve1: big.NewInt(1)})
+
+	chain, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	head := chain.Commit()
+
+	c := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.InitializePools(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncAll(context.Background(), chain.Caller(10_000, 1_000_000), cache.HeaderBlock(head)); err != nil {
+		t.Fatal(err)
+	}
+	reserves := func() (int64, int64, uint64) {
+		p, err := c.Pool(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, block, _ := p.State()
+		return r.Reserve0.Int64(), r.Reserve1.Int64(), block
+	}
+
+	// the Sync log of the pair is applied
+	if err := chain.SetReserves(address, poolUniswap.Reserves{Reserve0: big.NewInt(2_100), Reserve1: big.NewInt(1)}); err != nil {
+		t.Fatal(err)
+	}
+	next := chain.Commit()
+	if err := cache.SyncLogs(context.Background(), chain.Backend, head.Number.Uint64()+1, cache.HeaderBlock(next), c); err != nil {
+		t.Fatal(err)
+	}
+	if r0, r1, block := reserves(); r0 != 2_100 || r1 != 1 || block != next.Number.Uint64() {
+		t.Errorf("wrong reserves after the log: %v %v at %v", r0, r1, block)
+	}
+
+	// a longer side chain from the head replaces the block
+	if err := chain.Fork(head.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.SetReserves(address, poolUniswap.Reserves{Reserve0: big.NewInt(1_900), Reserve1: big.NewInt(2)}); err != nil {
+		t.Fatal(err)
+	}
+	forked := chain.Commit()
+	forkHead := chain.Commit()
+
+	reorg, err := cache.HandleReorg(context.Background(), chain.Backend, cache.HeaderBlock(forkHead), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reorg == nil || reorg.Ancestor.Hash != head.Hash() || len(reorg.Dropped) != 1 || reorg.Dropped[0].Hash != next.Hash() {
+		t.Fatalf("wrong reorg: %+v", reorg)
+	}
+	if r0, _, _ := reserves(); r0 != 2_000 {
+		t.Errorf("wrong reserves after the rollback: %v", r0)
+	}
+	if err := cache.SyncLogs(context.Background(), chain.Backend, reorg.Ancestor.Number+1, cache.HeaderBlock(forkHead), c); err != nil {
+		t.Fatal(err)
+	}
+	if r0, r1, block := reserves(); r0 != 1_900 || r1 != 2 || block != forked.Number.Uint64() || c.Head().Hash != forkHead.Hash() {
+		t.Errorf("wrong reserves on the side chain: %v %v at %v", r0, r1, block)
+	}
+}
+
+func TestV3Cache_SyncLogs_Simulated(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.NORMAL},
+	}
+
+	// a state at a tick, with a position on [-120, 120] and optionally one on [-60, 180]
+	state := func(tick int, position bool) poolUniswap.V3State {
+		sqrtPrice, err := poolUniswap.GetSqrtRatioAtTick(tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := poolUniswap.V3State{
+			Slot0: poolUniswap.Slot0{
+				SqrtPriceX96:               sqrtPrice,
+				Tick:                       big.NewInt(int64(tick)),
+				ObservationIndex:           big.NewInt(0),
+				ObservationCardinality:     big.NewInt(1),
+				ObservationCardinalityNext: big.NewInt(1),
+				FeeProtocol:                big.NewInt(0),
+				Unlocked:                   true,
+			},
+			Liquidity:   big.NewInt(1_000_000),
+			TickSpacing: 60,
+			Ticks: []poolUniswap.Tick{
+				{Index: -120, LiquidityGross: big.NewInt(1_000_000), LiquidityNet: big.NewInt(1_000_000)},
+				{Index: 120, LiquidityGross: big.NewInt(1_000_000), LiquidityNet: big.NewInt(-1_000_000)},
+			},
+		}
+		if position {
+			s.Liquidity = big.NewInt(1_000_500)
+			s.Ticks = []poolUniswap.Tick{
+				s.Ticks[0],
+				{Index: -60, LiquidityGross: big.NewInt(500), LiquidityNet: big.NewInt(500)},
+				s.Ticks[1],
+				{Index: 180, LiquidityGross: big.NewInt(500), LiquidityNet: big.NewInt(-500)},
+			}
+		}
+		return s
+	}
+	position := simulated.Position{Owner: common.HexToAddress("0x01"), TickLower: -60, TickUpper: 180, Amount: big.NewInt(500), Amount0: big.NewInt(1), Amount1: big.NewInt(1)}
+
+	g := simulated.NewGenesis()
+	g.AddToken(weth)
+	g.AddToken(usdc)
+	address := g.AddV3Pool(f, pair.NewPair(weth, usdc, poolUniswap.NORMAL), state(0, false))
+
+	chain, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	head := chain.Commit()
+	m := chain.Caller(10_000, 1_000_000)
+
+	newCache := func(block *types.Header) *uniswap.V3Cache {
+		c := uniswap.NewV3Cache()
+		for _, tkn := range []token.ERC20{weth, usdc} {
+			if err := c.AddToken(tkn); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.InitializePools(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SyncAll(context.Background(), m, cache.HeaderBlock(block)); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	// the state built from the logs matches a full sync of the block, the state block is the block of its last log
+	check := func(c *uniswap.V3Cache, block *types.Header, logBlock *types.Header) {
+		t.Helper()
+		p, err := c.Pool(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := newCache(block).Pool(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, stateBlock, _ := p.State()
+		e, _, _ := expected.State()
+		if stateBlock != logBlock.Number.Uint64() || c.Head().Hash != block.Hash() || s.Slot0.SqrtPriceX96.Cmp(e.Slot0.SqrtPriceX96) != 0 || s.Slot0.Tick.Cmp(e.Slot0.Tick) != 0 || s.Liquidity.Cmp(e.Liquidity) != 0 {
+			t.Errorf("wrong state at %v: %v %v %v, expected %v %v %v", stateBlock, s.Slot0.SqrtPriceX96, s.Slot0.Tick, s.Liquidity, e.Slot0.SqrtPriceX96, e.Slot0.Tick, e.Liquidity)
+		}
+		if len(s.Ticks) != len(e.Ticks) {
+			t.Fatalf("wrong ticks at %v: %+v, expected %+v", stateBlock, s.Ticks, e.Ticks)
+		}
+		for i := range s.Ticks {
+			if s.Ticks[i].Index != e.Ticks[i].Index || s.Ticks[i].LiquidityGross.Cmp(e.Ticks[i].LiquidityGross) != 0 || s.Ticks[i].LiquidityNet.Cmp(e.Ticks[i].LiquidityNet) != 0 {
+				t.Errorf("wrong tick at %v: %+v, expected %+v", stateBlock, s.Ticks[i], e.Ticks[i])
+			}
+		}
+	}
+	c := newCache(head)
+
+	// a swap to tick 60 and a mint around it in the next block
+	if err := chain.SwapV3(address, state(60, false), big.NewInt(-100), big.NewInt(200)); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.MintV3(address, state(60, true), position); err != nil {
+		t.Fatal(err)
+	}
+	minted := chain.Commit()
+	if err := cache.SyncLogs(context.Background(), chain.Backend, head.Number.Uint64()+1, cache.HeaderBlock(minted), c); err != nil {
+		t.Fatal(err)
+	}
+	check(c, minted, minted)
+
+	// the position is burnt
+	if err := chain.BurnV3(address, state(60, false), position); err != nil {
+		t.Fatal(err)
+	}
+	burnt := chain.Commit()
+	if err := cache.SyncLogs(context.Background(), chain.Backend, minted.Number.Uint64()+1, cache.HeaderBlock(burnt), c); err != nil {
+		t.Fatal(err)
+	}
+	check(c, burnt, burnt)
+
+	// a longer side chain swaps back instead of burning
+	if err := chain.Fork(minted.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.SwapV3(address, state(-60, true), big.NewInt(300), big.NewInt(-150)); err != nil {
+		t.Fatal(err)
+	}
+	swapped := chain.Commit()
+	forkHead := chain.Commit()
+
+	reorg, err := cache.HandleReorg(context.Background(), chain.Backend, cache.HeaderBlock(forkHead), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reorg == nil || reorg.Ancestor.Hash != minted.Hash() || len(reorg.Dropped) != 1 || reorg.Dropped[0].Hash != burnt.Hash() {
+		t.Fatalf("wrong reorg: %+v", reorg)
+	}
+	if err := cache.SyncLogs(context.Background(), chain.Backend, reorg.Ancestor.Number+1, cache.HeaderBlock(forkHead), c); err != nil {
+		t.Fatal(err)
+	}
+	check(c, forkHead, swapped)
+}
@@ -0,0 +1,188 @@
+package uniswap_test
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/cache/uniswap"
+	poolUniswap "PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestV2Cache_Snapshot(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, nil, poolAddr)
+
+	c := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// sync the pool to block 100
+	p, err := c.Pool(poolAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Update(poolUniswap.Reserves{Reserve0: big.NewInt(2_000_000_000_000), Reserve1: big.NewInt(1e18)}, 100)
+	blockHash := common.HexToHash("0x01")
+	if err := c.ApplyLogs(nil, cache.Block{Number: 100, Hash: blockHash}); err != nil {
+		t.Fatal(err)
+	}
+
+	// save & load the snapshot
+	s, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := cache.SaveSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := cache.LoadSnapshot[poolUniswap.Reserves, any](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Block != 100 || loaded.BlockHash != blockHash {
+		t.Errorf("wrong snapshot block: %v %s", loaded.Block, loaded.BlockHash.Hex())
+	}
+
+	// restore into a new cache
+	restored := uniswap.NewV2Cache()
+	if err := restored.Restore(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if restored.LastSynced() != 100 {
+		t.Errorf("wrong last synced block: %v", restored.LastSynced())
+	}
+
+	rp, err := restored.Pool(poolAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, block, _ := rp.State()
+	wantState, _, _ := p.State()
+	if block != 100 || !reflect.DeepEqual(state, wantState) {
+		t.Errorf("wrong restored state: %v %v", state, block)
+	}
+
+	// the restored pool quotes like the original pool
+	want, _ := p.AmountOut(weth.Address, big.NewInt(1e15))
+	got, err := rp.AmountOut(weth.Address, big.NewInt(1e15))
+	if err != nil || got.Cmp(want) != 0 {
+		t.Errorf("wrong restored quote: %v (expected %v): %v", got, want, err)
+	}
+}
+
+func TestV3Cache_Snapshot(t *testing.T) {
+	f := factory.Factory[poolUniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []poolUniswap.V3FeeType{poolUniswap.LOW},
+	}
+	low := big.NewInt(int64(poolUniswap.LOW)).Bytes()
+	poolAddr := create2(f.Address, f.InitHash, weth.Address, usdc.Address, low)
+
+	m := factoryMulticall{pools: make(map[string]common.Address)}
+	m.deploy(weth.Address, usdc.Address, low, poolAddr)
+
+	c := uniswap.NewV3Cache()
+	for _, tkn := range []token.ERC20{weth, usdc} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), m, f, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// sync the pool to block 100
+	p, err := c.Pool(poolAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqrtPrice, _ := new(big.Int).SetString("1350174849792634181862360983626536", 10)
+	p.Update(poolUniswap.V3State{
+		Slot0: poolUniswap.Slot0{
+			SqrtPriceX96:               sqrtPrice,
+			Tick:                       big.NewInt(195285),
+			ObservationIndex:           big.NewInt(1),
+			ObservationCardinality:     big.NewInt(723),
+			ObservationCardinalityNext: big.NewInt(723),
+			FeeProtocol:                big.NewInt(0),
+			Unlocked:                   true,
+		},
+		Liquidity:   big.NewInt(1e18),
+		TickSpacing: 10,
+		Ticks: []poolUniswap.Tick{
+			{Index: 195000, LiquidityGross: big.NewInt(1e18), LiquidityNet: big.NewInt(1e18)},
+			{Index: 195600, LiquidityGross: big.NewInt(1e18), LiquidityNet: big.NewInt(-1e18)},
+		},
+		MinWord: 74,
+		MaxWord: 78,
+	}, 100)
+	if err := c.ApplyLogs(nil, cache.Block{Number: 100, Hash: common.HexToHash("0x01")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// save, load & restore the snapshot
+	s, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := cache.SaveSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := cache.LoadSnapshot[poolUniswap.V3State, poolUniswap.V3FeeType](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := uniswap.NewV3Cache()
+	if err := restored.Restore(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := restored.Pool(poolAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, block, _ := rp.State()
+	wantState, _, _ := p.State()
+	if block != 100 || !reflect.DeepEqual(state, wantState) {
+		t.Errorf("wrong restored state: %+v %v", state, block)
+	}
+	if rp.Pair().PairOptions != poolUniswap.LOW {
+		t.Errorf("wrong restored fee: %v", rp.Pair().PairOptions)
+	}
+}
+
+func TestLoadSnapshot_Version(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"version":0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.LoadSnapshot[poolUniswap.Reserves, any](path); err != cache.InvalidSnapshotVersion {
+		t.Errorf("expected invalid snapshot version, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package uniswap_test
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/cache/uniswap"
+	"PoolHelper/src/multicall/generic"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+// reservesMulticall answers getReserves calls with fixed reserves, calls to the failing pools fail
+type reservesMulticall struct {
+	reserve int64
+	failing map[common.Address]bool
+}
+
+func (m reservesMulticall) Aggregate(_ context.Context, calls []generic.Call3, block uint64) ([]generic.Result, error) {
+	results := make([]generic.Result, len(calls))
+	for i, call := range calls {
+		if m.failing[call.Target] {
+			results[i] = generic.Result{Block: block, Err: errors.New("call failed")}
+			continue
+		}
+
+		reserve := common.LeftPadBytes(big.NewInt(m.reserve).Bytes(), 32)
+		data := append(append(append([]byte(nil), reserve...), reserve...), make([]byte, 32)...)
+		results[i] = generic.Result{Block: block, Success: true, ReturnData: data}
+	}
+	return results, nil
+}
+
+func TestV2Cache_SyncFailedPool(t *testing.T) {
+	f := factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+	okPool := create2(f.Address, f.InitHash, weth.Address, usdc.Address, nil)
+	failingPool := create2(f.Address, f.InitHash, steth.Address, bnb.Address, nil)
+
+	fm := factoryMulticall{pools: make(map[string]common.Address)}
+	fm.deploy(weth.Address, usdc.Address, nil, okPool)
+	fm.deploy(steth.Address, bnb.Address, nil, failingPool)
+
+	c := uniswap.NewV2Cache()
+	for _, tkn := range []token.ERC20{weth, usdc, bnb, steth} {
+		if err := c.AddToken(tkn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DiscoverPools(context.Background(), fm, f, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// sync both pools at block 10, the failing pool at block 11
+	if err := c.SyncAll(context.Background(), reservesMulticall{reserve: 1}, cache.Block{Number: 10}); err != nil {
+		t.Fatal(err)
+	}
+	m := reservesMulticall{reserve: 2, failing: map[common.Address]bool{failingPool: true}}
+	if err := c.SyncAll(context.Background(), m, cache.Block{Number: 11}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failing pool keeps its previous state
+	for _, expected := range []struct {
+		pool    common.Address
+		reserve int64
+		block   uint64
+	}{
+		{okPool, 2, 11},
+		{failingPool, 1, 10},
+	} {
+		p, err := c.Pool(expected.pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reserves, block, _ := p.State(); reserves.Reserve0.Int64() != expected.reserve || block != expected.block {
+			t.Errorf("wrong state of %s: %v at %v", expected.pool.Hex(), reserves.Reserve0, block)
+		}
+	}
+	if c.LastSynced() != 11 {
+		t.Errorf("wrong last synced block: %v", c.LastSynced())
+	}
+}
@@ -1,6 +1,7 @@
 package uniswap
 
 import (
+	"PoolHelper/src/cache"
 	"PoolHelper/src/multicall/generic"
 	"PoolHelper/src/pool"
 	"PoolHelper/src/pool/uniswap"
@@ -12,19 +13,24 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"math/big"
-	"strings"
 	"sync"
-	"unicode"
 )
 
 type V2Cache struct {
 	tokens    map[common.Address]token.ERC20
 	pools     map[common.Address]pool.Pool[uniswap.Reserves, any]
 	factories map[common.Address]factory.Factory[any]
-	lastSync  uint64
+	history   *cache.History[uniswap.Reserves]
 	m         sync.RWMutex
+
+	// discovered are the factories whose pools are discovered on chain, tokens added later get no blind pools of them
+	discovered map[common.Address]bool
+
+	// poolHistorySize is the number of synced states kept by each pool
+	poolHistorySize int
 }
 
 func NewV2Cache() *V2Cache {
@@ -33,7 +39,10 @@ func NewV2Cache() *V2Cache {
 		pools:     make(map[common.Address]pool.Pool[uniswap.Reserves, any]),
 		factories: make(map[common.Address]factory.Factory[any]),
 		m:         sync.RWMutex{},
-		lastSync:  0,
+		history:   cache.NewHistory[uniswap.Reserves](cache.DefaultHistoryDepth),
+
+		discovered:      make(map[common.Address]bool),
+		poolHistorySize: pool.DefaultHistorySize,
 	}
 }
 
@@ -41,16 +50,24 @@ func NewV2Cache() *V2Cache {
 /// Token Cache
 ///
 
-func (c *V2Cache) ImportTokens(ctx context.Context, m generic.Multicall, tokens []common.Address) error {
+func (c *V2Cache) ImportTokens(ctx context.Context, m generic.Multicall, tokens []common.Address) (cache.ImportReport, error) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
 	// import tokens
-	if err := c.importTokens(ctx, m, tokens); err != nil {
-		return err
+	listed := make([]token.ERC20, len(tokens))
+	for i, address := range tokens {
+		listed[i] = token.ERC20{Address: address}
 	}
+	return c.importTokens(ctx, m, listed)
+}
 
-	return nil
+func (c *V2Cache) ImportTokenList(ctx context.Context, m generic.Multicall, tokens []token.ERC20) (cache.ImportReport, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// import tokens and reconcile their listed metadata
+	return c.importTokens(ctx, m, tokens)
 }
 
 func (c *V2Cache) AddToken(t token.ERC20) error {
@@ -135,6 +152,75 @@ func (c *V2Cache) InitializePools(factory factory.Factory[any]) error {
 	return nil
 }
 
+// DiscoverPools adds the pools of the factory that are deployed on chain
+// every unordered token pair is looked up with the factory getPair function instead of assuming it exists
+func (c *V2Cache) DiscoverPools(ctx context.Context, m generic.Multicall, factory factory.Factory[any], block uint64) (cache.DiscoveryReport, error) {
+	report := cache.DiscoveryReport{}
+
+	// validate factory
+	if ok := factory.IsValid(); !ok {
+		return report, InvalidFactory
+	}
+
+	// collect candidates, the lookup runs without holding the lock
+	c.m.RLock()
+	candidates := c.candidates()
+	c.m.RUnlock()
+
+	// prepare calls
+	selector := crypto.Keccak256([]byte("getPair(address,address)"))[:4]
+	calls := make([]generic.Call3, len(candidates))
+	for i, candidate := range candidates {
+		calls[i] = factoryCall(factory.Address, selector, candidate.TokenA.Address.Bytes(), candidate.TokenB.Address.Bytes())
+	}
+	report.Candidates = len(candidates)
+
+	// call the factory
+	results, err := m.Aggregate(ctx, calls, block)
+	if err != nil {
+		return report, err
+	}
+
+	// check if results are valid
+	if len(results) != len(candidates) {
+		return report, errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// pools of tokens added later are left to the next discovery
+	c.discovered[factory.Address] = true
+
+	// add deployed pools
+	for i, result := range results {
+		if result.Err != nil {
+			report.Failed++
+			continue
+		}
+
+		// reverted lookups carry revert data instead of an address
+		deployed := decodeAddress(result.ReturnData)
+		if !result.Success || deployed == (common.Address{}) {
+			report.Skipped++
+			continue
+		}
+
+		// the factory pool must match the cached pool address
+		if p := uniswap.NewV2Pool(factory.Address, factory.InitHash, factory.SwapFee, candidates[i]); p.Address() != deployed {
+			report.Mismatched++
+			continue
+		}
+
+		if err := c.addPool(factory, candidates[i], false); err != nil {
+			return report, err
+		}
+		report.Deployed++
+	}
+
+	return report, nil
+}
+
 func (c *V2Cache) RemovePool(address common.Address) error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -181,12 +267,14 @@ func (c *V2Cache) Pools() []pool.Pool[uniswap.Reserves, any] {
 /// Reserve Cache
 ///
 
-func (c *V2Cache) SyncAll(ctx context.Context, m generic.Multicall, block uint64) error {
-	c.m.Lock()
-	defer c.m.Unlock()
+// SyncAll syncs every cached pool at the given block
+// the multicall runs without holding the cache lock, so readers are not blocked while syncing
+func (c *V2Cache) SyncAll(ctx context.Context, m generic.Multicall, block cache.Block) error {
+	c.m.RLock()
 
 	// check if block has already been synced
-	if c.lastSync >= block {
+	if c.history.Head().Number >= block.Number {
+		c.m.RUnlock()
 		return BlockAlreadySynced
 	}
 
@@ -195,46 +283,277 @@ func (c *V2Cache) SyncAll(ctx context.Context, m generic.Multicall, block uint64
 	for _, p := range c.pools {
 		allPools = append(allPools, p.Address())
 	}
+	sortAddresses(allPools)
+	c.m.RUnlock()
 
 	// sync reserves
-	if err := c.sync(ctx, m, allPools, block); err != nil {
+	synced, reserves, err := c.sync(ctx, m, allPools, block.Number)
+	if err != nil {
 		return err
 	}
 
-	c.lastSync = block
-	return nil
-}
-
-func (c *V2Cache) Sync(ctx context.Context, m generic.Multicall, pools []common.Address, block uint64) error {
 	c.m.Lock()
 	defer c.m.Unlock()
 
+	return c.update(synced, reserves, block)
+}
+
+// Sync syncs a list of cached pools at the given block
+// the multicall runs without holding the cache lock, so readers are not blocked while syncing
+func (c *V2Cache) Sync(ctx context.Context, m generic.Multicall, pools []common.Address, block cache.Block) error {
+	c.m.RLock()
+
 	// check if block has already been synced
-	if c.lastSync >= block {
+	if c.history.Head().Number >= block.Number {
+		c.m.RUnlock()
 		return BlockAlreadySynced
 	}
 
 	// check if pools are valid
 	for _, p := range pools {
 		if _, ok := c.pools[p]; !ok {
+			c.m.RUnlock()
 			return PoolNotFound
 		}
 	}
+	c.m.RUnlock()
 
 	// sync reserves
-	if err := c.sync(ctx, m, pools, block); err != nil {
+	synced, reserves, err := c.sync(ctx, m, pools, block.Number)
+	if err != nil {
 		return err
 	}
 
-	c.lastSync = block
-	return nil
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.update(synced, reserves, block)
 }
 
 func (c *V2Cache) LastSynced() uint64 {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
-	return c.lastSync
+	return c.history.Head().Number
+}
+
+///
+/// History Cache
+///
+
+// SetHistoryDepth sets the number of synced blocks the cache can roll back
+func (c *V2Cache) SetHistoryDepth(depth int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.history.SetDepth(depth)
+}
+
+// SetPoolHistorySize sets the number of synced states kept by each pool
+func (c *V2Cache) SetPoolHistorySize(size int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.poolHistorySize = max(size, 0)
+	for _, p := range c.pools {
+		p.SetHistorySize(c.poolHistorySize)
+	}
+}
+
+// Head returns the last synced block
+func (c *V2Cache) Head() cache.Block {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.history.Head()
+}
+
+// History returns the blocks the cache can be rolled back to, oldest first
+func (c *V2Cache) History() []cache.Block {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.history.Blocks()
+}
+
+// Rollback restores the pool states of a block of the history, e.g. the common ancestor of a reorg
+// pools removed since the block are skipped
+func (c *V2Cache) Rollback(block cache.Block) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	states, err := c.history.Rollback(block)
+	if err != nil {
+		return err
+	}
+
+	for poolAddr, state := range states {
+		if p, ok := c.pools[poolAddr]; ok {
+			p.Update(state.State, state.Block)
+		}
+	}
+	return nil
+}
+
+///
+/// Log Cache
+///
+
+// syncTopic is the topic of the UniswapV2Pair Sync event
+var syncTopic = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+
+func (c *V2Cache) LogTopics() []common.Hash {
+	return []common.Hash{syncTopic}
+}
+
+// ValidateLogs checks the logs of a block without applying them, ApplyLogs fails with the same error
+func (c *V2Cache) ValidateLogs(logs []types.Log, block cache.Block) error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.validateLogs(logs, block)
+}
+
+// ApplyLogs updates the reserves of the cached pools from their Sync logs
+// block is the last block covered by the logs, logs of already synced blocks are skipped
+func (c *V2Cache) ApplyLogs(logs []types.Log, block cache.Block) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// validate every log before applying any, a malformed log leaves the cache unchanged
+	if err := c.validateLogs(logs, block); err != nil {
+		return err
+	}
+	head := c.history.Head()
+
+	// keep the states of the pools before their first log for rollbacks
+	previous := make(map[common.Address]cache.PoolState[uniswap.Reserves])
+	for _, l := range logs {
+		p, ok := c.logPool(l, head)
+		if !ok {
+			continue
+		}
+
+		if _, ok := previous[l.Address]; !ok {
+			state, stateBlock, _ := p.State()
+			previous[l.Address] = cache.PoolState[uniswap.Reserves]{State: state, Block: stateBlock}
+		}
+
+		// the last Sync log of the pool holds its reserves
+		p.Update(uniswap.Reserves{
+			Reserve0: new(big.Int).SetBytes(l.Data[0:32]),
+			Reserve1: new(big.Int).SetBytes(l.Data[32:64]),
+		}, l.BlockNumber)
+	}
+
+	c.history.Push(block, previous)
+	return nil
+}
+
+///
+/// Snapshot Cache
+///
+
+// Snapshot returns the tokens, factories and pool states of the cache at its last synced block
+// the snapshot is tagged with the hash of the last synced block, used to detect reorgs when restoring
+func (c *V2Cache) Snapshot() (cache.Snapshot[uniswap.Reserves, any], error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	s := cache.Snapshot[uniswap.Reserves, any]{
+		Version:   cache.SnapshotVersion,
+		Block:     c.history.Head().Number,
+		BlockHash: c.history.Head().Hash,
+		Tokens:    make([]token.ERC20, 0, len(c.tokens)),
+		Factories: make([]factory.Factory[any], 0, len(c.factories)),
+		Pools:     make([]cache.PoolSnapshot[uniswap.Reserves, any], 0, len(c.pools)),
+	}
+	for _, t := range c.tokens {
+		s.Tokens = append(s.Tokens, t)
+	}
+	for _, f := range c.factories {
+		s.Factories = append(s.Factories, f)
+	}
+	for _, p := range c.pools {
+		state, block, _ := p.State()
+		poolPair := p.Pair()
+		s.Pools = append(s.Pools, cache.PoolSnapshot[uniswap.Reserves, any]{
+			Address: p.Address(),
+			Factory: p.Factory(),
+			TokenA:  poolPair.TokenA.Address,
+			TokenB:  poolPair.TokenB.Address,
+			Options: poolPair.PairOptions,
+			State:   state,
+			Block:   block,
+		})
+	}
+
+	return s, nil
+}
+
+// Restore replaces the content of the cache with a snapshot
+// the cache is left unchanged if the snapshot is inconsistent
+func (c *V2Cache) Restore(s cache.Snapshot[uniswap.Reserves, any]) error {
+	// check the snapshot format
+	if s.Version != cache.SnapshotVersion {
+		return cache.InvalidSnapshotVersion
+	}
+
+	tokens := make(map[common.Address]token.ERC20, len(s.Tokens))
+	for _, t := range s.Tokens {
+		if ok := t.IsValid(); !ok {
+			return InvalidToken
+		}
+		tokens[t.Address] = t
+	}
+	factories := make(map[common.Address]factory.Factory[any], len(s.Factories))
+	for _, f := range s.Factories {
+		if ok := f.IsValid(); !ok {
+			return InvalidFactory
+		}
+		factories[f.Address] = f
+	}
+
+	c.m.RLock()
+	historySize := c.poolHistorySize
+	c.m.RUnlock()
+
+	// recreate pools from their tokens & factory
+	pools := make(map[common.Address]pool.Pool[uniswap.Reserves, any], len(s.Pools))
+	for _, ps := range s.Pools {
+		f, ok := factories[ps.Factory]
+		if !ok {
+			return errors.New(fmt.Sprintf("snapshot pool factory not found: %s (%s)", ps.Factory.Hex(), ps.Address.Hex()))
+		}
+		tokenA, okA := tokens[ps.TokenA]
+		tokenB, okB := tokens[ps.TokenB]
+		if !okA || !okB {
+			return errors.New(fmt.Sprintf("snapshot pool token not found: %s", ps.Address.Hex()))
+		}
+
+		p := uniswap.NewV2Pool(f.Address, f.InitHash, f.SwapFee, pair.NewPair[any](tokenA, tokenB, ps.Options))
+		if p.Address() != ps.Address {
+			return errors.New(fmt.Sprintf("snapshot pool address mismatch: %s (expected %s)", p.Address().Hex(), ps.Address.Hex()))
+		}
+		p.SetHistorySize(historySize)
+		p.Update(ps.State, ps.Block)
+		pools[ps.Address] = p
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.tokens = tokens
+	c.factories = factories
+	c.pools = pools
+
+	// snapshot pools are the discovered ones
+	c.discovered = make(map[common.Address]bool, len(factories))
+	for address := range factories {
+		c.discovered[address] = true
+	}
+	c.history.Reset(cache.Block{Number: s.Block, Hash: s.BlockHash})
+	return nil
 }
 
 ///
@@ -243,15 +562,18 @@ func (c *V2Cache) LastSynced() uint64 {
 
 // addToken adds a token to the cache
 // overwrites existing token if it already exists in cache
-// overwrites new pools to cache with existing tokens and factories
+// overwrites new pools to cache with existing tokens and factories that were not discovered
 func (c *V2Cache) addToken(t token.ERC20) error {
 	// check if token already exists in cache
 	if _, ok := c.tokens[t.Address]; ok {
 		return TokenAlreadyExists
 	}
 
-	// iterate through factories
+	// iterate through factories, the pools of discovered factories are only added once deployed
 	for _, f := range c.factories {
+		if c.discovered[f.Address] {
+			continue
+		}
 		// iterate through tokens
 		for _, pairToken := range c.tokens {
 			newPair := pair.NewPair[any](pairToken, t, nil)
@@ -287,8 +609,9 @@ func (c *V2Cache) removeToken(address common.Address) error {
 // addPool adds a pool to the cache
 func (c *V2Cache) addPool(f factory.Factory[any], pair pair.Pair[any], overwrite bool) error {
 	// create pool & try to add to cache if it doesn't exist
-	p := uniswap.NewV2Pool(f.Address, f.InitHash, pair)
+	p := uniswap.NewV2Pool(f.Address, f.InitHash, f.SwapFee, pair)
 	if _, ok := c.pools[p.Address()]; !ok || overwrite {
+		p.SetHistorySize(c.poolHistorySize)
 		c.pools[p.Address()] = p
 
 		// add factory to cache if it doesn't exist
@@ -300,6 +623,31 @@ func (c *V2Cache) addPool(f factory.Factory[any], pair pair.Pair[any], overwrite
 	return nil
 }
 
+// logPool returns the pool a log is applied to
+// only the Sync logs of cached pools after the last synced block are applied
+func (c *V2Cache) logPool(l types.Log, head cache.Block) (pool.Pool[uniswap.Reserves, any], bool) {
+	p, ok := c.pools[l.Address]
+	if !ok || l.Removed || l.BlockNumber <= head.Number || len(l.Topics) == 0 || l.Topics[0] != syncTopic {
+		return nil, false
+	}
+	return p, true
+}
+
+// validateLogs checks that the block has not been synced and that the applied logs are well formed
+func (c *V2Cache) validateLogs(logs []types.Log, block cache.Block) error {
+	head := c.history.Head()
+	if head.Number >= block.Number {
+		return BlockAlreadySynced
+	}
+
+	for _, l := range logs {
+		if _, ok := c.logPool(l, head); ok && len(l.Data) != 64 {
+			return errors.New(fmt.Sprintf("wrong sync log data length: %v (%s)", len(l.Data), l.Address.Hex()))
+		}
+	}
+	return nil
+}
+
 // removePool removes a pool from the cache
 // removes factory from cache if it doesn't have any pools
 func (c *V2Cache) removePool(address common.Address) error {
@@ -314,12 +662,31 @@ func (c *V2Cache) removePool(address common.Address) error {
 			}
 		}
 		delete(c.factories, poolFactory)
+		delete(c.discovered, poolFactory)
 	}
 	return nil
 }
 
-// sync syncs reserves for a list of pools
-func (c *V2Cache) sync(ctx context.Context, m generic.Multicall, pools []common.Address, block uint64) error {
+// candidates returns every unordered pair of cached tokens
+func (c *V2Cache) candidates() []pair.Pair[any] {
+	tokens := make([]token.ERC20, 0, len(c.tokens))
+	for _, t := range c.tokens {
+		tokens = append(tokens, t)
+	}
+
+	pairs := make([]pair.Pair[any], 0, len(tokens)*(len(tokens)-1)/2)
+	for i := range tokens {
+		for j := i + 1; j < len(tokens); j++ {
+			pairs = append(pairs, pair.NewPair[any](tokens[i], tokens[j], nil))
+		}
+	}
+
+	return pairs
+}
+
+// sync fetches the reserves for a list of pools, does not access the cache
+// returns the pools that were synced, pools whose call failed are left out
+func (c *V2Cache) sync(ctx context.Context, m generic.Multicall, pools []common.Address, block uint64) ([]common.Address, []uniswap.Reserves, error) {
 	// prepare calls
 	calls := make([]generic.Call3, len(pools))
 	for i, target := range pools {
@@ -333,117 +700,110 @@ func (c *V2Cache) sync(ctx context.Context, m generic.Multicall, pools []common.
 	// call the contract
 	results, err := m.Aggregate(ctx, calls, block)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// check if results are valid
 	if len(results) != len(pools) {
-		return errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+		return nil, nil, errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
 	}
 
 	// decode results
+	reserves, failed := make([]uniswap.Reserves, len(pools)), make([]bool, len(pools))
 	for i, result := range results {
-		poolAddr := pools[i]
+		// skip failed and reverted calls
+		if !succeededCall(result) {
+			failed[i] = true
+			continue
+		}
 
 		// check if pool initialized
 		if len(result.ReturnData) == 0 {
-			c.pools[poolAddr].Update(uniswap.Reserves{
+			reserves[i] = uniswap.Reserves{
 				Reserve0: big.NewInt(0),
 				Reserve1: big.NewInt(0),
-			}, block)
+			}
 			continue
 		}
 
 		if len(result.ReturnData) != 32*3 {
-			return errors.New(fmt.Sprintf("wrong return data length: %v (%s)", len(result.ReturnData), poolAddr.Hex()))
+			failed[i] = true
+			continue
 		}
 
 		// decode reserves
-		reserve0 := new(big.Int).SetBytes(result.ReturnData[0:32])
-		reserve1 := new(big.Int).SetBytes(result.ReturnData[32:64])
+		reserves[i] = uniswap.Reserves{
+			Reserve0: new(big.Int).SetBytes(result.ReturnData[0:32]),
+			Reserve1: new(big.Int).SetBytes(result.ReturnData[32:64]),
+		}
+	}
 
-		// update pool
-		c.pools[poolAddr].Update(uniswap.Reserves{
-			Reserve0: reserve0,
-			Reserve1: reserve1,
-		}, block)
+	synced, reserves := succeeded(pools, reserves, failed)
+	return synced, reserves, nil
+}
+
+// update updates the pools with their synced reserves
+// pools removed while syncing are skipped
+func (c *V2Cache) update(pools []common.Address, reserves []uniswap.Reserves, block cache.Block) error {
+	// check if a concurrent sync got ahead
+	if c.history.Head().Number >= block.Number {
+		return BlockAlreadySynced
 	}
 
+	// keep the previous states of the changed pools for rollbacks
+	previous := make(map[common.Address]cache.PoolState[uniswap.Reserves])
+	for i, poolAddr := range pools {
+		if p, ok := c.pools[poolAddr]; ok {
+			if state, stateBlock, _ := p.State(); !state.Equal(reserves[i]) {
+				previous[poolAddr] = cache.PoolState[uniswap.Reserves]{State: state, Block: stateBlock}
+			}
+			p.Update(reserves[i], block.Number)
+		}
+	}
+
+	c.history.Push(block, previous)
 	return nil
 }
 
-// importTokens imports tokens into the cache
-func (c *V2Cache) importTokens(ctx context.Context, m generic.Multicall, tokens []common.Address) error {
+// importTokens imports tokens into the cache with their on-chain metadata
+// tokens whose metadata cannot be fetched or decoded are skipped, listed metadata differing from it are reported
+func (c *V2Cache) importTokens(ctx context.Context, m generic.Multicall, tokens []token.ERC20) (cache.ImportReport, error) {
+	report := cache.ImportReport{Skipped: make([]cache.SkippedToken, 0), Mismatched: make([]cache.MismatchedToken, 0)}
+
 	// prepare calls
-	calls := make([]generic.Call3, 0)
-	for _, target := range tokens {
-		calls = append(calls, generic.Call3{
-			Target:       target,
-			CallData:     crypto.Keccak256([]byte("decimals()"))[:4],
-			AllowFailure: false,
-		})
-		calls = append(calls, generic.Call3{
-			Target:       target,
-			CallData:     crypto.Keccak256([]byte("symbol()"))[:4],
-			AllowFailure: false,
-		})
-		calls = append(calls, generic.Call3{
-			Target:       target,
-			CallData:     crypto.Keccak256([]byte("name()"))[:4],
-			AllowFailure: false,
-		})
+	calls := make([]generic.Call3, 0, len(tokens)*3)
+	for _, t := range tokens {
+		calls = append(calls, tokenCalls(t.Address)...)
 	}
 
 	// call the contract
 	results, err := m.Aggregate(ctx, calls, 0)
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	// check if results are valid
 	if len(results) != len(tokens)*3 {
-		return errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+		return report, errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
 	}
 
 	// decode results
 	for i := 0; i < len(results); i += 3 {
-		tokenAddr := tokens[i/3]
-
-		// validate data
-		if len(results[i].ReturnData) != 32 {
-			return errors.New(fmt.Sprintf("invalid return data length for decimals: %v", len(results[i].ReturnData)))
-		}
-		if len(results[i+1].ReturnData) < 32 {
-			return errors.New(fmt.Sprintf("invalid return data length for symbol: %v", len(results[i+1].ReturnData)))
-		}
-		if len(results[i+2].ReturnData) < 32 {
-			return errors.New(fmt.Sprintf("invalid return data length for name: %v", len(results[i+2].ReturnData)))
+		listed := tokens[i/3]
+		t, err := decodeToken(listed.Address, results[i:i+3])
+		if err != nil {
+			report.Skipped = append(report.Skipped, cache.SkippedToken{Address: listed.Address, Reason: err.Error()})
+			continue
 		}
+		report.Mismatched = append(report.Mismatched, reconcileToken(listed, t)...)
 
-		// decode data
-		decimals := new(big.Int).SetBytes(results[i].ReturnData)
-		symbol := fmt.Sprintf("%s", results[i+1].ReturnData)
-		name := fmt.Sprintf("%s", results[i+2].ReturnData)
-
-		// trim invalid characters
-		symbol = strings.TrimFunc(symbol, func(r rune) bool {
-			return !unicode.IsDigit(r) && !unicode.IsLetter(r)
-		})
-		name = strings.TrimFunc(name, func(r rune) bool {
-			return !unicode.IsDigit(r) && !unicode.IsLetter(r)
-		})
-
-		// create token info
-		err = c.addToken(token.ERC20{
-			Address:  tokenAddr,
-			Decimals: decimals,
-			Symbol:   symbol,
-			Name:     name,
-		})
-		if err != nil {
-			return err
+		// create token info, tokens already cached or listed twice are skipped
+		if err := c.addToken(t); err != nil {
+			report.Skipped = append(report.Skipped, cache.SkippedToken{Address: listed.Address, Reason: err.Error()})
+			continue
 		}
+		report.Imported++
 	}
 
-	return nil
+	return report, nil
 }
@@ -1,6 +1,7 @@
 package uniswap
 
 import (
+	"PoolHelper/src/cache"
 	"PoolHelper/src/multicall/generic"
 	"PoolHelper/src/pool"
 	"PoolHelper/src/pool/uniswap"
@@ -12,45 +13,79 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"math/big"
-	"strings"
 	"sync"
-	"unicode"
 )
 
 type V3Cache struct {
 	tokens    map[common.Address]token.ERC20
-	pools     map[common.Address]pool.Pool[uniswap.Slot0, uniswap.V3FeeType]
+	pools     map[common.Address]pool.Pool[uniswap.V3State, uniswap.V3FeeType]
 	factories map[common.Address]factory.Factory[uniswap.V3FeeType]
-	lastSync  uint64
+	history   *cache.History[uniswap.V3State]
 	m         sync.RWMutex
+
+	// discovered are the factories whose pools are discovered on chain, tokens added later get no blind pools of them
+	discovered map[common.Address]bool
+
+	// poolHistorySize is the number of synced states kept by each pool
+	poolHistorySize int
+
+	// tickWordRadius is the number of tick bitmap words synced on each side of the current tick
+	tickWordRadius int
 }
 
+// DefaultTickWordRadius is the default number of tick bitmap words synced on each side of the current tick
+const DefaultTickWordRadius = 2
+
 func NewV3Cache() *V3Cache {
 	return &V3Cache{
 		tokens:    make(map[common.Address]token.ERC20),
-		pools:     make(map[common.Address]pool.Pool[uniswap.Slot0, uniswap.V3FeeType]),
+		pools:     make(map[common.Address]pool.Pool[uniswap.V3State, uniswap.V3FeeType]),
 		factories: make(map[common.Address]factory.Factory[uniswap.V3FeeType]),
 		m:         sync.RWMutex{},
-		lastSync:  0,
+		history:   cache.NewHistory[uniswap.V3State](cache.DefaultHistoryDepth),
+
+		discovered:      make(map[common.Address]bool),
+		poolHistorySize: pool.DefaultHistorySize,
+
+		tickWordRadius: DefaultTickWordRadius,
 	}
 }
 
+// SetTickWordRadius sets the number of tick bitmap words synced on each side of the current tick
+// swaps crossing ticks outside of the synced words can not be simulated
+func (c *V3Cache) SetTickWordRadius(radius int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.tickWordRadius = max(radius, 0)
+}
+
 ///
 /// Token Cache
 ///
 
-func (c *V3Cache) ImportTokens(ctx context.Context, m generic.Multicall, tokens []common.Address) error {
+func (c *V3Cache) ImportTokens(ctx context.Context, m generic.Multicall, tokens []common.Address) (cache.ImportReport, error) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
 	// import tokens
-	if err := c.importTokens(ctx, m, tokens); err != nil {
-		return err
+	listed := make([]token.ERC20, len(tokens))
+	for i, address := range tokens {
+		listed[i] = token.ERC20{Address: address}
 	}
+	return c.importTokens(ctx, m, listed)
+}
 
-	return nil
+func (c *V3Cache) ImportTokenList(ctx context.Context, m generic.Multicall, tokens []token.ERC20) (cache.ImportReport, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// import tokens and reconcile their listed metadata
+	return c.importTokens(ctx, m, tokens)
 }
 
 func (c *V3Cache) AddToken(t token.ERC20) error {
@@ -138,6 +173,76 @@ func (c *V3Cache) InitializePools(factory factory.Factory[uniswap.V3FeeType]) er
 	return nil
 }
 
+// DiscoverPools adds the pools of the factory that are deployed on chain
+// every unordered token pair and fee tier is looked up with the factory getPool function instead of assuming it exists
+func (c *V3Cache) DiscoverPools(ctx context.Context, m generic.Multicall, factory factory.Factory[uniswap.V3FeeType], block uint64) (cache.DiscoveryReport, error) {
+	report := cache.DiscoveryReport{}
+
+	// validate factory
+	if ok := factory.IsValid(); !ok {
+		return report, InvalidFactory
+	}
+
+	// collect candidates, the lookup runs without holding the lock
+	c.m.RLock()
+	candidates := c.candidates(factory.FeeTypes)
+	c.m.RUnlock()
+
+	// prepare calls
+	selector := crypto.Keccak256([]byte("getPool(address,address,uint24)"))[:4]
+	calls := make([]generic.Call3, len(candidates))
+	for i, candidate := range candidates {
+		fee := new(big.Int).SetUint64(uint64(candidate.PairOptions)).Bytes()
+		calls[i] = factoryCall(factory.Address, selector, candidate.TokenA.Address.Bytes(), candidate.TokenB.Address.Bytes(), fee)
+	}
+	report.Candidates = len(candidates)
+
+	// call the factory
+	results, err := m.Aggregate(ctx, calls, block)
+	if err != nil {
+		return report, err
+	}
+
+	// check if results are valid
+	if len(results) != len(candidates) {
+		return report, errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// pools of tokens added later are left to the next discovery
+	c.discovered[factory.Address] = true
+
+	// add deployed pools
+	for i, result := range results {
+		if result.Err != nil {
+			report.Failed++
+			continue
+		}
+
+		// reverted lookups carry revert data instead of an address
+		deployed := decodeAddress(result.ReturnData)
+		if !result.Success || deployed == (common.Address{}) {
+			report.Skipped++
+			continue
+		}
+
+		// the factory pool must match the cached pool address
+		if p := uniswap.NewV3Pool(factory.Address, factory.InitHash, candidates[i]); p.Address() != deployed {
+			report.Mismatched++
+			continue
+		}
+
+		if err := c.addPool(factory, candidates[i], false); err != nil {
+			return report, err
+		}
+		report.Deployed++
+	}
+
+	return report, nil
+}
+
 func (c *V3Cache) RemovePool(address common.Address) error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -155,7 +260,7 @@ func (c *V3Cache) RemovePool(address common.Address) error {
 	return nil
 }
 
-func (c *V3Cache) Pool(address common.Address) (pool.Pool[uniswap.Slot0, uniswap.V3FeeType], error) {
+func (c *V3Cache) Pool(address common.Address) (pool.Pool[uniswap.V3State, uniswap.V3FeeType], error) {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
@@ -167,12 +272,12 @@ func (c *V3Cache) Pool(address common.Address) (pool.Pool[uniswap.Slot0, uniswap
 	return nil, PoolNotFound
 }
 
-func (c *V3Cache) Pools() []pool.Pool[uniswap.Slot0, uniswap.V3FeeType] {
+func (c *V3Cache) Pools() []pool.Pool[uniswap.V3State, uniswap.V3FeeType] {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
 	// get pools from cache
-	pools := make([]pool.Pool[uniswap.Slot0, uniswap.V3FeeType], 0, len(c.pools))
+	pools := make([]pool.Pool[uniswap.V3State, uniswap.V3FeeType], 0, len(c.pools))
 	for _, p := range c.pools {
 		pools = append(pools, p)
 	}
@@ -184,12 +289,14 @@ func (c *V3Cache) Pools() []pool.Pool[uniswap.Slot0, uniswap.V3FeeType] {
 /// Reserve Cache
 ///
 
-func (c *V3Cache) SyncAll(ctx context.Context, m generic.Multicall, block uint64) error {
-	c.m.Lock()
-	defer c.m.Unlock()
+// SyncAll syncs every cached pool at the given block
+// the multicall runs without holding the cache lock, so readers are not blocked while syncing
+func (c *V3Cache) SyncAll(ctx context.Context, m generic.Multicall, block cache.Block) error {
+	c.m.RLock()
 
 	// check if block has already been synced
-	if c.lastSync >= block {
+	if c.history.Head().Number >= block.Number {
+		c.m.RUnlock()
 		return BlockAlreadySynced
 	}
 
@@ -198,46 +305,364 @@ func (c *V3Cache) SyncAll(ctx context.Context, m generic.Multicall, block uint64
 	for _, p := range c.pools {
 		allPools = append(allPools, p.Address())
 	}
+	sortAddresses(allPools)
+	radius := c.tickWordRadius
+	c.m.RUnlock()
 
-	// sync reserves
-	if err := c.sync(ctx, m, allPools, block); err != nil {
+	// sync states
+	synced, states, err := c.sync(ctx, m, allPools, radius, block.Number)
+	if err != nil {
 		return err
 	}
 
-	c.lastSync = block
-	return nil
-}
-
-func (c *V3Cache) Sync(ctx context.Context, m generic.Multicall, pools []common.Address, block uint64) error {
 	c.m.Lock()
 	defer c.m.Unlock()
 
+	return c.update(synced, states, block)
+}
+
+// Sync syncs a list of cached pools at the given block
+// the multicall runs without holding the cache lock, so readers are not blocked while syncing
+func (c *V3Cache) Sync(ctx context.Context, m generic.Multicall, pools []common.Address, block cache.Block) error {
+	c.m.RLock()
+
 	// check if block has already been synced
-	if c.lastSync >= block {
+	if c.history.Head().Number >= block.Number {
+		c.m.RUnlock()
 		return BlockAlreadySynced
 	}
 
 	// check if pools are valid
 	for _, p := range pools {
 		if _, ok := c.pools[p]; !ok {
+			c.m.RUnlock()
 			return PoolNotFound
 		}
 	}
+	radius := c.tickWordRadius
+	c.m.RUnlock()
 
-	// sync reserves
-	if err := c.sync(ctx, m, pools, block); err != nil {
+	// sync states
+	synced, states, err := c.sync(ctx, m, pools, radius, block.Number)
+	if err != nil {
 		return err
 	}
 
-	c.lastSync = block
-	return nil
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.update(synced, states, block)
+}
+
+// RecenterTicks re-syncs the tick words of the pools whose current tick nears the edge of their synced words
+// logs only update the ticks inside the synced words, so the words must follow the price when syncing from logs
+// the ticks are fetched at the last synced block, it returns the number of re-centred pools
+func (c *V3Cache) RecenterTicks(ctx context.Context, m generic.Multicall) (int, error) {
+	c.m.RLock()
+	head := c.history.Head()
+	radius := c.tickWordRadius
+	pools, states, blocks := make([]common.Address, 0), make([]uniswap.V3State, 0), make([]uint64, 0)
+	for _, p := range c.pools {
+		state, stateBlock, _ := p.State()
+		if stateBlock != 0 && needsRecentering(state, radius) {
+			pools = append(pools, p.Address())
+			states = append(states, state)
+			blocks = append(blocks, stateBlock)
+		}
+	}
+	c.m.RUnlock()
+	if len(pools) == 0 {
+		return 0, nil
+	}
+
+	// sync the words around the current ticks
+	failed := make([]bool, len(pools))
+	if err := c.syncTicks(ctx, m, pools, states, failed, radius, head.Number); err != nil {
+		return 0, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// skip the ticks if the cache moved on while they were fetched
+	if c.history.Head() != head {
+		return 0, nil
+	}
+	recentred := 0
+	for i, poolAddr := range pools {
+		p, ok := c.pools[poolAddr]
+		if !ok || failed[i] {
+			continue
+		}
+		state, stateBlock, _ := p.State()
+		if stateBlock != blocks[i] {
+			continue
+		}
+		state.MinWord, state.MaxWord, state.Ticks = states[i].MinWord, states[i].MaxWord, states[i].Ticks
+		p.Update(state, stateBlock)
+		recentred++
+	}
+	return recentred, nil
 }
 
 func (c *V3Cache) LastSynced() uint64 {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
-	return c.lastSync
+	return c.history.Head().Number
+}
+
+///
+/// History Cache
+///
+
+// SetHistoryDepth sets the number of synced blocks the cache can roll back
+func (c *V3Cache) SetHistoryDepth(depth int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.history.SetDepth(depth)
+}
+
+// SetPoolHistorySize sets the number of synced states kept by each pool
+func (c *V3Cache) SetPoolHistorySize(size int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.poolHistorySize = max(size, 0)
+	for _, p := range c.pools {
+		p.SetHistorySize(c.poolHistorySize)
+	}
+}
+
+// Head returns the last synced block
+func (c *V3Cache) Head() cache.Block {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.history.Head()
+}
+
+// History returns the blocks the cache can be rolled back to, oldest first
+func (c *V3Cache) History() []cache.Block {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.history.Blocks()
+}
+
+// Rollback restores the pool states of a block of the history, e.g. the common ancestor of a reorg
+// pools removed since the block are skipped
+func (c *V3Cache) Rollback(block cache.Block) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	states, err := c.history.Rollback(block)
+	if err != nil {
+		return err
+	}
+
+	for poolAddr, state := range states {
+		if p, ok := c.pools[poolAddr]; ok {
+			p.Update(state.State, state.Block)
+		}
+	}
+	return nil
+}
+
+///
+/// Log Cache
+///
+
+// topics of the UniswapV3Pool events that change the pool state
+var (
+	swapTopic = crypto.Keccak256Hash([]byte("Swap(address,address,int256,int256,uint160,uint128,int24)"))
+	mintTopic = crypto.Keccak256Hash([]byte("Mint(address,address,int24,int24,uint128,uint256,uint256)"))
+	burnTopic = crypto.Keccak256Hash([]byte("Burn(address,int24,int24,uint128,uint256,uint256)"))
+
+	initializeTopic = crypto.Keccak256Hash([]byte("Initialize(uint160,int24)"))
+)
+
+func (c *V3Cache) LogTopics() []common.Hash {
+	return []common.Hash{swapTopic, mintTopic, burnTopic, initializeTopic}
+}
+
+// ValidateLogs checks the logs of a block without applying them, ApplyLogs fails with the same error
+func (c *V3Cache) ValidateLogs(logs []types.Log, block cache.Block) error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.validateLogs(logs, block)
+}
+
+// ApplyLogs updates the state of the cached pools from their Swap, Mint, Burn and Initialize logs
+// block is the last block covered by the logs, logs of already synced blocks are skipped
+func (c *V3Cache) ApplyLogs(logs []types.Log, block cache.Block) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// validate every log before applying any, a malformed log leaves the cache unchanged
+	if err := c.validateLogs(logs, block); err != nil {
+		return err
+	}
+	head := c.history.Head()
+
+	// keep the states of the pools before their first log for rollbacks
+	previous := make(map[common.Address]cache.PoolState[uniswap.V3State])
+	for _, l := range logs {
+		p, ok := c.logPool(l, head)
+		if !ok {
+			continue
+		}
+		state, stateBlock, _ := p.State()
+		if _, ok := previous[l.Address]; !ok {
+			previous[l.Address] = cache.PoolState[uniswap.V3State]{State: state, Block: stateBlock}
+		}
+
+		switch l.Topics[0] {
+		case swapTopic:
+			state = state.ApplySwap(
+				new(big.Int).SetBytes(l.Data[64:96]),
+				new(big.Int).SetBytes(l.Data[96:128]),
+				int(math.S256(new(big.Int).SetBytes(l.Data[128:160])).Int64()),
+			)
+		case mintTopic, burnTopic:
+			offset := 0
+			if l.Topics[0] == mintTopic {
+				offset = 32
+			}
+			liquidityDelta := new(big.Int).SetBytes(l.Data[offset : offset+32])
+			if l.Topics[0] == burnTopic {
+				liquidityDelta.Neg(liquidityDelta)
+			}
+			state = state.ModifyPosition(
+				int(math.S256(l.Topics[2].Big()).Int64()),
+				int(math.S256(l.Topics[3].Big()).Int64()),
+				liquidityDelta,
+			)
+		case initializeTopic:
+			// pools synced before they were initialized have their tick spacing but no price yet
+			tick := int(math.S256(new(big.Int).SetBytes(l.Data[32:64])).Int64())
+			minWord, maxWord := 0, 0
+			if state.TickSpacing > 0 {
+				minWord, maxWord = tickWords(tick, state.TickSpacing, c.tickWordRadius)
+			}
+			state = state.ApplyInitialize(new(big.Int).SetBytes(l.Data[0:32]), tick, minWord, maxWord)
+		default:
+			continue
+		}
+
+		p.Update(state, l.BlockNumber)
+	}
+
+	c.history.Push(block, previous)
+	return nil
+}
+
+///
+/// Snapshot Cache
+///
+
+// Snapshot returns the tokens, factories and pool states of the cache at its last synced block
+// the snapshot is tagged with the hash of the last synced block, used to detect reorgs when restoring
+func (c *V3Cache) Snapshot() (cache.Snapshot[uniswap.V3State, uniswap.V3FeeType], error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	s := cache.Snapshot[uniswap.V3State, uniswap.V3FeeType]{
+		Version:   cache.SnapshotVersion,
+		Block:     c.history.Head().Number,
+		BlockHash: c.history.Head().Hash,
+		Tokens:    make([]token.ERC20, 0, len(c.tokens)),
+		Factories: make([]factory.Factory[uniswap.V3FeeType], 0, len(c.factories)),
+		Pools:     make([]cache.PoolSnapshot[uniswap.V3State, uniswap.V3FeeType], 0, len(c.pools)),
+	}
+	for _, t := range c.tokens {
+		s.Tokens = append(s.Tokens, t)
+	}
+	for _, f := range c.factories {
+		s.Factories = append(s.Factories, f)
+	}
+	for _, p := range c.pools {
+		state, block, _ := p.State()
+		poolPair := p.Pair()
+		s.Pools = append(s.Pools, cache.PoolSnapshot[uniswap.V3State, uniswap.V3FeeType]{
+			Address: p.Address(),
+			Factory: p.Factory(),
+			TokenA:  poolPair.TokenA.Address,
+			TokenB:  poolPair.TokenB.Address,
+			Options: poolPair.PairOptions,
+			State:   state,
+			Block:   block,
+		})
+	}
+
+	return s, nil
+}
+
+// Restore replaces the content of the cache with a snapshot
+// the cache is left unchanged if the snapshot is inconsistent
+func (c *V3Cache) Restore(s cache.Snapshot[uniswap.V3State, uniswap.V3FeeType]) error {
+	// check the snapshot format
+	if s.Version != cache.SnapshotVersion {
+		return cache.InvalidSnapshotVersion
+	}
+
+	tokens := make(map[common.Address]token.ERC20, len(s.Tokens))
+	for _, t := range s.Tokens {
+		if ok := t.IsValid(); !ok {
+			return InvalidToken
+		}
+		tokens[t.Address] = t
+	}
+	factories := make(map[common.Address]factory.Factory[uniswap.V3FeeType], len(s.Factories))
+	for _, f := range s.Factories {
+		if ok := f.IsValid(); !ok {
+			return InvalidFactory
+		}
+		factories[f.Address] = f
+	}
+
+	c.m.RLock()
+	historySize := c.poolHistorySize
+	c.m.RUnlock()
+
+	// recreate pools from their tokens & factory
+	pools := make(map[common.Address]pool.Pool[uniswap.V3State, uniswap.V3FeeType], len(s.Pools))
+	for _, ps := range s.Pools {
+		f, ok := factories[ps.Factory]
+		if !ok {
+			return errors.New(fmt.Sprintf("snapshot pool factory not found: %s (%s)", ps.Factory.Hex(), ps.Address.Hex()))
+		}
+		tokenA, okA := tokens[ps.TokenA]
+		tokenB, okB := tokens[ps.TokenB]
+		if !okA || !okB {
+			return errors.New(fmt.Sprintf("snapshot pool token not found: %s", ps.Address.Hex()))
+		}
+
+		p := uniswap.NewV3Pool(f.Address, f.InitHash, pair.NewPair[uniswap.V3FeeType](tokenA, tokenB, ps.Options))
+		if p.Address() != ps.Address {
+			return errors.New(fmt.Sprintf("snapshot pool address mismatch: %s (expected %s)", p.Address().Hex(), ps.Address.Hex()))
+		}
+		p.SetHistorySize(historySize)
+		p.Update(ps.State, ps.Block)
+		pools[ps.Address] = p
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.tokens = tokens
+	c.factories = factories
+	c.pools = pools
+
+	// snapshot pools are the discovered ones
+	c.discovered = make(map[common.Address]bool, len(factories))
+	for address := range factories {
+		c.discovered[address] = true
+	}
+	c.history.Reset(cache.Block{Number: s.Block, Hash: s.BlockHash})
+	return nil
 }
 
 ///
@@ -246,15 +671,18 @@ func (c *V3Cache) LastSynced() uint64 {
 
 // addToken adds a token to the cache
 // overwrites existing token if it already exists in cache
-// overwrites new pools to cache with existing tokens and factories
+// overwrites new pools to cache with existing tokens and factories that were not discovered
 func (c *V3Cache) addToken(t token.ERC20) error {
 	// check if token already exists in cache
 	if _, ok := c.tokens[t.Address]; ok {
 		return TokenAlreadyExists
 	}
 
-	// iterate through factories
+	// iterate through factories, the pools of discovered factories are only added once deployed
 	for _, f := range c.factories {
+		if c.discovered[f.Address] {
+			continue
+		}
 		// iterate through tokens
 		for _, pairToken := range c.tokens {
 			// iterate through fee types
@@ -295,6 +723,7 @@ func (c *V3Cache) addPool(f factory.Factory[uniswap.V3FeeType], pair pair.Pair[u
 	// create pool & try to add to cache if it doesn't exist
 	p := uniswap.NewV3Pool(f.Address, f.InitHash, pair)
 	if _, ok := c.pools[p.Address()]; !ok || overwrite {
+		p.SetHistorySize(c.poolHistorySize)
 		c.pools[p.Address()] = p
 
 		// add factory to cache if it doesn't exist
@@ -306,6 +735,57 @@ func (c *V3Cache) addPool(f factory.Factory[uniswap.V3FeeType], pair pair.Pair[u
 	return nil
 }
 
+// logPool returns the pool a log is applied to
+// only the logs of synced cached pools after the last synced block are applied,
+// pools that were never synced have no state to apply the logs to, they are synced by the next full sync
+func (c *V3Cache) logPool(l types.Log, head cache.Block) (pool.Pool[uniswap.V3State, uniswap.V3FeeType], bool) {
+	p, ok := c.pools[l.Address]
+	if !ok || l.Removed || l.BlockNumber <= head.Number || len(l.Topics) == 0 {
+		return nil, false
+	}
+	if _, stateBlock, _ := p.State(); stateBlock == 0 {
+		return nil, false
+	}
+	return p, true
+}
+
+// validateLogs checks that the block has not been synced and that the applied logs are well formed
+func (c *V3Cache) validateLogs(logs []types.Log, block cache.Block) error {
+	head := c.history.Head()
+	if head.Number >= block.Number {
+		return BlockAlreadySynced
+	}
+
+	for _, l := range logs {
+		if _, ok := c.logPool(l, head); !ok {
+			continue
+		}
+		switch l.Topics[0] {
+		case swapTopic:
+			// amount0, amount1, sqrtPriceX96, liquidity, tick
+			if len(l.Data) != 32*5 {
+				return errors.New(fmt.Sprintf("wrong swap log data length: %v (%s)", len(l.Data), l.Address.Hex()))
+			}
+		case mintTopic, burnTopic:
+			// mint data is sender, amount, amount0, amount1
+			// burn data is amount, amount0, amount1
+			offset := 0
+			if l.Topics[0] == mintTopic {
+				offset = 32
+			}
+			if len(l.Topics) != 4 || len(l.Data) != offset+32*3 {
+				return errors.New(fmt.Sprintf("wrong position log data length: %v (%s)", len(l.Data), l.Address.Hex()))
+			}
+		case initializeTopic:
+			// sqrtPriceX96, tick
+			if len(l.Data) != 32*2 {
+				return errors.New(fmt.Sprintf("wrong initialize log data length: %v (%s)", len(l.Data), l.Address.Hex()))
+			}
+		}
+	}
+	return nil
+}
+
 // removePool removes a pool from the cache
 // removes factory from cache if it doesn't have any pools
 func (c *V3Cache) removePool(address common.Address) error {
@@ -320,142 +800,314 @@ func (c *V3Cache) removePool(address common.Address) error {
 			}
 		}
 		delete(c.factories, poolFactory)
+		delete(c.discovered, poolFactory)
 	}
 	return nil
 }
 
-// sync syncs reserves for a list of pools
-func (c *V3Cache) sync(ctx context.Context, m generic.Multicall, pools []common.Address, block uint64) error {
-	// prepare calls
-	calls := make([]generic.Call3, len(pools))
-	for i, target := range pools {
-		calls[i] = generic.Call3{
-			Target:       target,
-			CallData:     crypto.Keccak256([]byte("slot0()"))[:4],
-			AllowFailure: true,
+// candidates returns every unordered pair of cached tokens for each fee tier
+func (c *V3Cache) candidates(feeTypes []uniswap.V3FeeType) []pair.Pair[uniswap.V3FeeType] {
+	tokens := make([]token.ERC20, 0, len(c.tokens))
+	for _, t := range c.tokens {
+		tokens = append(tokens, t)
+	}
+
+	pairs := make([]pair.Pair[uniswap.V3FeeType], 0, len(tokens)*(len(tokens)-1)/2*len(feeTypes))
+	for i := range tokens {
+		for j := i + 1; j < len(tokens); j++ {
+			for _, feeType := range feeTypes {
+				pairs = append(pairs, pair.NewPair[uniswap.V3FeeType](tokens[i], tokens[j], feeType))
+			}
 		}
 	}
 
-	// call the contract
-	results, err := m.Aggregate(ctx, calls, block)
+	return pairs
+}
+
+// sync fetches slot0, liquidity and the initialized ticks for a list of pools
+// does not access the cache, radius is the number of tick bitmap words synced on each side of the current tick
+// returns the pools that were synced, pools whose calls failed are left out
+func (c *V3Cache) sync(ctx context.Context, m generic.Multicall, pools []common.Address, radius int, block uint64) ([]common.Address, []uniswap.V3State, error) {
+	// sync slot0, liquidity & tick spacing
+	states, failed, err := c.syncSlots(ctx, m, pools, block)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// check if results are valid
-	if len(results) != len(pools) {
-		return errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	// sync the tick bitmap words around the current ticks
+	if err := c.syncTicks(ctx, m, pools, states, failed, radius, block); err != nil {
+		return nil, nil, err
 	}
 
-	// decode results
-	for i, result := range results {
-		poolAddr := pools[i]
+	synced, states := succeeded(pools, states, failed)
+	return synced, states, nil
+}
 
-		// check if pool initialized
-		if len(result.ReturnData) == 0 {
-			c.pools[poolAddr].Update(uniswap.Slot0{
-				SqrtPriceX96:               big.NewInt(0),
-				Tick:                       big.NewInt(0),
-				ObservationIndex:           big.NewInt(0),
-				ObservationCardinality:     big.NewInt(0),
-				ObservationCardinalityNext: big.NewInt(0),
-				FeeProtocol:                big.NewInt(0),
-				Unlocked:                   false,
-			}, block)
-			continue
-		}
+// update updates the pools with their synced states
+// pools removed while syncing are skipped
+func (c *V3Cache) update(pools []common.Address, states []uniswap.V3State, block cache.Block) error {
+	// check if a concurrent sync got ahead
+	if c.history.Head().Number >= block.Number {
+		return BlockAlreadySynced
+	}
 
-		if len(result.ReturnData) != 224 {
-			return errors.New(fmt.Sprintf("wrong return data length: %v", len(result.ReturnData)))
+	// keep the previous states of the changed pools for rollbacks
+	previous := make(map[common.Address]cache.PoolState[uniswap.V3State])
+	for i, poolAddr := range pools {
+		if p, ok := c.pools[poolAddr]; ok {
+			if state, stateBlock, _ := p.State(); !state.Equal(states[i]) {
+				previous[poolAddr] = cache.PoolState[uniswap.V3State]{State: state, Block: stateBlock}
+			}
+			p.Update(states[i], block.Number)
 		}
-
-		// update pool
-		c.pools[poolAddr].Update(uniswap.Slot0{
-			SqrtPriceX96:               new(big.Int).SetBytes(result.ReturnData[0:32]),
-			Tick:                       new(big.Int).SetBytes(result.ReturnData[32:64]),
-			ObservationIndex:           new(big.Int).SetBytes(result.ReturnData[64:96]),
-			ObservationCardinality:     new(big.Int).SetBytes(result.ReturnData[96:128]),
-			ObservationCardinalityNext: new(big.Int).SetBytes(result.ReturnData[128:160]),
-			FeeProtocol:                new(big.Int).SetBytes(result.ReturnData[160:192]),
-			Unlocked:                   result.ReturnData[223] != 0,
-		}, block)
 	}
 
+	c.history.Push(block, previous)
 	return nil
 }
 
-// importTokens imports tokens into the cache
-func (c *V3Cache) importTokens(ctx context.Context, m generic.Multicall, tokens []common.Address) error {
+// syncSlots fetches slot0, liquidity and tick spacing for a list of pools
+// failed marks the pools whose calls failed
+func (c *V3Cache) syncSlots(ctx context.Context, m generic.Multicall, pools []common.Address, block uint64) (states []uniswap.V3State, failed []bool, err error) {
 	// prepare calls
-	calls := make([]generic.Call3, 0)
-	for _, target := range tokens {
+	calls := make([]generic.Call3, 0, len(pools)*3)
+	for _, target := range pools {
 		calls = append(calls, generic.Call3{
 			Target:       target,
-			CallData:     crypto.Keccak256([]byte("decimals()"))[:4],
-			AllowFailure: false,
+			CallData:     crypto.Keccak256([]byte("slot0()"))[:4],
+			AllowFailure: true,
 		})
 		calls = append(calls, generic.Call3{
 			Target:       target,
-			CallData:     crypto.Keccak256([]byte("symbol()"))[:4],
-			AllowFailure: false,
+			CallData:     crypto.Keccak256([]byte("liquidity()"))[:4],
+			AllowFailure: true,
 		})
 		calls = append(calls, generic.Call3{
 			Target:       target,
-			CallData:     crypto.Keccak256([]byte("name()"))[:4],
-			AllowFailure: false,
+			CallData:     crypto.Keccak256([]byte("tickSpacing()"))[:4],
+			AllowFailure: true,
 		})
 	}
 
 	// call the contract
-	results, err := m.Aggregate(ctx, calls, 0)
+	results, err := m.Aggregate(ctx, calls, block)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// check if results are valid
-	if len(results) != len(tokens)*3 {
-		return errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	if len(results) != len(pools)*3 {
+		return nil, nil, errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
 	}
 
 	// decode results
+	states, failed = make([]uniswap.V3State, len(pools)), make([]bool, len(pools))
 	for i := 0; i < len(results); i += 3 {
-		tokenAddr := tokens[i/3]
+		// skip failed and reverted calls
+		if !succeededCall(results[i]) || !succeededCall(results[i+1]) || !succeededCall(results[i+2]) {
+			failed[i/3] = true
+			continue
+		}
 
-		// validate data
-		if len(results[i].ReturnData) != 32 {
-			return errors.New(fmt.Sprintf("invalid return data length for decimals: %v", len(results[i].ReturnData)))
+		// check if pool initialized
+		if len(results[i].ReturnData) == 0 {
+			states[i/3] = uniswap.V3State{
+				Slot0: uniswap.Slot0{
+					SqrtPriceX96:               big.NewInt(0),
+					Tick:                       big.NewInt(0),
+					ObservationIndex:           big.NewInt(0),
+					ObservationCardinality:     big.NewInt(0),
+					ObservationCardinalityNext: big.NewInt(0),
+					FeeProtocol:                big.NewInt(0),
+					Unlocked:                   false,
+				},
+				Liquidity: big.NewInt(0),
+			}
+			continue
 		}
-		if len(results[i+1].ReturnData) < 32 {
-			return errors.New(fmt.Sprintf("invalid return data length for symbol: %v", len(results[i+1].ReturnData)))
+
+		// skip invalid return data
+		slot, err := uniswap.DecodeSlot0(results[i].ReturnData)
+		if err != nil || len(results[i+1].ReturnData) != 32 || len(results[i+2].ReturnData) != 32 {
+			failed[i/3] = true
+			continue
 		}
-		if len(results[i+2].ReturnData) < 32 {
-			return errors.New(fmt.Sprintf("invalid return data length for name: %v", len(results[i+2].ReturnData)))
+
+		states[i/3] = uniswap.V3State{
+			Slot0:       slot,
+			Liquidity:   new(big.Int).SetBytes(results[i+1].ReturnData),
+			TickSpacing: int(math.S256(new(big.Int).SetBytes(results[i+2].ReturnData)).Int64()),
 		}
+	}
 
-		// decode data
-		decimals := new(big.Int).SetBytes(results[i].ReturnData)
-		symbol := fmt.Sprintf("%s", results[i+1].ReturnData)
-		name := fmt.Sprintf("%s", results[i+2].ReturnData)
+	return states, failed, nil
+}
 
-		// trim invalid characters
-		symbol = strings.TrimFunc(symbol, func(r rune) bool {
-			return !unicode.IsDigit(r) && !unicode.IsLetter(r)
-		})
-		name = strings.TrimFunc(name, func(r rune) bool {
-			return !unicode.IsDigit(r) && !unicode.IsLetter(r)
-		})
+// syncTicks fetches the tick bitmap words around the current tick
+// and the initialized ticks in them for a list of pool states, pools whose calls failed are marked in failed
+func (c *V3Cache) syncTicks(ctx context.Context, m generic.Multicall, pools []common.Address, states []uniswap.V3State, failed []bool, radius int, block uint64) error {
+	// index is the bitmap word position or the tick index
+	type poolRef struct {
+		pool  int
+		index int
+	}
+
+	// prepare bitmap calls
+	bitmapCalls, words := make([]generic.Call3, 0), make([]poolRef, 0)
+	for i := range states {
+		spacing := states[i].TickSpacing
+		if failed[i] || spacing <= 0 || states[i].Slot0.SqrtPriceX96.Sign() == 0 {
+			continue
+		}
+
+		minWord, maxWord := tickWords(int(states[i].Slot0.Tick.Int64()), spacing, radius)
+		states[i].MinWord, states[i].MaxWord = minWord, maxWord
+		states[i].Ticks = make([]uniswap.Tick, 0)
+
+		for w := minWord; w <= maxWord; w++ {
+			bitmapCalls = append(bitmapCalls, generic.Call3{
+				Target:       pools[i],
+				CallData:     append(crypto.Keccak256([]byte("tickBitmap(int16)"))[:4], math.U256Bytes(big.NewInt(int64(w)))...),
+				AllowFailure: true,
+			})
+			words = append(words, poolRef{pool: i, index: w})
+		}
+	}
+	if len(bitmapCalls) == 0 {
+		return nil
+	}
+
+	// call the contract
+	results, err := m.Aggregate(ctx, bitmapCalls, block)
+	if err != nil {
+		return err
+	}
+	if len(results) != len(bitmapCalls) {
+		return errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	}
+
+	// prepare tick calls for the initialized bits
+	tickCalls, ticks := make([]generic.Call3, 0), make([]poolRef, 0)
+	for i, result := range results {
+		ref := words[i]
+		if !succeededCall(result) || len(result.ReturnData) != 32 {
+			failed[ref.pool] = true
+			continue
+		}
+
+		bitmap := new(big.Int).SetBytes(result.ReturnData)
+		for bit := 0; bit < 256; bit++ {
+			if bitmap.Bit(bit) == 0 {
+				continue
+			}
+
+			tick := ((ref.index << 8) + bit) * states[ref.pool].TickSpacing
+			tickCalls = append(tickCalls, generic.Call3{
+				Target:       pools[ref.pool],
+				CallData:     append(crypto.Keccak256([]byte("ticks(int24)"))[:4], math.U256Bytes(big.NewInt(int64(tick)))...),
+				AllowFailure: true,
+			})
+			ticks = append(ticks, poolRef{pool: ref.pool, index: tick})
+		}
+	}
+	if len(tickCalls) == 0 {
+		return nil
+	}
+
+	// call the contract
+	results, err = m.Aggregate(ctx, tickCalls, block)
+	if err != nil {
+		return err
+	}
+	if len(results) != len(tickCalls) {
+		return errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	}
 
-		// create token info
-		err = c.addToken(token.ERC20{
-			Address:  tokenAddr,
-			Decimals: decimals,
-			Symbol:   symbol,
-			Name:     name,
+	// decode ticks, calls are ordered by tick so the ticks stay sorted
+	for i, result := range results {
+		ref := ticks[i]
+		if !succeededCall(result) || len(result.ReturnData) != 256 {
+			failed[ref.pool] = true
+			continue
+		}
+
+		states[ref.pool].Ticks = append(states[ref.pool].Ticks, uniswap.Tick{
+			Index:          ref.index,
+			LiquidityGross: new(big.Int).SetBytes(result.ReturnData[0:32]),
+			LiquidityNet:   math.S256(new(big.Int).SetBytes(result.ReturnData[32:64])),
 		})
+	}
+
+	return nil
+}
+
+// needsRecentering returns true if the current tick is within half the radius of the edge of the synced words
+// and the words centred on it would extend past that edge
+func needsRecentering(s uniswap.V3State, radius int) bool {
+	spacing := s.TickSpacing
+	if spacing <= 0 || s.Slot0.Tick == nil || s.Slot0.SqrtPriceX96 == nil || s.Slot0.SqrtPriceX96.Sign() == 0 {
+		return false
+	}
+
+	word := floorDiv(int(s.Slot0.Tick.Int64()), spacing) >> 8
+	minWord, maxWord := tickWords(int(s.Slot0.Tick.Int64()), spacing, radius)
+	margin := (radius + 1) / 2
+	return (word-s.MinWord < margin && minWord < s.MinWord) || (s.MaxWord-word < margin && maxWord > s.MaxWord)
+}
+
+// tickWords returns the bitmap words within radius of the word of a tick, clamped to the valid ticks
+func tickWords(tick int, spacing int, radius int) (int, int) {
+	word := floorDiv(tick, spacing) >> 8
+	return max(word-radius, floorDiv(uniswap.MinTick, spacing)>>8), min(word+radius, floorDiv(uniswap.MaxTick, spacing)>>8)
+}
+
+// floorDiv returns a / b rounded towards negative infinity
+func floorDiv(a, b int) int {
+	if a < 0 && a%b != 0 {
+		return a/b - 1
+	}
+	return a / b
+}
+
+// importTokens imports tokens into the cache with their on-chain metadata
+// tokens whose metadata cannot be fetched or decoded are skipped, listed metadata differing from it are reported
+func (c *V3Cache) importTokens(ctx context.Context, m generic.Multicall, tokens []token.ERC20) (cache.ImportReport, error) {
+	report := cache.ImportReport{Skipped: make([]cache.SkippedToken, 0), Mismatched: make([]cache.MismatchedToken, 0)}
+
+	// prepare calls
+	calls := make([]generic.Call3, 0, len(tokens)*3)
+	for _, t := range tokens {
+		calls = append(calls, tokenCalls(t.Address)...)
+	}
+
+	// call the contract
+	results, err := m.Aggregate(ctx, calls, 0)
+	if err != nil {
+		return report, err
+	}
+
+	// check if results are valid
+	if len(results) != len(tokens)*3 {
+		return report, errors.New(fmt.Sprintf("wrong number of results: %v", len(results)))
+	}
+
+	// decode results
+	for i := 0; i < len(results); i += 3 {
+		listed := tokens[i/3]
+		t, err := decodeToken(listed.Address, results[i:i+3])
 		if err != nil {
-			return err
+			report.Skipped = append(report.Skipped, cache.SkippedToken{Address: listed.Address, Reason: err.Error()})
+			continue
 		}
+		report.Mismatched = append(report.Mismatched, reconcileToken(listed, t)...)
+
+		// create token info, tokens already cached or listed twice are skipped
+		if err := c.addToken(t); err != nil {
+			report.Skipped = append(report.Skipped, cache.SkippedToken{Address: listed.Address, Reason: err.Error()})
+			continue
+		}
+		report.Imported++
 	}
 
-	return nil
+	return report, nil
 }
@@ -0,0 +1,184 @@
+package chain
+
+import (
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/token"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// chain ids of the registered chains
+const (
+	Ethereum uint64 = 1
+	BSC      uint64 = 56
+	Polygon  uint64 = 137
+	Base     uint64 = 8453
+	Arbitrum uint64 = 42161
+)
+
+// Multicall3 is deployed at the same address on every registered chain
+var Multicall3 = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// init code hashes shared by the forks of the Uniswap pools
+var (
+	uniswapV2InitHash = common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f")
+	sushiSwapInitHash = common.HexToHash("0xe18a34eb0e04b04f7a0ac29a6e80748dca96319b42c54d679cb821dca90c6303")
+	uniswapV3InitHash = common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54")
+)
+
+// uniswapV3FeeTypes are the fee tiers enabled on every Uniswap V3 deployment
+var uniswapV3FeeTypes = []uniswap.V3FeeType{uniswap.MIN, uniswap.LOW, uniswap.NORMAL, uniswap.MAX}
+
+// Chain is an EVM chain with its contracts and defaults
+type Chain struct {
+	ID   uint64
+	Name string
+
+	// Multicall is the Multicall3 contract used to batch calls
+	Multicall common.Address
+	// WrappedNative is the wrapped native token (e.g. WETH), the default arbitrage base
+	WrappedNative token.ERC20
+	// BlockTime is the expected time between two blocks
+	BlockTime time.Duration
+
+	// default factories to discover pools from
+	V2Factories []factory.Factory[any]
+	V3Factories []factory.Factory[uniswap.V3FeeType]
+}
+
+// Blocks returns the expected number of blocks in d, at least 1
+func (c Chain) Blocks(d time.Duration) uint64 {
+	return max(uint64(d/c.BlockTime), 1)
+}
+
+// registry holds the known chains by chain id
+var registry = map[uint64]Chain{
+	Ethereum: {
+		ID:            Ethereum,
+		Name:          "ethereum",
+		Multicall:     Multicall3,
+		WrappedNative: wrapped("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", "Wrapped Ether", "WETH"),
+		BlockTime:     12 * time.Second,
+		V2Factories: []factory.Factory[any]{
+			v2Factory("Uniswap V2", "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f", uniswapV2InitHash, 30),
+			v2Factory("SushiSwap", "0xC0AEe478e3658e2610c5F7A4A2E1777cE9e4f2Ac", sushiSwapInitHash, 30),
+		},
+		V3Factories: []factory.Factory[uniswap.V3FeeType]{
+			v3Factory("Uniswap V3", "0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		},
+	},
+	BSC: {
+		ID:            BSC,
+		Name:          "bsc",
+		Multicall:     Multicall3,
+		WrappedNative: wrapped("0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c", "Wrapped BNB", "WBNB"),
+		BlockTime:     3 * time.Second,
+		V2Factories: []factory.Factory[any]{
+			v2Factory("PancakeSwap V2", "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73", common.HexToHash("0x00fb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5"), 25),
+			v2Factory("SushiSwap", "0xc35DADB65012eC5796536bD9864eD8773aBc74C4", sushiSwapInitHash, 30),
+		},
+		V3Factories: []factory.Factory[uniswap.V3FeeType]{
+			v3Factory("Uniswap V3", "0xdB1d10011AD0Ff90774D0C6Bb92e5C5c8b4461F7"),
+		},
+	},
+	Polygon: {
+		ID:            Polygon,
+		Name:          "polygon",
+		Multicall:     Multicall3,
+		WrappedNative: wrapped("0x0d500B1d8E8eF31E21C99d1Db9A6444d3ADf1270", "Wrapped Matic", "WMATIC"),
+		BlockTime:     2 * time.Second,
+		V2Factories: []factory.Factory[any]{
+			v2Factory("QuickSwap", "0x5757371414417b8C6CAad45bAeF941aBc7d3Ab32", uniswapV2InitHash, 30),
+			v2Factory("SushiSwap", "0xc35DADB65012eC5796536bD9864eD8773aBc74C4", sushiSwapInitHash, 30),
+		},
+		V3Factories: []factory.Factory[uniswap.V3FeeType]{
+			v3Factory("Uniswap V3", "0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		},
+	},
+	Base: {
+		ID:            Base,
+		Name:          "base",
+		Multicall:     Multicall3,
+		WrappedNative: wrapped("0x4200000000000000000000000000000000000006", "Wrapped Ether", "WETH"),
+		BlockTime:     2 * time.Second,
+		V2Factories: []factory.Factory[any]{
+			v2Factory("Uniswap V2", "0x8909Dc15e40173Ff4699343b6eB8132c65e18eC6", uniswapV2InitHash, 30),
+		},
+		V3Factories: []factory.Factory[uniswap.V3FeeType]{
+			v3Factory("Uniswap V3", "0x33128a8fC17869897dcE68Ed026d694621f6FDfD"),
+		},
+	},
+	Arbitrum: {
+		ID:            Arbitrum,
+		Name:          "arbitrum",
+		Multicall:     Multicall3,
+		WrappedNative: wrapped("0x82aF49447D8a07e3bd95BD0d56f35241523fBab1", "Wrapped Ether", "WETH"),
+		BlockTime:     250 * time.Millisecond,
+		V2Factories: []factory.Factory[any]{
+			v2Factory("Uniswap V2", "0xf1D7CC64Fb4452F05c498126312eBE29f30Fbcf9", uniswapV2InitHash, 30),
+			v2Factory("SushiSwap", "0xc35DADB65012eC5796536bD9864eD8773aBc74C4", sushiSwapInitHash, 30),
+		},
+		V3Factories: []factory.Factory[uniswap.V3FeeType]{
+			v3Factory("Uniswap V3", "0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		},
+	},
+}
+
+// Get returns the registered chain of a chain id
+func Get(id uint64) (Chain, bool) {
+	c, ok := registry[id]
+	return c, ok
+}
+
+// IDs returns the ids of the registered chains in ascending order
+func IDs() []uint64 {
+	ids := make([]uint64, 0, len(registry))
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Name returns the name of a registered chain, or "chain <id>" for unknown chains
+func Name(id uint64) string {
+	if c, ok := registry[id]; ok {
+		return c.Name
+	}
+	return "chain " + strconv.FormatUint(id, 10)
+}
+
+///
+/// Utils
+///
+
+func wrapped(address string, name string, symbol string) token.ERC20 {
+	return token.ERC20{
+		Address:  common.HexToAddress(address),
+		Decimals: big.NewInt(18),
+		Name:     name,
+		Symbol:   symbol,
+	}
+}
+
+func v2Factory(name string, address string, initHash common.Hash, swapFee uint64) factory.Factory[any] {
+	return factory.Factory[any]{
+		Name:     name,
+		Address:  common.HexToAddress(address),
+		InitHash: initHash,
+		SwapFee:  swapFee,
+	}
+}
+
+func v3Factory(name string, address string) factory.Factory[uniswap.V3FeeType] {
+	return factory.Factory[uniswap.V3FeeType]{
+		Name:     name,
+		Address:  common.HexToAddress(address),
+		InitHash: uniswapV3InitHash,
+		FeeTypes: uniswapV3FeeTypes,
+	}
+}
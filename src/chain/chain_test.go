@@ -0,0 +1,94 @@
+package chain_test
+
+import (
+	"PoolHelper/src/chain"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	ids := chain.IDs()
+	if len(ids) != 5 || ids[0] != chain.Ethereum || ids[4] != chain.Arbitrum {
+		t.Fatalf("wrong chain ids: %v", ids)
+	}
+
+	for _, id := range ids {
+		c, ok := chain.Get(id)
+		if !ok || c.ID != id || c.Name == "" || c.Multicall != chain.Multicall3 || c.BlockTime <= 0 {
+			t.Errorf("wrong chain %d: %+v", id, c)
+		}
+		if !c.WrappedNative.IsValid() {
+			t.Errorf("invalid wrapped native token of %s", c.Name)
+		}
+		for _, f := range c.V2Factories {
+			if !f.IsValid() || f.SwapFee == 0 {
+				t.Errorf("invalid V2 factory of %s: %+v", c.Name, f)
+			}
+		}
+		for _, f := range c.V3Factories {
+			if !f.IsValid() || len(f.FeeTypes) == 0 {
+				t.Errorf("invalid V3 factory of %s: %+v", c.Name, f)
+			}
+		}
+	}
+
+	if _, ok := chain.Get(10); ok || chain.Name(10) != "chain 10" {
+		t.Errorf("unknown chain should not be registered")
+	}
+}
+
+func TestChain_Blocks(t *testing.T) {
+	ethereum, _ := chain.Get(chain.Ethereum)
+	arbitrum, _ := chain.Get(chain.Arbitrum)
+
+	if b := ethereum.Blocks(20 * time.Minute); b != 100 {
+		t.Errorf("wrong ethereum blocks: %d", b)
+	}
+	if b := arbitrum.Blocks(time.Minute); b != 240 {
+		t.Errorf("wrong arbitrum blocks: %d", b)
+	}
+	if b := ethereum.Blocks(time.Second); b != 1 {
+		t.Errorf("blocks should be at least 1, got %d", b)
+	}
+}
+
+// the registered factories must derive the addresses of deployed pools
+func TestRegistry_PoolAddresses(t *testing.T) {
+	usdc := func(address string) token.ERC20 {
+		return token.ERC20{Address: common.HexToAddress(address), Decimals: big.NewInt(6), Name: "USD Coin", Symbol: "USDC"}
+	}
+
+	ethereum, _ := chain.Get(chain.Ethereum)
+	mainnetUSDC := usdc("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	for i, expected := range []string{
+		"0xB4e16d0168e52d35CaCd2c6185b44281Ec28C9Dc",
+		"0x397FF1542f962076d0BFE58eA045FfA2d347ACa0",
+	} {
+		f := ethereum.V2Factories[i]
+		p := uniswap.NewV2Pool(f.Address, f.InitHash, f.SwapFee, pair.NewPair[any](mainnetUSDC, ethereum.WrappedNative, nil))
+		if p.Address() != common.HexToAddress(expected) {
+			t.Errorf("wrong %s pool address: %s", f.Name, p.Address())
+		}
+	}
+
+	for _, test := range []struct {
+		id       uint64
+		usdc     token.ERC20
+		expected string
+	}{
+		{chain.Ethereum, mainnetUSDC, "0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640"},
+		{chain.Base, usdc("0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913"), "0xd0b53D9277642d899DF5C87A3966A349A798F224"},
+	} {
+		c, _ := chain.Get(test.id)
+		f := c.V3Factories[0]
+		p := uniswap.NewV3Pool(f.Address, f.InitHash, pair.NewPair(test.usdc, c.WrappedNative, uniswap.LOW))
+		if p.Address() != common.HexToAddress(test.expected) {
+			t.Errorf("wrong %s %s pool address: %s", c.Name, f.Name, p.Address())
+		}
+	}
+}
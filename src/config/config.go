@@ -0,0 +1,750 @@
+package config
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/chain"
+	"PoolHelper/src/multicall/generic"
+	"PoolHelper/src/pool"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/provider"
+	"PoolHelper/src/structs/factory"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the config
+const EnvPrefix = "POOLHELPER_"
+
+// SnapshotPeriod is the default time between two snapshots, converted to blocks with the block time of the chain
+const SnapshotPeriod = 20 * time.Minute
+
+// Config is the configuration of the pool helper for one chain
+type Config struct {
+	// ChainID selects the defaults of the chain registry
+	ChainID uint64 `json:"chainId"`
+
+	// Endpoints are the RPC endpoints, the requests are balanced over them
+	// and the block subscription uses the first healthy WebSocket endpoint
+	Endpoints    []Endpoint   `json:"endpoints"`
+	RPC          RPC          `json:"rpc"`
+	Multicall    Multicall    `json:"multicall"`
+	Subscription Subscription `json:"subscription"`
+	Tokens       []Token      `json:"tokens"`
+	TokenLists   []TokenList  `json:"tokenLists"`
+	Factories    Factories    `json:"factories"`
+	Sync         Sync         `json:"sync"`
+	Server       Server       `json:"server"`
+	Arbitrage    Arbitrage    `json:"arbitrage"`
+
+	// Chains are the configs of additional chains run in the same process
+	Chains []Config `json:"-"`
+}
+
+// file is the layout of a config file, the chains are decoded separately over the defaults
+type file struct {
+	*Config
+	Chains []json.RawMessage `json:"chains"`
+}
+
+// Endpoint is an RPC endpoint, given as its URL or as an object with a load balancing weight and a rate limit
+type Endpoint struct {
+	URL string `json:"url"`
+	// Weight is the share of the requests of the endpoint with the weighted strategy
+	Weight int `json:"weight,omitempty"`
+	// RateLimit is the maximum number of requests per second, 0 does not limit the endpoint
+	RateLimit float64 `json:"rateLimit,omitempty"`
+}
+
+// RPC configures the load balancing and failover of the endpoints
+type RPC struct {
+	// Strategy is "roundRobin" or "weighted"
+	Strategy string `json:"strategy"`
+	// Hedge is the delay after which a request is also sent to the next endpoint, 0 disables hedging
+	Hedge Duration `json:"hedge"`
+	// MaxFailures is the number of consecutive failures after which an endpoint is skipped for the cooldown
+	MaxFailures int      `json:"maxFailures"`
+	Cooldown    Duration `json:"cooldown"`
+}
+
+// Multicall configures the Multicall3 contract and the gas budget of each call chunk
+type Multicall struct {
+	Address  string `json:"address"`
+	CallCost uint64 `json:"callCost"`
+	MaxGas   uint64 `json:"maxGas"`
+	// MaxResponseSize is the response size limit of a call chunk in bytes, 0 does not limit it
+	// the gas and return data size of each function are learned from past calls
+	MaxResponseSize uint64 `json:"maxResponseSize"`
+	// Parallelism is the number of call chunks sent concurrently
+	Parallelism int `json:"parallelism"`
+	// Retries is the number of retries of a failed call chunk, Backoff the delay before the first retry
+	// a chunk that still fails is split until the failing calls are isolated
+	Retries int      `json:"retries"`
+	Backoff Duration `json:"backoff"`
+	// Method is the Multicall3 function used, "aggregate3" or "tryBlockAndAggregate"
+	// which also returns the block number and hash the calls were executed against
+	Method string `json:"method"`
+}
+
+// Subscription configures the block subscription timeouts
+type Subscription struct {
+	Timeout    Duration `json:"timeout"`
+	MaxTimeout Duration `json:"maxTimeout"`
+	MaxRetries int      `json:"maxRetries"`
+}
+
+// Token is a token to import, the label is only informative
+type Token struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+}
+
+// TokenList is a token list file, or a directory of token list files, in the Uniswap token list schema
+// the tokens of the chain with any of the tags are imported with the configured tokens, no tags import every token of the chain
+type TokenList struct {
+	Path string   `json:"path"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Factories are the V2 and V3 factories to discover pools from
+type Factories struct {
+	V2 []Factory `json:"v2"`
+	V3 []Factory `json:"v3"`
+}
+
+// Factory is a DEX factory
+// SwapFee (basis points) is used by V2 factories, unset is the 30 bps Uniswap V2 fee and 0 a fee-free fork, FeeTiers (pips) by V3 factories
+type Factory struct {
+	Name     string   `json:"name"`
+	Address  string   `json:"address"`
+	InitHash string   `json:"initHash"`
+	SwapFee  *uint64  `json:"swapFee,omitempty"`
+	FeeTiers []uint64 `json:"feeTiers,omitempty"`
+}
+
+// Sync configures how the caches are kept up to date
+type Sync struct {
+	// FromLogs applies the Sync/Swap/Mint/Burn/Initialize logs of each new block
+	// instead of re-syncing every pool with multicall
+	FromLogs bool `json:"fromLogs"`
+	// CatchUpBlocks is the block range of each log query when catching up from a snapshot
+	CatchUpBlocks uint64 `json:"catchUpBlocks"`
+	// HistoryDepth is the number of synced blocks the caches can roll back on a reorg
+	HistoryDepth int `json:"historyDepth"`
+	// PoolHistory is the number of synced states kept by each pool for historical queries
+	PoolHistory int `json:"poolHistory"`
+
+	// snapshots of the caches for warm restarts, saved every SnapshotInterval blocks
+	SnapshotV2       string `json:"snapshotV2"`
+	SnapshotV3       string `json:"snapshotV3"`
+	SnapshotInterval uint64 `json:"snapshotInterval"`
+}
+
+// Server configures the HTTP/JSON query server, an empty address disables it
+type Server struct {
+	Addr string `json:"addr"`
+}
+
+// Arbitrage configures the arbitrage scanner, amounts are in the smallest unit of the base token
+type Arbitrage struct {
+	Base   string `json:"base"`
+	Symbol string `json:"symbol"`
+	Hops   int    `json:"hops"`
+	Top    int    `json:"top"`
+	Probe  Amount `json:"probe"`
+	MaxIn  Amount `json:"maxIn"`
+}
+
+// Default returns the default config of Ethereum without endpoints and tokens
+// the multicall address, factories, arbitrage base and snapshot interval are filled from the chain registry by Load
+func Default() Config {
+	return Config{
+		ChainID:   chain.Ethereum,
+		Endpoints: []Endpoint{},
+		RPC: RPC{
+			Strategy:    string(provider.RoundRobin),
+			MaxFailures: provider.DefaultMaxFailures,
+			Cooldown:    Duration(provider.DefaultCooldown),
+		},
+		Multicall: Multicall{
+			CallCost:    25_000,
+			MaxGas:      30_000_000,
+			Parallelism: generic.DefaultParallelism,
+			Retries:     generic.DefaultRetries,
+			Backoff:     Duration(generic.DefaultBackoff),
+			Method:      string(generic.Aggregate3),
+		},
+		Subscription: Subscription{
+			Timeout:    Duration(20 * time.Second),
+			MaxTimeout: Duration(30 * time.Second),
+			MaxRetries: 5,
+		},
+		Tokens:     []Token{},
+		TokenLists: []TokenList{},
+		Factories: Factories{
+			V2: []Factory{},
+			V3: []Factory{},
+		},
+		Sync: Sync{
+			FromLogs:      true,
+			CatchUpBlocks: 1_000,
+			HistoryDepth:  cache.DefaultHistoryDepth,
+			PoolHistory:   pool.DefaultHistorySize,
+			SnapshotV2:    "snapshot_v2.json",
+			SnapshotV3:    "snapshot_v3.json",
+		},
+		Server: Server{
+			Addr: ":8080",
+		},
+		Arbitrage: Arbitrage{
+			Hops: 3,
+			Top:  5,
+		},
+	}
+}
+
+// Load reads a JSON config file over the defaults, applies the environment overrides and the chain registry defaults and validates it
+// each entry of "chains" is decoded over the defaults as the config of another chain, the environment only overrides the top-level chain
+func Load(path string) (Config, error) {
+	c := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+
+	f := file{Config: &c}
+	if err := decode(data, &f); err != nil {
+		return c, errors.New(fmt.Sprintf("%s: %s", path, err))
+	}
+	if err := c.ApplyEnv(os.LookupEnv); err != nil {
+		return c, err
+	}
+	c.applyChainDefaults()
+
+	// additional chains neither share the snapshots nor the server of the top-level chain
+	c.Chains = make([]Config, 0, len(f.Chains))
+	for i, raw := range f.Chains {
+		chainConfig := Default()
+		chainConfig.ChainID = 0
+		chainConfig.Sync.SnapshotV2 = ""
+		chainConfig.Sync.SnapshotV3 = ""
+		chainConfig.Server.Addr = ""
+		if err := decode(raw, &chainConfig); err != nil {
+			return c, errors.New(fmt.Sprintf("%s: chains[%d]: %s", path, i, err))
+		}
+
+		if chainConfig.Sync.SnapshotV2 == "" {
+			chainConfig.Sync.SnapshotV2 = fmt.Sprintf("snapshot_%d_v2.json", chainConfig.ChainID)
+		}
+		if chainConfig.Sync.SnapshotV3 == "" {
+			chainConfig.Sync.SnapshotV3 = fmt.Sprintf("snapshot_%d_v3.json", chainConfig.ChainID)
+		}
+		chainConfig.applyChainDefaults()
+		c.Chains = append(c.Chains, chainConfig)
+	}
+
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// decode decodes JSON, unknown fields are rejected to catch typos
+func decode(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// applyChainDefaults fills the settings left empty with the defaults of the registered chain
+func (c *Config) applyChainDefaults() {
+	ch, ok := chain.Get(c.ChainID)
+	if !ok {
+		return
+	}
+
+	if c.Multicall.Address == "" {
+		c.Multicall.Address = ch.Multicall.Hex()
+	}
+	if len(c.Factories.V2)+len(c.Factories.V3) == 0 {
+		for _, f := range ch.V2Factories {
+			swapFee := f.SwapFee
+			c.Factories.V2 = append(c.Factories.V2, Factory{
+				Name:     f.Name,
+				Address:  f.Address.Hex(),
+				InitHash: f.InitHash.Hex(),
+				SwapFee:  &swapFee,
+			})
+		}
+		for _, f := range ch.V3Factories {
+			feeTiers := make([]uint64, len(f.FeeTypes))
+			for i, fee := range f.FeeTypes {
+				feeTiers[i] = uint64(fee)
+			}
+			c.Factories.V3 = append(c.Factories.V3, Factory{
+				Name:     f.Name,
+				Address:  f.Address.Hex(),
+				InitHash: f.InitHash.Hex(),
+				FeeTiers: feeTiers,
+			})
+		}
+	}
+	if c.Arbitrage.Base == "" {
+		c.Arbitrage.Base = ch.WrappedNative.Address.Hex()
+		if c.Arbitrage.Symbol == "" {
+			c.Arbitrage.Symbol = ch.WrappedNative.Symbol
+		}
+	}
+	if c.Sync.SnapshotInterval == 0 {
+		c.Sync.SnapshotInterval = ch.Blocks(SnapshotPeriod)
+	}
+}
+
+///
+/// Environment
+///
+
+// ApplyEnv overrides the config with the environment variables returned by lookup
+// lists are comma separated and replace the configured lists
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	overrides := []struct {
+		name  string
+		apply func(string) error
+	}{
+		{"CHAIN_ID", func(v string) (err error) { c.ChainID, err = strconv.ParseUint(v, 10, 64); return }},
+		{"ENDPOINTS", func(v string) error {
+			c.Endpoints = make([]Endpoint, 0)
+			for _, url := range splitList(v) {
+				c.Endpoints = append(c.Endpoints, Endpoint{URL: url})
+			}
+			return nil
+		}},
+		{"RPC_STRATEGY", func(v string) error { c.RPC.Strategy = v; return nil }},
+		{"RPC_HEDGE", func(v string) error { return c.RPC.Hedge.parse(v) }},
+		{"MULTICALL_ADDRESS", func(v string) error { c.Multicall.Address = v; return nil }},
+		{"MULTICALL_CALL_COST", func(v string) (err error) { c.Multicall.CallCost, err = strconv.ParseUint(v, 10, 64); return }},
+		{"MULTICALL_MAX_GAS", func(v string) (err error) { c.Multicall.MaxGas, err = strconv.ParseUint(v, 10, 64); return }},
+		{"MULTICALL_MAX_RESPONSE_SIZE", func(v string) (err error) { c.Multicall.MaxResponseSize, err = strconv.ParseUint(v, 10, 64); return }},
+		{"MULTICALL_PARALLELISM", func(v string) (err error) { c.Multicall.Parallelism, err = strconv.Atoi(v); return }},
+		{"MULTICALL_RETRIES", func(v string) (err error) { c.Multicall.Retries, err = strconv.Atoi(v); return }},
+		{"MULTICALL_BACKOFF", func(v string) error { return c.Multicall.Backoff.parse(v) }},
+		{"MULTICALL_METHOD", func(v string) error { c.Multicall.Method = v; return nil }},
+		{"SUBSCRIPTION_TIMEOUT", func(v string) error { return c.Subscription.Timeout.parse(v) }},
+		{"SUBSCRIPTION_MAX_TIMEOUT", func(v string) error { return c.Subscription.MaxTimeout.parse(v) }},
+		{"SUBSCRIPTION_MAX_RETRIES", func(v string) (err error) { c.Subscription.MaxRetries, err = strconv.Atoi(v); return }},
+		{"TOKENS", func(v string) error {
+			c.Tokens = make([]Token, 0)
+			for _, address := range splitList(v) {
+				c.Tokens = append(c.Tokens, Token{Address: address})
+			}
+			return nil
+		}},
+		{"TOKEN_LISTS", func(v string) error {
+			c.TokenLists = make([]TokenList, 0)
+			for _, path := range splitList(v) {
+				c.TokenLists = append(c.TokenLists, TokenList{Path: path})
+			}
+			return nil
+		}},
+		{"SYNC_FROM_LOGS", func(v string) (err error) { c.Sync.FromLogs, err = strconv.ParseBool(v); return }},
+		{"SERVER_ADDR", func(v string) error { c.Server.Addr = v; return nil }},
+	}
+
+	for _, o := range overrides {
+		value, ok := lookup(EnvPrefix + o.name)
+		if !ok {
+			continue
+		}
+		if err := o.apply(value); err != nil {
+			return errors.New(fmt.Sprintf("%s%s: invalid value %q", EnvPrefix, o.name, value))
+		}
+	}
+
+	return nil
+}
+
+///
+/// Validation
+///
+
+// Validate checks the config and the configs of the additional chains and returns every invalid field
+func (c Config) Validate() error {
+	errs := c.validate("")
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, errors.New(fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...))))
+	}
+
+	// chains run side by side, they must not share a chain id, snapshot or listen address
+	chainIDs := map[uint64]string{c.ChainID: "chainId"}
+	paths := map[string]string{c.Sync.SnapshotV2: "sync.snapshotV2", c.Sync.SnapshotV3: "sync.snapshotV3"}
+	addrs := map[string]string{c.Server.Addr: "server.addr"}
+	for i, chainConfig := range c.Chains {
+		prefix := fmt.Sprintf("chains[%d].", i)
+		errs = append(errs, chainConfig.validate(prefix)...)
+
+		if field, ok := chainIDs[chainConfig.ChainID]; ok {
+			fail(prefix+"chainId", "duplicate of %s (%d)", field, chainConfig.ChainID)
+		}
+		chainIDs[chainConfig.ChainID] = prefix + "chainId"
+		for _, path := range []struct{ field, value string }{{"sync.snapshotV2", chainConfig.Sync.SnapshotV2}, {"sync.snapshotV3", chainConfig.Sync.SnapshotV3}} {
+			if field, ok := paths[path.value]; ok {
+				fail(prefix+path.field, "same path as %s (%s)", field, path.value)
+			}
+			paths[path.value] = prefix + path.field
+		}
+		if field, ok := addrs[chainConfig.Server.Addr]; ok && chainConfig.Server.Addr != "" {
+			fail(prefix+"server.addr", "same address as %s (%s)", field, chainConfig.Server.Addr)
+		}
+		addrs[chainConfig.Server.Addr] = prefix + "server.addr"
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the config of one chain, the fields are prefixed by the path of the chain
+func (c Config) validate(prefix string) []error {
+	errs := make([]error, 0)
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, errors.New(fmt.Sprintf("%s%s: %s", prefix, field, fmt.Sprintf(format, args...))))
+	}
+
+	// chain, rpc & multicall
+	if c.ChainID == 0 {
+		fail("chainId", "must be positive")
+	}
+	if len(c.Endpoints) == 0 {
+		fail("endpoints", "at least one RPC endpoint is required")
+	}
+	for i, endpoint := range c.Endpoints {
+		if !strings.Contains(endpoint.URL, "://") {
+			fail(fmt.Sprintf("endpoints[%d]", i), "invalid endpoint %q (expected a ws(s):// or http(s):// URL)", endpoint.URL)
+		}
+		if endpoint.Weight < 0 {
+			fail(fmt.Sprintf("endpoints[%d].weight", i), "must not be negative")
+		}
+		if endpoint.RateLimit < 0 {
+			fail(fmt.Sprintf("endpoints[%d].rateLimit", i), "must not be negative")
+		}
+	}
+	if strategy := provider.Strategy(c.RPC.Strategy); strategy != provider.RoundRobin && strategy != provider.Weighted {
+		fail("rpc.strategy", "unknown strategy %q (expected %q or %q)", c.RPC.Strategy, provider.RoundRobin, provider.Weighted)
+	}
+	if c.RPC.Hedge < 0 {
+		fail("rpc.hedge", "must not be negative")
+	}
+	if c.RPC.MaxFailures <= 0 {
+		fail("rpc.maxFailures", "must be positive")
+	}
+	if c.RPC.Cooldown < 0 {
+		fail("rpc.cooldown", "must not be negative")
+	}
+	if !isAddress(c.Multicall.Address) {
+		fail("multicall.address", "invalid address %q", c.Multicall.Address)
+	}
+	if c.Multicall.CallCost == 0 {
+		fail("multicall.callCost", "must be positive")
+	}
+	if c.Multicall.MaxGas < c.Multicall.CallCost {
+		fail("multicall.maxGas", "must be at least multicall.callCost (%d)", c.Multicall.CallCost)
+	}
+	if c.Multicall.Parallelism <= 0 {
+		fail("multicall.parallelism", "must be positive")
+	}
+	if c.Multicall.Retries < 0 {
+		fail("multicall.retries", "must not be negative")
+	}
+	if c.Multicall.Backoff < 0 {
+		fail("multicall.backoff", "must not be negative")
+	}
+	if method := generic.Method(c.Multicall.Method); method != generic.Aggregate3 && method != generic.TryBlockAndAggregate {
+		fail("multicall.method", "unknown method %q (expected %q or %q)", c.Multicall.Method, generic.Aggregate3, generic.TryBlockAndAggregate)
+	}
+
+	// subscription
+	if c.Subscription.Timeout <= 0 {
+		fail("subscription.timeout", "must be positive")
+	}
+	if c.Subscription.MaxTimeout < c.Subscription.Timeout {
+		fail("subscription.maxTimeout", "must be at least subscription.timeout (%s)", c.Subscription.Timeout)
+	}
+	if c.Subscription.MaxRetries < 0 {
+		fail("subscription.maxRetries", "must not be negative")
+	}
+
+	// tokens
+	if len(c.Tokens)+len(c.TokenLists) == 0 {
+		fail("tokens", "at least one token or token list is required")
+	}
+	seen := make(map[common.Address]int)
+	for i, t := range c.Tokens {
+		field := fmt.Sprintf("tokens[%d]", i)
+		if !isAddress(t.Address) {
+			fail(field, "invalid address %q", t.Address)
+			continue
+		}
+		if j, ok := seen[common.HexToAddress(t.Address)]; ok {
+			fail(field, "duplicate of tokens[%d] (%s)", j, t.Address)
+		}
+		seen[common.HexToAddress(t.Address)] = i
+	}
+
+	for i, l := range c.TokenLists {
+		if l.Path == "" {
+			fail(fmt.Sprintf("tokenLists[%d].path", i), "path is required")
+		}
+	}
+
+	// factories
+	if len(c.Factories.V2)+len(c.Factories.V3) == 0 {
+		fail("factories", "at least one V2 or V3 factory is required")
+	}
+	for i, f := range c.Factories.V2 {
+		field := fmt.Sprintf("factories.v2[%d]", i)
+		f.validate(field, fail)
+		if f.SwapFee != nil && *f.SwapFee >= uniswap.FeeDenominator {
+			fail(field+".swapFee", "must be below %d basis points", uniswap.FeeDenominator)
+		}
+		if len(f.FeeTiers) > 0 {
+			fail(field+".feeTiers", "only used by V3 factories")
+		}
+	}
+	for i, f := range c.Factories.V3 {
+		field := fmt.Sprintf("factories.v3[%d]", i)
+		f.validate(field, fail)
+		if len(f.FeeTiers) == 0 {
+			fail(field+".feeTiers", "at least one fee tier is required")
+		}
+		for j, fee := range f.FeeTiers {
+			if fee == 0 || fee >= uniswap.FeePipsDenominator {
+				fail(fmt.Sprintf("%s.feeTiers[%d]", field, j), "must be between 1 and %d pips", uniswap.FeePipsDenominator-1)
+			}
+		}
+		if f.SwapFee != nil {
+			fail(field+".swapFee", "only used by V2 factories, use feeTiers")
+		}
+	}
+
+	// sync & server
+	if c.Sync.CatchUpBlocks == 0 {
+		fail("sync.catchUpBlocks", "must be positive")
+	}
+	if c.Sync.HistoryDepth <= 0 {
+		fail("sync.historyDepth", "must be positive")
+	}
+	if c.Sync.PoolHistory < 0 {
+		fail("sync.poolHistory", "must not be negative")
+	}
+	if c.Sync.SnapshotInterval == 0 {
+		fail("sync.snapshotInterval", "must be positive")
+	}
+	if c.Sync.SnapshotV2 == "" || c.Sync.SnapshotV2 == c.Sync.SnapshotV3 {
+		fail("sync.snapshotV2", "must be a path different from sync.snapshotV3")
+	}
+	// arbitrage
+	if !isAddress(c.Arbitrage.Base) {
+		fail("arbitrage.base", "invalid address %q", c.Arbitrage.Base)
+	}
+	if c.Arbitrage.Hops < 2 {
+		fail("arbitrage.hops", "cycles need at least 2 hops")
+	}
+	if c.Arbitrage.Probe.Int().Sign() <= 0 || c.Arbitrage.MaxIn.Int().Cmp(c.Arbitrage.Probe.Int()) < 0 {
+		fail("arbitrage.maxIn", "must be at least arbitrage.probe, which must be positive")
+	}
+
+	return errs
+}
+
+// validate checks the fields shared by V2 and V3 factories
+func (f Factory) validate(field string, fail func(string, string, ...any)) {
+	if f.Name == "" {
+		fail(field+".name", "name is required")
+	}
+	if !isAddress(f.Address) {
+		fail(field+".address", "invalid address %q", f.Address)
+	}
+	if hash, err := hexutil.Decode(f.InitHash); err != nil || len(hash) != common.HashLength || common.BytesToHash(hash) == (common.Hash{}) {
+		fail(field+".initHash", "invalid init code hash %q", f.InitHash)
+	}
+}
+
+///
+/// Conversions
+///
+
+// Name returns the name of the chain
+func (c Config) Name() string {
+	return chain.Name(c.ChainID)
+}
+
+// All returns the config of the top-level chain followed by the configs of the additional chains
+func (c Config) All() []Config {
+	top := c
+	top.Chains = nil
+	return append([]Config{top}, c.Chains...)
+}
+
+// Chain returns the config of a chain id
+func (c Config) Chain(id uint64) (Config, bool) {
+	for _, chainConfig := range c.All() {
+		if chainConfig.ChainID == id {
+			return chainConfig, true
+		}
+	}
+	return Config{}, false
+}
+
+// TokenAddresses returns the addresses of the configured tokens
+func (c Config) TokenAddresses() []common.Address {
+	addresses := make([]common.Address, len(c.Tokens))
+	for i, t := range c.Tokens {
+		addresses[i] = common.HexToAddress(t.Address)
+	}
+	return addresses
+}
+
+// V2Factories returns the configured V2 factories
+func (c Config) V2Factories() []factory.Factory[any] {
+	factories := make([]factory.Factory[any], len(c.Factories.V2))
+	for i, f := range c.Factories.V2 {
+		// factories without a fee charge the Uniswap V2 fee
+		swapFee := uint64(uniswap.DefaultSwapFee)
+		if f.SwapFee != nil {
+			swapFee = *f.SwapFee
+		}
+		factories[i] = factory.Factory[any]{
+			Name:     f.Name,
+			Address:  common.HexToAddress(f.Address),
+			InitHash: common.HexToHash(f.InitHash),
+			SwapFee:  swapFee,
+		}
+	}
+	return factories
+}
+
+// V3Factories returns the configured V3 factories
+func (c Config) V3Factories() []factory.Factory[uniswap.V3FeeType] {
+	factories := make([]factory.Factory[uniswap.V3FeeType], len(c.Factories.V3))
+	for i, f := range c.Factories.V3 {
+		feeTypes := make([]uniswap.V3FeeType, len(f.FeeTiers))
+		for j, fee := range f.FeeTiers {
+			feeTypes[j] = uniswap.V3FeeType(fee)
+		}
+		factories[i] = factory.Factory[uniswap.V3FeeType]{
+			Name:     f.Name,
+			Address:  common.HexToAddress(f.Address),
+			InitHash: common.HexToHash(f.InitHash),
+			FeeTypes: feeTypes,
+		}
+	}
+	return factories
+}
+
+///
+/// Utils
+///
+
+// MarshalJSON encodes endpoints without options as their URL
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	if e.Weight == 0 && e.RateLimit == 0 {
+		return json.Marshal(e.URL)
+	}
+	type endpoint Endpoint
+	return json.Marshal(endpoint(e))
+}
+
+// UnmarshalJSON decodes an endpoint URL or an endpoint object
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*e = Endpoint{}
+		return json.Unmarshal(data, &e.URL)
+	}
+	type endpoint Endpoint
+	return decode(data, (*endpoint)(e))
+}
+
+// Duration is a time.Duration encoded as a string (e.g. "20s")
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New(fmt.Sprintf("invalid duration %s (expected a string such as \"20s\")", data))
+	}
+	return d.parse(s)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// parse parses a duration string
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Amount is an integer token amount encoded as a decimal string (e.g. "100000000000000000000" for 100 WETH)
+// amounts of 18 decimal tokens quickly exceed uint64, plain JSON integers are accepted too
+type Amount big.Int
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.Int().String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(bytes.Trim(bytes.TrimSpace(data), `"`))
+	if err := a.parse(s); err != nil {
+		return errors.New(fmt.Sprintf("invalid amount %s (expected a decimal string such as \"1000000\")", data))
+	}
+	return nil
+}
+
+// Int returns a copy of the amount
+func (a Amount) Int() *big.Int {
+	v := big.Int(a)
+	return new(big.Int).Set(&v)
+}
+
+// parse parses a decimal amount
+func (a *Amount) parse(s string) error {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() < 0 {
+		return errors.New(fmt.Sprintf("invalid amount %q", s))
+	}
+	*a = Amount(*v)
+	return nil
+}
+
+// isAddress returns true for 0x prefixed hex addresses
+func isAddress(s string) bool {
+	return strings.HasPrefix(s, "0x") && common.IsHexAddress(s)
+}
+
+// splitList splits a comma separated list and drops empty items
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
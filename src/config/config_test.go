@@ -0,0 +1,294 @@
+package config_test
+
+import (
+	"PoolHelper/src/chain"
+	"PoolHelper/src/config"
+	"PoolHelper/src/pool/uniswap"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file to a temporary directory
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_RepoConfig(t *testing.T) {
+	c, err := config.Load("../../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.TokenAddresses()) != 49 || len(c.V2Factories()) != 3 || len(c.V3Factories()) != 1 {
+		t.Errorf("wrong number of tokens or factories")
+	}
+	if f := c.V3Factories()[0]; f.Address != common.HexToAddress("0x1f98431c8ad98523631ae4a59f267346ea31f984") || len(f.FeeTypes) != 4 || f.FeeTypes[1] != uniswap.LOW {
+		t.Errorf("wrong V3 factory: %+v", f)
+	}
+	if f := c.V2Factories()[0]; f.SwapFee != 30 || !f.IsValid() {
+		t.Errorf("wrong V2 factory: %+v", f)
+	}
+	if time.Duration(c.Subscription.Timeout) != 20*time.Second {
+		t.Errorf("wrong timeout: %s", c.Subscription.Timeout)
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	path := writeConfig(t, `{
+		"endpoints": ["wss://localhost:8546"],
+		"tokens": [{"address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}],
+		"factories": {"v2": [
+			{"name": "Uniswap V2", "address": "0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f", "initHash": "0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"},
+			{"name": "Fee-free fork", "address": "0xc0aee478e3658e2610c5f7a4a2e1777ce9e4f2ac", "initHash": "0xe18a34eb0e04b04f7a0ac29a6e80748dca96319b42c520edd6b41f2f7a8b0bbe", "swapFee": 0}
+		]},
+		"arbitrage": {"base": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "probe": "1000000000000000000", "maxIn": "100000000000000000000"}
+	}`)
+
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Multicall.MaxGas != config.Default().Multicall.MaxGas || c.Server.Addr != ":8080" || !c.Sync.FromLogs {
+		t.Errorf("defaults not applied: %+v", c)
+	}
+
+	// amounts above uint64 are kept, invalid amounts are rejected
+	if c.Arbitrage.MaxIn.Int().String() != "100000000000000000000" || c.Arbitrage.Probe.Int().Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("wrong arbitrage amounts: %v %v", c.Arbitrage.Probe.Int(), c.Arbitrage.MaxIn.Int())
+	}
+	if _, err := config.Load(writeConfig(t, `{"arbitrage": {"probe": "1e18"}}`)); err == nil || !strings.Contains(err.Error(), "invalid amount") {
+		t.Errorf("expected an invalid amount, got %v", err)
+	}
+
+	// an unset swap fee is the Uniswap V2 fee, a zero fee is kept
+	if factories := c.V2Factories(); factories[0].SwapFee != uniswap.DefaultSwapFee || factories[1].SwapFee != 0 {
+		t.Errorf("wrong swap fees: %+v", factories)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	path := writeConfig(t, `{
+		"endpoints": ["localhost", {"url": "wss://localhost:8546", "weight": -1, "rateLimit": -1}],
+		"rpc": {"strategy": "random", "maxFailures": 0},
+		"multicall": {"address": "0x01", "callCost": 0, "maxGas": 1, "parallelism": 0, "retries": -1, "method": "aggregate"},
+		"tokens": [{"address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}, {"address": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"}],
+		"tokenLists": [{"path": "", "tags": ["stablecoin"]}],
+		"factories": {
+			"v2": [{"name": "", "address": "0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f", "initHash": "0x01", "swapFee": 10000}],
+			"v3": [{"name": "Uniswap V3", "address": "0x1f98431c8ad98523631ae4a59f267346ea31f984", "initHash": "0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"}]
+		},
+		"arbitrage": {"base": "0x01", "hops": 1}
+	}`)
+
+	_, err := config.Load(path)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{
+		"endpoints[0]",
+		"endpoints[1].weight",
+		"endpoints[1].rateLimit",
+		"rpc.strategy",
+		"rpc.maxFailures",
+		"multicall.address",
+		"multicall.callCost",
+		"multicall.parallelism",
+		"multicall.retries",
+		"multicall.method",
+		"tokens[1]: duplicate of tokens[0]",
+		"tokenLists[0].path",
+		"factories.v2[0].name",
+		"factories.v2[0].initHash",
+		"factories.v2[0].swapFee",
+		"factories.v3[0].feeTiers",
+		"arbitrage.base",
+		"arbitrage.hops",
+		"arbitrage.maxIn",
+	} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("missing error for %s in:\n%s", field, err)
+		}
+	}
+}
+
+func TestLoad_Endpoints(t *testing.T) {
+	path := writeConfig(t, `{
+		"endpoints": ["wss://a", {"url": "https://b", "weight": 3, "rateLimit": 25}],
+		"rpc": {"strategy": "weighted", "hedge": "200ms"},
+		"tokens": [{"address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}],
+		"arbitrage": {"base": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "probe": 1, "maxIn": 2}
+	}`)
+
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Endpoints) != 2 || c.Endpoints[0].URL != "wss://a" || c.Endpoints[1].Weight != 3 || c.Endpoints[1].RateLimit != 25 {
+		t.Errorf("wrong endpoints: %+v", c.Endpoints)
+	}
+	if time.Duration(c.RPC.Hedge) != 200*time.Millisecond || c.RPC.MaxFailures != config.Default().RPC.MaxFailures {
+		t.Errorf("wrong rpc config: %+v", c.RPC)
+	}
+
+	// options are rejected if unknown, endpoints without options encode as their url
+	if _, err := config.Load(writeConfig(t, `{"endpoints": [{"url": "wss://a", "weigth": 1}]}`)); err == nil || !strings.Contains(err.Error(), `unknown field "weigth"`) {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+	if data, err := json.Marshal(c.Endpoints); err != nil || string(data) != `["wss://a",{"url":"https://b","weight":3,"rateLimit":25}]` {
+		t.Errorf("wrong encoding: %s %v", data, err)
+	}
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := writeConfig(t, `{"endpoint": "wss://localhost:8546"}`)
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), `unknown field "endpoint"`) {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"POOLHELPER_ENDPOINTS":            "wss://a, wss://b",
+		"POOLHELPER_MULTICALL_MAX_GAS":    "15000000",
+		"POOLHELPER_SUBSCRIPTION_TIMEOUT": "5s",
+		"POOLHELPER_TOKENS":               "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48,0xdac17f958d2ee523a2206206994597c13d831ec7",
+		"POOLHELPER_TOKEN_LISTS":          "tokenlists",
+		"POOLHELPER_SYNC_FROM_LOGS":       "false",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	c := config.Default()
+	if err := c.ApplyEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Endpoints) != 2 || c.Endpoints[1].URL != "wss://b" {
+		t.Errorf("wrong endpoints: %v", c.Endpoints)
+	}
+	if c.Multicall.MaxGas != 15_000_000 || time.Duration(c.Subscription.Timeout) != 5*time.Second || c.Sync.FromLogs {
+		t.Errorf("overrides not applied: %+v", c)
+	}
+	if len(c.TokenAddresses()) != 2 || len(c.TokenLists) != 1 || c.TokenLists[0].Path != "tokenlists" {
+		t.Errorf("wrong tokens: %v %v", c.Tokens, c.TokenLists)
+	}
+
+	env["POOLHELPER_MULTICALL_CALL_COST"] = "lots"
+	if err := c.ApplyEnv(lookup); err == nil || !strings.Contains(err.Error(), "POOLHELPER_MULTICALL_CALL_COST") {
+		t.Errorf("expected invalid override error, got %v", err)
+	}
+}
+
+func TestLoad_ChainDefaults(t *testing.T) {
+	path := writeConfig(t, `{
+		"chainId": 8453,
+		"endpoints": ["wss://localhost:8546"],
+		"tokens": [{"address": "0x833589fcd6edb6e08f4c7c32d4f71b54bda02913"}],
+		"arbitrage": {"probe": 1, "maxIn": 2}
+	}`)
+
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != "base" || c.Multicall.Address != chain.Multicall3.Hex() || c.Sync.SnapshotInterval != 600 {
+		t.Errorf("registry defaults not applied: %+v", c)
+	}
+	if len(c.V2Factories()) != 1 || len(c.V3Factories()) != 1 || c.V3Factories()[0].Address != common.HexToAddress("0x33128a8fC17869897dcE68Ed026d694621f6FDfD") {
+		t.Errorf("wrong default factories: %+v", c.Factories)
+	}
+	if c.Arbitrage.Base != "0x4200000000000000000000000000000000000006" || c.Arbitrage.Symbol != "WETH" {
+		t.Errorf("wrong default arbitrage base: %+v", c.Arbitrage)
+	}
+}
+
+func TestLoad_Chains(t *testing.T) {
+	path := writeConfig(t, `{
+		"endpoints": ["wss://localhost:8546"],
+		"tokens": [{"address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}],
+		"arbitrage": {"probe": 1, "maxIn": 2},
+		"chains": [
+			{
+				"chainId": 42161,
+				"endpoints": ["wss://localhost:8547"],
+				"tokens": [{"address": "0xaf88d065e77c8cc2239327c5edb3a432268e5831"}],
+				"server": {"addr": ":8081"},
+				"arbitrage": {"probe": 1, "maxIn": 2}
+			}
+		]
+	}`)
+
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := c.All()
+	if len(all) != 2 || all[0].ChainID != chain.Ethereum || len(all[0].Chains) != 0 || all[1].Name() != "arbitrum" {
+		t.Fatalf("wrong chains: %+v", all)
+	}
+	arbitrum, ok := c.Chain(chain.Arbitrum)
+	if !ok || arbitrum.Sync.SnapshotV2 != "snapshot_42161_v2.json" || arbitrum.Server.Addr != ":8081" || arbitrum.Sync.SnapshotInterval != 4800 {
+		t.Errorf("wrong arbitrum config: %+v", arbitrum)
+	}
+	if arbitrum.Multicall.MaxGas != config.Default().Multicall.MaxGas || arbitrum.Arbitrage.Hops != 3 {
+		t.Errorf("defaults not applied to arbitrum: %+v", arbitrum)
+	}
+}
+
+func TestLoad_ChainErrors(t *testing.T) {
+	path := writeConfig(t, `{
+		"endpoints": ["wss://localhost:8546"],
+		"tokens": [{"address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}],
+		"arbitrage": {"probe": 1, "maxIn": 2},
+		"chains": [
+			{
+				"chainId": 1,
+				"endpoints": ["wss://localhost:8547"],
+				"tokens": [{"address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}],
+				"sync": {"snapshotV2": "snapshot_v2.json"},
+				"server": {"addr": ":8080"},
+				"arbitrage": {"probe": 1, "maxIn": 2}
+			},
+			{
+				"chainId": 10,
+				"endpoints": ["wss://localhost:8548"],
+				"tokens": [{"address": "0x0b2c639c533813f4aa9d7837caf62653d097ff85"}]
+			}
+		]
+	}`)
+
+	_, err := config.Load(path)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{
+		"chains[0].chainId: duplicate of chainId",
+		"chains[0].sync.snapshotV2: same path as sync.snapshotV2",
+		"chains[0].server.addr: same address as server.addr",
+		"chains[1].multicall.address",
+		"chains[1].factories",
+		"chains[1].sync.snapshotInterval",
+		"chains[1].arbitrage.base",
+	} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("missing error for %s in:\n%s", field, err)
+		}
+	}
+
+	// chains can not be nested
+	path = writeConfig(t, `{"chains": [{"chains": []}]}`)
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), `chains[0]: json: unknown field "chains"`) {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
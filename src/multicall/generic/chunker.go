@@ -0,0 +1,254 @@
+package generic
+
+import (
+	"sync"
+)
+
+///
+/// Chunker
+///
+
+// DefaultGasSamples is the number of gas estimations of a function before its learned gas is trusted
+const DefaultGasSamples = 3
+
+// txGas is the intrinsic gas of a transaction, it is not spent by the calls of a chunk
+const txGas = 21_000
+
+// resultSize is the ABI encoding size of an aggregate3 result without its return data
+// (offset, success flag and return data length)
+const resultSize = 32 * 3
+
+// learnRate is the weight of a new observation in the learned averages
+const learnRate = 0.2
+
+// gasTarget is the share of the gas limit chunks are packed to in percent,
+// the rest is headroom for calls that use more gas than estimated
+const gasTarget = 85
+
+// Chunker splits calls into chunks that fit the gas and response size limits
+// it learns the gas use and return data size of each function selector from past calls,
+// calls without observations cost the fixed call cost and return no data
+type Chunker struct {
+	m               sync.Mutex
+	callCost        uint64
+	maxGas          uint64
+	maxResponseSize uint64
+	stats           map[[4]byte]*callStats
+}
+
+// callStats are the learned averages of a function selector
+type callStats struct {
+	gas         float64
+	gasSamples  int
+	size        float64
+	sizeSamples int
+}
+
+// NewChunker creates a chunker, a maxResponseSize of 0 does not limit the response size
+func NewChunker(callCost uint64, maxGas uint64, maxResponseSize uint64) *Chunker {
+	return &Chunker{
+		callCost:        callCost,
+		maxGas:          maxGas,
+		maxResponseSize: maxResponseSize,
+		stats:           make(map[[4]byte]*callStats),
+	}
+}
+
+// SetMaxResponseSize sets the response size limit of a chunk in bytes, 0 does not limit it
+func (c *Chunker) SetMaxResponseSize(size uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.maxResponseSize = size
+}
+
+// Split splits the calls into chunks up to the gas target, keeping the call order
+func (c *Chunker) Split(calls []Call3) [][]Call3 {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	maxGas := max(c.maxGas*gasTarget/100, 1)
+	callChunks := make([][]Call3, 0)
+	callChunk := make([]Call3, 0)
+	callChunkGas, callChunkSize := uint64(0), uint64(0)
+
+	for _, call := range calls {
+		gas, size := c.estimate(call)
+
+		// check if adding this call would exceed the limits of the chunk
+		exceedsGas := callChunkGas+gas > maxGas
+		exceedsSize := c.maxResponseSize > 0 && callChunkSize+size > c.maxResponseSize
+		if len(callChunk) > 0 && (exceedsGas || exceedsSize) {
+			// if it exceeds, start a new chunk
+			callChunks = append(callChunks, callChunk)
+			callChunk = make([]Call3, 0)
+			callChunkGas, callChunkSize = 0, 0
+		}
+
+		// add call to the current chunk and update the estimates
+		callChunk = append(callChunk, call)
+		callChunkGas += gas
+		callChunkSize += size
+	}
+
+	// add the last chunk if it contains any calls
+	if len(callChunk) > 0 {
+		callChunks = append(callChunks, callChunk)
+	}
+
+	return callChunks
+}
+
+// Estimate returns the estimated gas and response size of a call
+// the gas of the call takes precedence over the learned gas
+func (c *Chunker) Estimate(call Call3) (uint64, uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.estimate(call)
+}
+
+// estimate is Estimate without locking
+func (c *Chunker) estimate(call Call3) (uint64, uint64) {
+	gas, size := c.callCost, uint64(resultSize)
+	stats, ok := c.stats[selector(call)]
+	if ok && stats.gasSamples > 0 {
+		gas = uint64(stats.gas)
+	}
+	if ok && stats.sizeSamples > 0 {
+		size += uint64(stats.size)
+	}
+	if call.Gas > 0 {
+		gas = call.Gas
+	}
+	return max(gas, 1), size
+}
+
+// NeedsGasSample returns true if the gas of a function in the chunk is not learned yet
+func (c *Chunker) NeedsGasSample(callChunk []Call3) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, call := range callChunk {
+		if c.needsGasSample(call) {
+			return true
+		}
+	}
+	return false
+}
+
+// GasSamples returns the calls of each function in the chunk whose gas is not learned yet,
+// grouped by function so the gas of a group is the gas of its function alone
+func (c *Chunker) GasSamples(callChunk []Call3) [][]Call3 {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	samples, index := make([][]Call3, 0), make(map[[4]byte]int)
+	for _, call := range callChunk {
+		if !c.needsGasSample(call) {
+			continue
+		}
+		i, ok := index[selector(call)]
+		if !ok {
+			i = len(samples)
+			index[selector(call)] = i
+			samples = append(samples, nil)
+		}
+		samples[i] = append(samples[i], call)
+	}
+	return samples
+}
+
+// needsGasSample is NeedsGasSample of a single call without locking
+func (c *Chunker) needsGasSample(call Call3) bool {
+	if call.Gas > 0 {
+		return false
+	}
+	stats, ok := c.stats[selector(call)]
+	return !ok || stats.gasSamples < DefaultGasSamples
+}
+
+// ObserveGas learns the gas used by a chunk, split over its calls by their current estimates
+// the split is only exact for chunks of a single function, such as the groups of GasSamples
+func (c *Chunker) ObserveGas(callChunk []Call3, gasUsed uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if gasUsed <= txGas || len(callChunk) == 0 {
+		return
+	}
+
+	total := uint64(0)
+	for _, call := range callChunk {
+		gas, _ := c.estimate(call)
+		total += gas
+	}
+
+	// one observation of the average share of each function
+	shares, counts := make(map[[4]byte]float64), make(map[[4]byte]int)
+	for _, call := range callChunk {
+		if call.Gas > 0 {
+			continue
+		}
+		gas, _ := c.estimate(call)
+		shares[selector(call)] += float64(gasUsed-txGas) * float64(gas) / float64(total)
+		counts[selector(call)]++
+	}
+	for _, call := range callChunk {
+		if n := counts[selector(call)]; n > 0 {
+			c.statsOf(call).observeGas(shares[selector(call)] / float64(n))
+			counts[selector(call)] = 0
+		}
+	}
+}
+
+// ObserveResults learns the return data sizes of the calls of a chunk
+func (c *Chunker) ObserveResults(callChunk []Call3, results []Result) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for i := 0; i < len(callChunk) && i < len(results); i++ {
+		if results[i].Err == nil {
+			c.statsOf(callChunk[i]).observeSize(float64(len(results[i].ReturnData)))
+		}
+	}
+}
+
+// statsOf returns the learned averages of the function of a call
+func (c *Chunker) statsOf(call Call3) *callStats {
+	key := selector(call)
+	stats, ok := c.stats[key]
+	if !ok {
+		stats = &callStats{}
+		c.stats[key] = stats
+	}
+	return stats
+}
+
+// observeGas adds a gas observation, the first observation replaces the default
+func (s *callStats) observeGas(gas float64) {
+	if s.gasSamples == 0 {
+		s.gas = gas
+	} else {
+		s.gas += learnRate * (gas - s.gas)
+	}
+	s.gasSamples++
+}
+
+// observeSize adds a return data size observation, sizes are rounded up to words
+func (s *callStats) observeSize(size float64) {
+	size = float64((uint64(size) + 31) / 32 * 32)
+	if s.sizeSamples == 0 {
+		s.size = size
+	} else {
+		s.size += learnRate * (size - s.size)
+	}
+	s.sizeSamples++
+}
+
+// selector returns the function selector of a call
+func selector(call Call3) [4]byte {
+	var sel [4]byte
+	copy(sel[:], call.CallData)
+	return sel
+}
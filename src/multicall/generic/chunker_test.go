@@ -0,0 +1,109 @@
+package generic_test
+
+import (
+	"PoolHelper/src/multicall/generic"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+// selectorCalls creates n calls of a function selector
+func selectorCalls(n int, sel byte, gas uint64) []generic.Call3 {
+	calls := make([]generic.Call3, n)
+	for i := range calls {
+		calls[i] = generic.Call3{Target: common.HexToAddress("0x01"), CallData: []byte{sel, 0, 0, 0}, Gas: gas}
+	}
+	return calls
+}
+
+func TestChunker_Split(t *testing.T) {
+	// chunks are packed to 85% of the gas limit, 1,020 gas
+	c := generic.NewChunker(100, 1_200, 0)
+
+	// calls without estimates cost the call cost
+	if chunks := c.Split(selectorCalls(25, 1, 0)); len(chunks) != 3 || len(chunks[0]) != 10 {
+		t.Errorf("wrong chunks: %v", len(chunks))
+	}
+
+	// the gas estimate of a call takes precedence
+	if chunks := c.Split(selectorCalls(25, 1, 50)); len(chunks) != 2 || len(chunks[0]) != 20 {
+		t.Errorf("wrong chunks with estimates: %v", len(chunks))
+	}
+
+	// a call above the gas limit gets its own chunk
+	if chunks := c.Split(selectorCalls(2, 1, 5_000)); len(chunks) != 2 {
+		t.Errorf("wrong chunks of expensive calls: %v", len(chunks))
+	}
+}
+
+func TestChunker_Learn(t *testing.T) {
+	c := generic.NewChunker(100, 1_200, 0)
+	calls := selectorCalls(10, 1, 0)
+
+	// 10 calls used 21,000 + 250 gas, 25 each
+	if !c.NeedsGasSample(calls) {
+		t.Errorf("expected a gas sample")
+	}
+	c.ObserveGas(calls, 21_250)
+	if gas, _ := c.Estimate(calls[0]); gas != 25 {
+		t.Errorf("wrong learned gas: %v", gas)
+	}
+	if chunks := c.Split(selectorCalls(80, 1, 0)); len(chunks) != 2 || len(chunks[0]) != 40 {
+		t.Errorf("wrong chunks with learned gas: %v", len(chunks))
+	}
+
+	// other functions are not affected
+	if gas, _ := c.Estimate(selectorCalls(1, 2, 0)[0]); gas != 100 {
+		t.Errorf("wrong default gas: %v", gas)
+	}
+
+	// functions are sampled until enough observations are made
+	c.ObserveGas(calls, 21_250)
+	c.ObserveGas(calls, 21_250)
+	if c.NeedsGasSample(calls) {
+		t.Errorf("expected no gas sample")
+	}
+
+	// learned return data sizes limit the response size, 96 bytes per result and 3 words of return data
+	results := make([]generic.Result, len(calls))
+	for i := range results {
+		results[i].ReturnData = make([]byte, 96)
+	}
+	c.ObserveResults(calls, results)
+	if _, size := c.Estimate(calls[0]); size != 192 {
+		t.Errorf("wrong learned size: %v", size)
+	}
+	c.SetMaxResponseSize(1_920)
+	if chunks := c.Split(selectorCalls(30, 1, 0)); len(chunks) != 3 || len(chunks[0]) != 10 {
+		t.Errorf("wrong chunks with response size limit: %v", len(chunks))
+	}
+}
+
+func TestChunker_GasSamples(t *testing.T) {
+	c := generic.NewChunker(100, 1_200, 0)
+
+	// calls are grouped by function in order, calls with a gas estimate are not sampled
+	calls := append(append(selectorCalls(2, 1, 0), selectorCalls(3, 2, 0)...), selectorCalls(1, 1, 0)...)
+	calls = append(calls, selectorCalls(1, 3, 50)...)
+	samples := c.GasSamples(calls)
+	if len(samples) != 2 || len(samples[0]) != 3 || len(samples[1]) != 3 || samples[1][0].CallData[0] != 2 {
+		t.Fatalf("wrong samples: %v", samples)
+	}
+
+	// functions sampled alone are learned apart, 10 and 40 gas per call
+	c.ObserveGas(samples[0], 21_030)
+	c.ObserveGas(samples[1], 21_120)
+	if gas, _ := c.Estimate(calls[0]); gas != 10 {
+		t.Errorf("wrong learned gas of the first function: %v", gas)
+	}
+	if gas, _ := c.Estimate(calls[2]); gas != 40 {
+		t.Errorf("wrong learned gas of the second function: %v", gas)
+	}
+
+	// learned functions are not sampled
+	for i := 1; i < generic.DefaultGasSamples; i++ {
+		c.ObserveGas(samples[0], 21_030)
+	}
+	if samples := c.GasSamples(calls); len(samples) != 1 || samples[0][0].CallData[0] != 2 {
+		t.Errorf("wrong samples after learning: %v", samples)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
+	"sync"
+	"time"
 )
 
 ///
@@ -19,119 +21,314 @@ type Call3 struct {
 	Target       common.Address
 	CallData     []byte
 	AllowFailure bool
+	// Gas is an optional gas estimate of the call, used instead of the learned gas of its function
+	Gas uint64
 }
 
+// call is a call of tryBlockAndAggregate, which has no per-call failure flag
+type call struct {
+	Target   common.Address
+	CallData []byte
+}
+
+// Result is the result of a call
+// Success is false if the call reverted, Err is set if the call could not be made at all
+// Block and BlockHash are the executed block, the hash is empty if the client cannot read headers
 type Result struct {
 	Block      uint64
+	BlockHash  common.Hash
+	Success    bool
 	ReturnData []byte
+	Err        error
 }
 
+// Method is the Multicall3 function the calls are sent with
+type Method string
+
+const (
+	// Aggregate3 sends the calls with aggregate3
+	Aggregate3 Method = "aggregate3"
+	// TryBlockAndAggregate sends the calls with tryBlockAndAggregate, which also returns the block number and hash
+	TryBlockAndAggregate Method = "tryBlockAndAggregate"
+)
+
 type Multicall multicall.Multicaller[Call3, Result]
 
 ///
 /// MulticallContract
 ///
 
+// DefaultParallelism is the default number of call chunks sent concurrently
+const DefaultParallelism = 4
+
+// DefaultRetries is the default number of retries of a failed call chunk
+const DefaultRetries = 2
+
+// DefaultBackoff is the default delay before the first retry, doubled for every retry
+const DefaultBackoff = 250 * time.Millisecond
+
 type MulticallContract struct {
-	contract common.Address
-	callCost uint64
-	maxGas   uint64
-	cAbi     abi.ABI
-	client   multicall.ClientDispatcher
+	contract    common.Address
+	callCost    uint64
+	maxGas      uint64
+	cAbi        abi.ABI
+	client      multicall.ClientDispatcher
+	parallelism int
+	retries     int
+	backoff     time.Duration
+	method      Method
+	chunker     *Chunker
 }
 
 func NewCaller(contract common.Address, callCost uint64, maxGas uint64, cAbi abi.ABI, client multicall.ClientDispatcher) *MulticallContract {
 	return &MulticallContract{
-		contract: contract,
-		callCost: callCost,
-		maxGas:   maxGas,
-		cAbi:     cAbi,
-		client:   client,
+		contract:    contract,
+		callCost:    callCost,
+		maxGas:      maxGas,
+		cAbi:        cAbi,
+		client:      client,
+		parallelism: DefaultParallelism,
+		retries:     DefaultRetries,
+		backoff:     DefaultBackoff,
+		method:      Aggregate3,
+		chunker:     NewChunker(callCost, maxGas, 0),
 	}
 }
 
-func (m *MulticallContract) SplitCalls(calls []Call3) [][]Call3 {
-	callChunks := make([][]Call3, 0)
-	callChunk := make([]Call3, 0)
-	callChunkGas := uint64(0)
-
-	for _, call := range calls {
-		// check if adding this call would exceed the max gas limit for the chunk
-		if callChunkGas+m.callCost > m.maxGas {
-			// if it exceeds, start a newcache chunk
-			callChunks = append(callChunks, callChunk)
-			callChunk = make([]Call3, 0)
-			callChunkGas = 0
-		}
+// SetParallelism sets the number of call chunks sent concurrently, 1 sends them one after another
+func (m *MulticallContract) SetParallelism(parallelism int) {
+	m.parallelism = max(parallelism, 1)
+}
 
-		// add call to the current chunk and update the gas estimate
-		callChunk = append(callChunk, call)
-		callChunkGas += m.callCost
-	}
+// SetMaxResponseSize sets the response size limit of a call chunk in bytes, 0 does not limit it
+func (m *MulticallContract) SetMaxResponseSize(size uint64) {
+	m.chunker.SetMaxResponseSize(size)
+}
 
-	// add the last chunk if it contains any calls
-	if len(callChunk) > 0 {
-		callChunks = append(callChunks, callChunk)
-	}
+// SetMethod sets the Multicall3 function the calls are sent with
+func (m *MulticallContract) SetMethod(method Method) {
+	m.method = method
+}
 
-	return callChunks
+// SetRetries sets the number of retries of a failed call chunk and the delay before the first retry
+func (m *MulticallContract) SetRetries(retries int, backoff time.Duration) {
+	m.retries = max(retries, 0)
+	m.backoff = max(backoff, 0)
 }
 
+// SplitCalls splits the calls into chunks that fit the gas and response size limits
+// with the gas estimates of the calls and the gas and return data sizes learned from past calls
+func (m *MulticallContract) SplitCalls(calls []Call3) [][]Call3 {
+	return m.chunker.Split(calls)
+}
+
+// Aggregate sends the call chunks concurrently, up to the parallelism limit, and returns the results in call order
+// a chunk that keeps failing is split until the failing calls are isolated, their results carry the error
+// it only fails if the context is cancelled or no call could be made
 func (m *MulticallContract) Aggregate(ctx context.Context, calls []Call3, block uint64) ([]Result, error) {
+	// pin the block, so every chunk executes at the same block
+	block, hash, err := m.resolveBlock(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
 	// split calls into chunks
 	callChunks := m.SplitCalls(calls)
-	results := make([]Result, 0)
+	chunkResults := make([][]Result, len(callChunks))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(m.parallelism, 1))
+	for i, callChunk := range callChunks {
+		// wait for a free slot
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, callChunk []Call3) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			chunkResults[i] = m.dispatch(ctx, callChunk, block, hash, m.retries)
+		}(i, callChunk)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// merge results
+	results := make([]Result, 0, len(calls))
+	for _, res := range chunkResults {
+		results = append(results, res...)
+	}
 
-	for _, callChunk := range callChunks {
-		// encode calls
-		callsData, err := m.cAbi.Pack("aggregate3", callChunk)
-		if err != nil {
-			return nil, err
+	// fail if no call could be made
+	for _, r := range results {
+		if r.Err == nil {
+			return results, nil
 		}
+	}
+	if len(results) > 0 {
+		return nil, results[0].Err
+	}
+	return results, nil
+}
 
-		// set block number
-		var callBlock *big.Int
-		if block != 0 {
-			callBlock = new(big.Int).SetUint64(block)
+// dispatch sends a call chunk, retrying it with backoff
+// if it still fails it is split in halves, each sent once, until the failing calls are isolated
+func (m *MulticallContract) dispatch(ctx context.Context, callChunk []Call3, block uint64, hash common.Hash, retries int) []Result {
+	backoff := m.backoff
+	res, err := m.aggregate(ctx, callChunk, block, hash)
+	for attempt := 0; err != nil && attempt < retries && ctx.Err() == nil; attempt++ {
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+			res, err = m.aggregate(ctx, callChunk, block, hash)
 		}
+		backoff *= 2
+	}
+	if err == nil {
+		return res
+	}
 
-		// call the contract
-		rawRes, err := m.client.CallContract(
-			ctx,
-			ethereum.CallMsg{
-				To:   &m.contract,
-				Data: callsData,
-				Gas:  m.maxGas,
-			},
-			callBlock,
-		)
-		if err != nil {
-			return nil, err
+	// the failing call is isolated or the call was cancelled
+	if len(callChunk) == 1 || ctx.Err() != nil {
+		results := make([]Result, len(callChunk))
+		for i := range results {
+			results[i] = Result{Block: block, BlockHash: hash, Err: err}
 		}
+		return results
+	}
 
-		// decode results
-		inter, err := m.cAbi.Unpack("aggregate3", rawRes)
-		if err != nil {
-			return nil, err
+	half := len(callChunk) / 2
+	return append(m.dispatch(ctx, callChunk[:half], block, hash, 0), m.dispatch(ctx, callChunk[half:], block, hash, 0)...)
+}
+
+// resolveBlock reads the number and hash of the block, 0 is the latest block
+// the block is returned as is with an empty hash if the client cannot read headers
+func (m *MulticallContract) resolveBlock(ctx context.Context, block uint64) (uint64, common.Hash, error) {
+	reader, ok := m.client.(multicall.HeaderReader)
+	if !ok {
+		return block, common.Hash{}, nil
+	}
+
+	var number *big.Int
+	if block != 0 {
+		number = new(big.Int).SetUint64(block)
+	}
+	header, err := reader.HeaderByNumber(ctx, number)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	if header == nil {
+		return 0, common.Hash{}, errors.New(fmt.Sprintf("unknown block: %v", block))
+	}
+	return header.Number.Uint64(), header.Hash(), nil
+}
+
+// pack encodes a call chunk for the multicall method
+func (m *MulticallContract) pack(callChunk []Call3) ([]byte, error) {
+	if m.method != TryBlockAndAggregate {
+		return m.cAbi.Pack(string(m.method), callChunk)
+	}
+
+	// requireSuccess applies to the whole chunk, so failures are checked per call after decoding
+	tryCalls := make([]call, len(callChunk))
+	for i, c := range callChunk {
+		tryCalls[i] = call{Target: c.Target, CallData: c.CallData}
+	}
+	return m.cAbi.Pack(string(m.method), false, tryCalls)
+}
+
+// aggregate sends a single call chunk
+func (m *MulticallContract) aggregate(ctx context.Context, callChunk []Call3, block uint64, hash common.Hash) ([]Result, error) {
+	// encode calls
+	callsData, err := m.pack(callChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	// set block number
+	var callBlock *big.Int
+	if block != 0 {
+		callBlock = new(big.Int).SetUint64(block)
+	}
+
+	// call the contract
+	rawRes, err := m.client.CallContract(
+		ctx,
+		ethereum.CallMsg{
+			To:   &m.contract,
+			Data: callsData,
+			Gas:  m.maxGas,
+		},
+		callBlock,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// learn the gas use of new functions by estimating the calls of each function alone
+	// the estimates run at the latest block and cost one request per function until it is learned
+	if estimator, ok := m.client.(multicall.GasEstimator); ok {
+		for _, sample := range m.chunker.GasSamples(callChunk) {
+			sampleData, err := m.pack(sample)
+			if err != nil {
+				continue
+			}
+			if gas, err := estimator.EstimateGas(ctx, ethereum.CallMsg{To: &m.contract, Data: sampleData, Gas: m.maxGas}); err == nil {
+				m.chunker.ObserveGas(sample, gas)
+			}
 		}
+	}
 
-		// validate return data
-		res := inter[0].([]struct {
-			Success    bool   "json:\"success\""
-			ReturnData []byte "json:\"returnData\""
-		})
-		if len(res) != len(callChunk) {
-			return nil, errors.New(fmt.Sprintf("return data length mismatch: %v != %v", len(res), len(callChunk)))
+	// decode results
+	inter, err := m.cAbi.Unpack(string(m.method), rawRes)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the executed block, Multicall3 returns blockhash(block.number) which is always empty
+	// so the returned hash is only used if the block was not resolved
+	resultBlock, resultHash := block, hash
+	if m.method == TryBlockAndAggregate {
+		if executed := inter[0].(*big.Int).Uint64(); executed != block || resultHash == (common.Hash{}) {
+			resultBlock, resultHash = executed, inter[1].([32]byte)
 		}
+		inter = inter[2:]
+	}
 
-		// merge results
-		for _, r := range res {
-			results = append(results, Result{
-				Block:      block,
-				ReturnData: r.ReturnData,
-			})
+	// validate return data
+	res := inter[0].([]struct {
+		Success    bool   "json:\"success\""
+		ReturnData []byte "json:\"returnData\""
+	})
+	if len(res) != len(callChunk) {
+		return nil, errors.New(fmt.Sprintf("return data length mismatch: %v != %v", len(res), len(callChunk)))
+	}
+
+	// a failed call that does not allow failure fails the chunk, like aggregate3
+	for i, r := range res {
+		if !r.Success && !callChunk[i].AllowFailure {
+			return nil, errors.New(fmt.Sprintf("call %v to %v failed", i, callChunk[i].Target))
 		}
 	}
 
+	results := make([]Result, 0, len(res))
+	for _, r := range res {
+		results = append(results, Result{
+			Block:      resultBlock,
+			BlockHash:  resultHash,
+			Success:    r.Success,
+			ReturnData: r.ReturnData,
+		})
+	}
+	m.chunker.ObserveResults(callChunk, results)
 	return results, nil
 }
@@ -2,14 +2,21 @@ package generic_test
 
 import (
 	"PoolHelper/src/multicall/generic"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
+	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestMulticallContract_SplitCalls(t *testing.T) {
-	callCost, maxGas := uint64(1), uint64(10)
+	// chunks are packed to 85% of the gas limit, 10 calls
+	callCost, maxGas := uint64(1), uint64(12)
 	m := generic.NewCaller(common.BigToAddress(big.NewInt(0)), callCost, maxGas, abi.ABI{}, nil)
 
 	var calls []generic.Call3
@@ -29,3 +36,253 @@ func TestMulticallContract_SplitCalls(t *testing.T) {
 		t.Errorf("wrong number of calls in last chunk")
 	}
 }
+
+// abiCall3 is a Call3 with the fields in ABI order
+type abiCall3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// abiCall is a call of tryBlockAndAggregate
+type abiCall struct {
+	Target   common.Address
+	CallData []byte
+}
+
+// echoClient answers aggregate3 and tryBlockAndAggregate calls with the call targets as return data
+// and records the number of chunks sent concurrently
+// chunks containing the fail target or every chunk if failAll is set fail, calls to the revert target revert
+type echoClient struct {
+	cAbi    abi.ABI
+	fail    common.Address
+	failAll bool
+	revert  common.Address
+	calls   atomic.Int32
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (c *echoClient) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	c.calls.Add(1)
+	running := c.running.Add(1)
+	defer c.running.Add(-1)
+	for peak := c.peak.Load(); running > peak && !c.peak.CompareAndSwap(peak, running); peak = c.peak.Load() {
+	}
+
+	method, err := c.cAbi.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	args, err := method.Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	targets, requireSuccess := make([]common.Address, 0), false
+	if method.Name == "tryBlockAndAggregate" {
+		requireSuccess = args[0].(bool)
+		for _, call := range *abi.ConvertType(args[1], new([]abiCall)).(*[]abiCall) {
+			targets = append(targets, call.Target)
+		}
+	} else {
+		for _, call := range *abi.ConvertType(args[0], new([]abiCall3)).(*[]abiCall3) {
+			targets = append(targets, call.Target)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	if c.failAll {
+		return nil, errors.New("call failed")
+	}
+	res := make([]struct {
+		Success    bool
+		ReturnData []byte
+	}, len(targets))
+	for i, target := range targets {
+		if target == c.fail {
+			return nil, errors.New("call failed")
+		}
+		if target == c.revert {
+			if requireSuccess {
+				return nil, errors.New("execution reverted")
+			}
+			continue
+		}
+		res[i].Success = true
+		res[i].ReturnData = target.Bytes()
+	}
+
+	if method.Name == "tryBlockAndAggregate" {
+		return method.Outputs.Pack(block, common.BigToHash(block), res)
+	}
+	return method.Outputs.Pack(res)
+}
+
+func TestMulticallContract_Aggregate(t *testing.T) {
+	rawABI, err := os.Open("../../../abi/IMulticaller3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawABI.Close()
+	cAbi, err := abi.JSON(rawABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []generic.Call3
+	for i := 1; i <= 101; i++ {
+		calls = append(calls, generic.Call3{
+			Target:   common.BigToAddress(big.NewInt(int64(i))),
+			CallData: []byte{},
+		})
+	}
+
+	// 11 chunks of 10 calls at 85% of the gas limit, 3 at a time
+	client := &echoClient{cAbi: cAbi}
+	m := generic.NewCaller(common.Address{}, 1, 12, cAbi, client)
+	m.SetParallelism(3)
+
+	results, err := m.Aggregate(context.Background(), calls, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("wrong number of results: %v", len(results))
+	}
+	for i, r := range results {
+		if common.BytesToAddress(r.ReturnData) != calls[i].Target || r.Block != 100 {
+			t.Fatalf("wrong result order at %d: %x", i, r.ReturnData)
+		}
+	}
+	if peak := client.peak.Load(); peak < 2 || peak > 3 {
+		t.Errorf("wrong number of concurrent chunks: %v", peak)
+	}
+
+	// a failing chunk is retried and split until the failing call is isolated
+	m.SetRetries(1, time.Millisecond)
+	client.fail = calls[55].Target
+	client.calls.Store(0)
+	results, err = m.Aggregate(context.Background(), calls, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if failed := r.Err != nil; failed != (i == 55) {
+			t.Errorf("wrong error at %d: %v", i, r.Err)
+		}
+		if r.Err == nil && common.BytesToAddress(r.ReturnData) != calls[i].Target {
+			t.Errorf("wrong result at %d: %x", i, r.ReturnData)
+		}
+	}
+	// 11 chunks, a retry and 3 splits of 10 calls down to the failing call
+	if n := client.calls.Load(); n != 11+1+3*2 {
+		t.Errorf("wrong number of chunk calls: %v", n)
+	}
+
+	// the call fails if no call could be made
+	client.failAll = true
+	if _, err := m.Aggregate(context.Background(), calls, 100); err == nil {
+		t.Errorf("expected a failed call")
+	}
+	client.failAll = false
+
+	// a cancelled context cancels the call
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Aggregate(ctx, calls, 100); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled call, got %v", err)
+	}
+}
+
+func TestMulticallContract_TryBlockAndAggregate(t *testing.T) {
+	rawABI, err := os.Open("../../../abi/IMulticaller3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawABI.Close()
+	cAbi, err := abi.JSON(rawABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []generic.Call3{
+		{Target: common.HexToAddress("0x01"), CallData: []byte{}, AllowFailure: true},
+		{Target: common.HexToAddress("0x02"), CallData: []byte{}, AllowFailure: true},
+	}
+	client := &echoClient{cAbi: cAbi, revert: calls[1].Target}
+	m := generic.NewCaller(common.Address{}, 1, 10, cAbi, client)
+	m.SetMethod(generic.TryBlockAndAggregate)
+
+	results, err := m.Aggregate(context.Background(), calls, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("wrong number of results: %v", len(results))
+	}
+	for _, r := range results {
+		if r.Block != 100 || r.BlockHash != common.BigToHash(big.NewInt(100)) {
+			t.Errorf("wrong block: %v %v", r.Block, r.BlockHash)
+		}
+	}
+	if !results[0].Success || common.BytesToAddress(results[0].ReturnData) != calls[0].Target {
+		t.Errorf("wrong result: %+v", results[0])
+	}
+	if results[1].Success || len(results[1].ReturnData) != 0 {
+		t.Errorf("expected a reverted call: %+v", results[1])
+	}
+}
+
+func TestMulticallContract_TryBlockAndAggregateRequired(t *testing.T) {
+	rawABI, err := os.Open("../../../abi/IMulticaller3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawABI.Close()
+	cAbi, err := abi.JSON(rawABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a required call in the chunk does not fail the calls that allow failure
+	calls := []generic.Call3{
+		{Target: common.HexToAddress("0x01"), CallData: []byte{}, AllowFailure: false},
+		{Target: common.HexToAddress("0x02"), CallData: []byte{}, AllowFailure: true},
+	}
+	client := &echoClient{cAbi: cAbi, revert: calls[1].Target}
+	m := generic.NewCaller(common.Address{}, 1, 10, cAbi, client)
+	m.SetMethod(generic.TryBlockAndAggregate)
+	m.SetRetries(0, 0)
+
+	results, err := m.Aggregate(context.Background(), calls, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Success || results[0].Err != nil {
+		t.Errorf("wrong result: %+v", results[0])
+	}
+	if results[1].Success || results[1].Err != nil {
+		t.Errorf("expected a reverted call: %+v", results[1])
+	}
+	if n := client.calls.Load(); n != 1 {
+		t.Errorf("expected a single call, got %v", n)
+	}
+
+	// a required call that reverts is isolated with an error
+	calls[0].AllowFailure, calls[1].AllowFailure = true, false
+	results, err = m.Aggregate(context.Background(), calls, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Success || results[0].Err != nil {
+		t.Errorf("wrong result: %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Errorf("expected a failed call: %+v", results[1])
+	}
+}
@@ -3,6 +3,7 @@ package multicall
 import (
 	"context"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
 	"math/big"
 )
 
@@ -10,6 +11,16 @@ type ClientDispatcher interface {
 	CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error)
 }
 
+// GasEstimator estimates the gas used by a call at the latest block, it cannot estimate at a past block
+type GasEstimator interface {
+	EstimateGas(context.Context, ethereum.CallMsg) (uint64, error)
+}
+
+// HeaderReader reads the header of a block, a nil number reads the latest block
+type HeaderReader interface {
+	HeaderByNumber(context.Context, *big.Int) (*types.Header, error)
+}
+
 type Multicaller[CallType any, ResultType any] interface {
 	Aggregate(context.Context, []CallType, uint64) ([]ResultType, error)
 }
@@ -0,0 +1,356 @@
+package replay
+
+import (
+	"PoolHelper/src/multicall"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	FixtureNotFound = errors.New("fixture not found")
+)
+
+// multicallABI is the subset of the Multicall3 ABI whose requests are recorded per inner call
+const multicallABI = `[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"},{"inputs":[{"name":"requireSuccess","type":"bool"},{"components":[{"name":"target","type":"address"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"tryBlockAndAggregate","outputs":[{"name":"blockNumber","type":"uint256"},{"name":"blockHash","type":"bytes32"},{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var multicallAbi = func() abi.ABI {
+	cAbi, err := abi.JSON(strings.NewReader(multicallABI))
+	if err != nil {
+		panic(err)
+	}
+	return cAbi
+}()
+
+///
+/// Fixture
+///
+
+// Call is a recorded CallContract request with its response, or an inner call of a Multicall3 request
+// a nil Block is the latest block, Error is set if the call failed
+// Reverted is set if an inner call reverted, its Result is the revert data
+type Call struct {
+	To        common.Address `json:"to"`
+	Data      hexutil.Bytes  `json:"data"`
+	Block     *big.Int       `json:"block"`
+	Result    hexutil.Bytes  `json:"result,omitempty"`
+	Reverted  bool           `json:"reverted,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	ErrorCode int            `json:"errorCode,omitempty"`
+}
+
+// key returns the key of a request, its target, call data and block
+func key(to *common.Address, data []byte, block *big.Int) string {
+	target := common.Address{}
+	if to != nil {
+		target = *to
+	}
+	number := "latest"
+	if block != nil {
+		number = block.String()
+	}
+	return target.Hex() + ":" + hexutil.Encode(data) + "@" + number
+}
+
+// callError is a replayed error, it is a JSON-RPC error if it has a code
+type callError struct {
+	message string
+	code    int
+}
+
+func (e callError) Error() string  { return e.message }
+func (e callError) ErrorCode() int { return e.code }
+
+// response returns the recorded response of a call
+func (c Call) response() ([]byte, error) {
+	if c.Error == "" {
+		return append([]byte(nil), c.Result...), nil
+	}
+	if c.ErrorCode != 0 {
+		return nil, callError{message: c.Error, code: c.ErrorCode}
+	}
+	return nil, errors.New(c.Error)
+}
+
+// innerCall is a call of a Multicall3 request, with the fields in the order of aggregate3
+type innerCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// tryCall is a call of tryBlockAndAggregate, which has no per-call failure flag
+type tryCall struct {
+	Target   common.Address
+	CallData []byte
+}
+
+// innerResult is the result of a call of a Multicall3 request
+type innerResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// decodeCalls decodes the calls of a Multicall3 request, it returns nil for other requests
+func decodeCalls(data []byte) (*abi.Method, []innerCall) {
+	if len(data) < 4 {
+		return nil, nil
+	}
+	method, err := multicallAbi.MethodById(data[:4])
+	if err != nil {
+		return nil, nil
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, nil
+	}
+
+	if method.Name == "aggregate3" {
+		return method, *abi.ConvertType(args[0], new([]innerCall)).(*[]innerCall)
+	}
+	// requireSuccess applies to every call
+	tryCalls := *abi.ConvertType(args[1], new([]tryCall)).(*[]tryCall)
+	calls := make([]innerCall, len(tryCalls))
+	for i, c := range tryCalls {
+		calls[i] = innerCall{Target: c.Target, AllowFailure: !args[0].(bool), CallData: c.CallData}
+	}
+	return method, calls
+}
+
+// decodeResults decodes the results of a Multicall3 request
+func decodeResults(method *abi.Method, res []byte) ([]innerResult, error) {
+	out, err := method.Outputs.Unpack(res)
+	if err != nil {
+		return nil, err
+	}
+	return *abi.ConvertType(out[len(out)-1], new([]innerResult)).(*[]innerResult), nil
+}
+
+// encodeResults encodes the results of a Multicall3 request
+// tryBlockAndAggregate returns the block with an empty hash, like blockhash(block.number)
+func encodeResults(method *abi.Method, results []innerResult, block *big.Int) ([]byte, error) {
+	if method.Name == "aggregate3" {
+		return method.Outputs.Pack(results)
+	}
+	if block == nil {
+		block = new(big.Int)
+	}
+	return method.Outputs.Pack(block, common.Hash{}, results)
+}
+
+// Load reads the calls of a fixture file
+func Load(path string) ([]Call, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([]Call, 0)
+	if err := json.Unmarshal(raw, &calls); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid fixture %s: %s", path, err))
+	}
+	return calls, nil
+}
+
+// Save writes calls to a fixture file
+func Save(path string, calls []Call) error {
+	raw, err := json.MarshalIndent(calls, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0644)
+}
+
+///
+/// Recorder
+///
+
+// Recorder is a client dispatcher that records the requests and responses of another dispatcher
+// Multicall3 requests are recorded per inner call, so they can be replayed in other chunks,
+// unless the whole request failed
+// a request made several times keeps its last response, cancelled requests are not recorded
+type Recorder struct {
+	client multicall.ClientDispatcher
+	m      sync.Mutex
+	calls  map[string]Call
+}
+
+// NewRecorder creates a recorder of a client dispatcher
+func NewRecorder(client multicall.ClientDispatcher) *Recorder {
+	return &Recorder{
+		client: client,
+		calls:  make(map[string]Call),
+	}
+}
+
+func (r *Recorder) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	res, err := r.client.CallContract(ctx, msg, block)
+	if ctx.Err() != nil {
+		return res, err
+	}
+
+	var callBlock *big.Int
+	if block != nil {
+		callBlock = new(big.Int).Set(block)
+	}
+
+	// record the calls of a Multicall3 request one by one
+	if method, calls := decodeCalls(msg.Data); method != nil && err == nil {
+		if results, decodeErr := decodeResults(method, res); decodeErr == nil && len(results) == len(calls) {
+			r.m.Lock()
+			for i, c := range calls {
+				r.calls[key(&c.Target, c.CallData, block)] = Call{
+					To:       c.Target,
+					Data:     c.CallData,
+					Block:    callBlock,
+					Result:   results[i].ReturnData,
+					Reverted: !results[i].Success,
+				}
+			}
+			r.m.Unlock()
+			return res, err
+		}
+	}
+
+	call := Call{Data: msg.Data, Block: callBlock, Result: res}
+	if msg.To != nil {
+		call.To = *msg.To
+	}
+	if err != nil {
+		call.Result, call.Error = nil, err.Error()
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			call.ErrorCode = rpcErr.ErrorCode()
+		}
+	}
+
+	r.m.Lock()
+	r.calls[key(msg.To, msg.Data, block)] = call
+	r.m.Unlock()
+	return res, err
+}
+
+// Calls returns the recorded calls sorted by their keys, so fixtures diff cleanly
+func (r *Recorder) Calls() []Call {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	keys := make([]string, 0, len(r.calls))
+	for k := range r.calls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	calls := make([]Call, len(keys))
+	for i, k := range keys {
+		calls[i] = r.calls[k]
+	}
+	return calls
+}
+
+// Save writes the recorded calls to a fixture file
+func (r *Recorder) Save(path string) error {
+	return Save(path, r.Calls())
+}
+
+///
+/// Replayer
+///
+
+// Replayer is a client dispatcher that answers requests with recorded responses
+// Multicall3 requests that were not recorded as a whole are answered from their recorded inner calls,
+// a reverted call that does not allow failure reverts the request like Multicall3
+// requests that were not recorded fail with FixtureNotFound
+type Replayer struct {
+	calls map[string]Call
+}
+
+// NewReplayer creates a replayer of recorded calls
+func NewReplayer(calls []Call) *Replayer {
+	r := &Replayer{calls: make(map[string]Call, len(calls))}
+	for _, call := range calls {
+		r.calls[key(&call.To, call.Data, call.Block)] = call
+	}
+	return r
+}
+
+// LoadReplayer creates a replayer of the calls of a fixture file
+func LoadReplayer(path string) (*Replayer, error) {
+	calls, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(calls), nil
+}
+
+func (r *Replayer) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if call, ok := r.calls[key(msg.To, msg.Data, block)]; ok {
+		return call.response()
+	}
+
+	number := "latest"
+	if block != nil {
+		number = block.String()
+	}
+	method, calls := decodeCalls(msg.Data)
+	if method == nil {
+		return nil, errors.New(fmt.Sprintf("%s: %d bytes of call data at block %s", FixtureNotFound, len(msg.Data), number))
+	}
+
+	results := make([]innerResult, len(calls))
+	for i, c := range calls {
+		call, ok := r.calls[key(&c.Target, c.CallData, block)]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%s: call %d to %s with %d bytes of call data at block %s", FixtureNotFound, i, c.Target.Hex(), len(c.CallData), number))
+		}
+		if call.Error != "" {
+			return call.response()
+		}
+		if call.Reverted && !c.AllowFailure {
+			return nil, callError{message: "execution reverted", code: 3}
+		}
+		results[i] = innerResult{Success: !call.Reverted, ReturnData: call.Result}
+	}
+	return encodeResults(method, results, block)
+}
+
+///
+/// Pinned
+///
+
+// Pinned is a client dispatcher that makes the calls at the latest block at a fixed block instead
+// a recorder behind it records every call at that block, so the fixture does not depend on the latest block
+type Pinned struct {
+	client multicall.ClientDispatcher
+	block  *big.Int
+}
+
+// NewPinned creates a dispatcher pinning the latest block of a client dispatcher to a block
+func NewPinned(client multicall.ClientDispatcher, block uint64) *Pinned {
+	return &Pinned{
+		client: client,
+		block:  new(big.Int).SetUint64(block),
+	}
+}
+
+func (p *Pinned) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if block == nil {
+		block = p.block
+	}
+	return p.client.CallContract(ctx, msg, block)
+}
@@ -0,0 +1,205 @@
+package replay_test
+
+import (
+	"PoolHelper/src/multicall/replay"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// revertError is a JSON-RPC error answered by a node
+type revertError struct{}
+
+func (revertError) Error() string  { return "execution reverted" }
+func (revertError) ErrorCode() int { return 3 }
+
+// echoClient answers with the call data and the block, calls without data revert
+type echoClient struct{}
+
+func (echoClient) CallContract(_ context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if len(msg.Data) == 0 {
+		return nil, revertError{}
+	}
+	if block == nil {
+		return msg.Data, nil
+	}
+	return append(msg.Data, block.Bytes()...), nil
+}
+
+func TestRecorder_Replay(t *testing.T) {
+	to := common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+	requests := []struct {
+		data  []byte
+		block *big.Int
+	}{
+		{[]byte{1, 2}, nil},
+		{[]byte{1, 2}, big.NewInt(7)},
+		{[]byte{3}, big.NewInt(7)},
+		{nil, big.NewInt(8)},
+	}
+
+	// record the requests and save them to a fixture
+	r := replay.NewRecorder(echoClient{})
+	for _, req := range requests {
+		_, _ = r.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: req.data}, req.block)
+	}
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// replay the fixture, responses and errors are the recorded ones
+	p, err := replay.LoadReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range requests {
+		expected, expectedErr := echoClient{}.CallContract(context.Background(), ethereum.CallMsg{Data: req.data}, req.block)
+		res, err := p.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: req.data}, req.block)
+		if string(res) != string(expected) || (err == nil) != (expectedErr == nil) {
+			t.Errorf("wrong replay of %x at %v: %x %v", req.data, req.block, res, err)
+		}
+	}
+
+	// recorded JSON-RPC errors keep their code
+	var rpcErr rpc.Error
+	if _, err := p.CallContract(context.Background(), ethereum.CallMsg{To: &to}, big.NewInt(8)); !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != 3 {
+		t.Errorf("expected a revert, got %v", err)
+	}
+
+	// requests that were not recorded fail
+	if _, err := p.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: []byte{3}}, nil); err == nil || !strings.HasPrefix(err.Error(), replay.FixtureNotFound.Error()) {
+		t.Errorf("expected a missing fixture, got %v", err)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	to := common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+	r := replay.NewRecorder(echoClient{})
+	p := replay.NewPinned(r, 7)
+
+	// calls at the latest block are made at the pinned block, other blocks are kept
+	for _, block := range []*big.Int{nil, big.NewInt(5)} {
+		if _, err := p.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: []byte{1}}, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := r.Calls()
+	if len(calls) != 2 || calls[0].Block.Int64() != 5 || calls[1].Block.Int64() != 7 {
+		t.Errorf("wrong pinned calls: %+v", calls)
+	}
+}
+
+// call3 is an aggregate3 call with the fields in ABI order
+type call3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// result is a Multicall3 call result
+type result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// multicallClient answers aggregate3 requests with the call targets as return data, calls to the revert target revert
+type multicallClient struct {
+	cAbi   abi.ABI
+	revert common.Address
+}
+
+func (c multicallClient) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	args, err := c.cAbi.Methods["aggregate3"].Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls := *abi.ConvertType(args[0], new([]call3)).(*[]call3)
+	results := make([]result, len(calls))
+	for i, call := range calls {
+		if call.Target == c.revert {
+			if !call.AllowFailure {
+				return nil, revertError{}
+			}
+			continue
+		}
+		results[i] = result{Success: true, ReturnData: call.Target.Bytes()}
+	}
+	return c.cAbi.Methods["aggregate3"].Outputs.Pack(results)
+}
+
+func TestReplayer_Multicall(t *testing.T) {
+	rawABI, err := os.Open("../../../abi/IMulticaller3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawABI.Close()
+	cAbi, err := abi.JSON(rawABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, block := common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11"), big.NewInt(7)
+	request := func(client interface {
+		CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error)
+	}, calls ...call3) ([]result, error) {
+		data, err := cAbi.Pack("aggregate3", calls)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: data}, block)
+		if err != nil {
+			return nil, err
+		}
+		out, err := cAbi.Unpack("aggregate3", res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *abi.ConvertType(out[0], new([]result)).(*[]result), nil
+	}
+	a, b, c := call3{Target: common.HexToAddress("0x0a"), CallData: []byte{1}}, call3{Target: common.HexToAddress("0x0b"), CallData: []byte{2}}, call3{Target: common.HexToAddress("0x0c"), CallData: []byte{3}, AllowFailure: true}
+
+	// the calls of a request are recorded one by one
+	r := replay.NewRecorder(multicallClient{cAbi: cAbi, revert: c.Target})
+	if _, err := request(r, a, b, c); err != nil {
+		t.Fatal(err)
+	}
+	calls := r.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("wrong recorded calls: %+v", calls)
+	}
+	for _, call := range calls {
+		if call.Reverted != (call.To == c.Target) || call.Block.Cmp(block) != 0 {
+			t.Errorf("wrong recorded call: %+v", call)
+		}
+	}
+
+	// they are replayed in other chunks and orders
+	p := replay.NewReplayer(r.Calls())
+	results, err := request(p, c, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Success || !results[1].Success || common.BytesToAddress(results[1].ReturnData) != a.Target {
+		t.Errorf("wrong replayed results: %+v", results)
+	}
+
+	// a reverted call that does not allow failure reverts the request
+	c.AllowFailure = false
+	var rpcErr rpc.Error
+	if _, err := request(p, b, c); !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != 3 {
+		t.Errorf("expected a revert, got %v", err)
+	}
+
+	// calls that were not recorded fail
+	if _, err := request(p, a, call3{Target: common.HexToAddress("0x0d")}); err == nil || !strings.HasPrefix(err.Error(), replay.FixtureNotFound.Error()) {
+		t.Errorf("expected a missing fixture, got %v", err)
+	}
+}
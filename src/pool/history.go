@@ -0,0 +1,160 @@
+package pool
+
+import (
+	"errors"
+	"math/big"
+)
+
+// DefaultHistorySize is the default number of synced states kept by a pool
+const DefaultHistorySize = 128
+
+var (
+	StateNotFound = errors.New("state is not in the pool history")
+)
+
+// Historian returns the past synced states of a pool
+type Historian[ReserveType any] interface {
+	// StateAt returns the state of the pool at a block, the last state synced at or before it
+	StateAt(uint64) (Record[ReserveType], error)
+	// States returns the states synced between two blocks (inclusive), oldest first
+	States(uint64, uint64) []Record[ReserveType]
+	// PriceAt returns the spot price of the pool at a block
+	PriceAt(uint64) (Price, error)
+	// PriceChange returns the change of the spot price over the last blocks
+	PriceChange(uint64) (PriceChange, error)
+	// SetHistorySize sets the number of synced states kept, older states are dropped
+	SetHistorySize(int)
+}
+
+// Record is a synced state of a pool
+type Record[ReserveType any] struct {
+	Block     uint64      `json:"block"`
+	Timestamp uint64      `json:"timestamp"`
+	State     ReserveType `json:"state"`
+}
+
+// History is a ring buffer of the last synced states of a pool
+// the pools guard their history with their own lock
+type History[ReserveType any] struct {
+	records []Record[ReserveType]
+	// start is the index of the oldest record, n the number of records
+	start int
+	n     int
+}
+
+// NewHistory creates an empty history keeping the last size states
+func NewHistory[ReserveType any](size int) *History[ReserveType] {
+	return &History[ReserveType]{
+		records: make([]Record[ReserveType], max(size, 0)),
+	}
+}
+
+// Len returns the number of records
+func (h *History[ReserveType]) Len() int {
+	return h.n
+}
+
+// At returns the i-th record, oldest first
+func (h *History[ReserveType]) At(i int) Record[ReserveType] {
+	return h.records[(h.start+i)%len(h.records)]
+}
+
+// Push appends a record, replacing the oldest record if the history is full
+// records at or after the block of the record are dropped first, e.g. states of blocks rolled back by a reorg
+func (h *History[ReserveType]) Push(r Record[ReserveType]) {
+	if len(h.records) == 0 {
+		return
+	}
+	for h.n > 0 && h.At(h.n-1).Block >= r.Block {
+		h.n--
+	}
+
+	if h.n == len(h.records) {
+		h.records[h.start] = r
+		h.start = (h.start + 1) % len(h.records)
+		return
+	}
+	h.records[(h.start+h.n)%len(h.records)] = r
+	h.n++
+}
+
+// Resize sets the number of records kept, the oldest records are dropped
+func (h *History[ReserveType]) Resize(size int) {
+	size = max(size, 0)
+	records := make([]Record[ReserveType], size)
+	skip := max(h.n-size, 0)
+	for i := skip; i < h.n; i++ {
+		records[i-skip] = h.At(i)
+	}
+
+	h.records = records
+	h.start = 0
+	h.n -= skip
+}
+
+// Find returns the last record at or before a block
+func (h *History[ReserveType]) Find(block uint64) (Record[ReserveType], bool) {
+	for i := h.n - 1; i >= 0; i-- {
+		if r := h.At(i); r.Block <= block {
+			return r, true
+		}
+	}
+	return Record[ReserveType]{}, false
+}
+
+// Range returns the records between two blocks (inclusive), oldest first
+func (h *History[ReserveType]) Range(from uint64, to uint64) []Record[ReserveType] {
+	records := make([]Record[ReserveType], 0)
+	for i := 0; i < h.n; i++ {
+		if r := h.At(i); r.Block >= from && r.Block <= to {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+///
+/// Price Change
+///
+
+// PriceChange is the change of the spot price of a pool between two synced states
+type PriceChange struct {
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+	From      Price  `json:"-"`
+	To        Price  `json:"-"`
+}
+
+// NewPriceChange creates the price change between two synced prices
+func NewPriceChange(fromBlock uint64, from Price, toBlock uint64, to Price) PriceChange {
+	return PriceChange{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		From:      from,
+		To:        to,
+	}
+}
+
+// AInB returns the relative change of the price of one TokenA in TokenB, e.g. 1/100 for +1%
+func (c PriceChange) AInB() *big.Rat {
+	change := new(big.Rat).Quo(c.To.AInB, c.From.AInB)
+	return change.Sub(change, big.NewRat(1, 1))
+}
+
+// BInA returns the relative change of the price of one TokenB in TokenA
+func (c PriceChange) BInA() *big.Rat {
+	change := new(big.Rat).Quo(c.To.BInA, c.From.BInA)
+	return change.Sub(change, big.NewRat(1, 1))
+}
+
+// AInBFloat returns the relative change of the price of one TokenA in TokenB as a float
+func (c PriceChange) AInBFloat() float64 {
+	f, _ := c.AInB().Float64()
+	return f
+}
+
+// BInAFloat returns the relative change of the price of one TokenB in TokenA as a float
+func (c PriceChange) BInAFloat() float64 {
+	f, _ := c.BInA().Float64()
+	return f
+}
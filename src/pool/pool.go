@@ -3,12 +3,57 @@ package pool
 import (
 	"PoolHelper/src/structs/pair"
 	"github.com/ethereum/go-ethereum/common"
+	"math/big"
 )
 
 type Pool[ReserveType any, PairOption any] interface {
+	Quoter
+	Pricer
+	Historian[ReserveType]
 	Pair() pair.Pair[PairOption]
 	Factory() common.Address
 	Address() common.Address
 	Update(ReserveType, uint64)
 	State() (ReserveType, uint64, uint64)
 }
+
+// Quoter quotes swaps against the last synced state of a pool
+type Quoter interface {
+	// AmountOut returns the output amount for swapping amountIn of the given input token
+	AmountOut(common.Address, *big.Int) (*big.Int, error)
+	// AmountIn returns the input amount required to receive amountOut of the given output token
+	AmountIn(common.Address, *big.Int) (*big.Int, error)
+}
+
+// Pricer returns the spot price of a pool at its last synced state
+type Pricer interface {
+	Price() (Price, error)
+}
+
+// Price is the spot price of a pool pair adjusted by the token decimals
+type Price struct {
+	// AInB is the price of one TokenA in TokenB
+	AInB *big.Rat
+	// BInA is the price of one TokenB in TokenA
+	BInA *big.Rat
+}
+
+// NewPrice creates a price from the price of one TokenA in TokenB
+func NewPrice(aInB *big.Rat) Price {
+	return Price{
+		AInB: new(big.Rat).Set(aInB),
+		BInA: new(big.Rat).Inv(aInB),
+	}
+}
+
+// AInBFloat returns the price of one TokenA in TokenB as a float
+func (p Price) AInBFloat() float64 {
+	f, _ := p.AInB.Float64()
+	return f
+}
+
+// BInAFloat returns the price of one TokenB in TokenA as a float
+func (p Price) BInAFloat() float64 {
+	f, _ := p.BInA.Float64()
+	return f
+}
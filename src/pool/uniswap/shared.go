@@ -0,0 +1,38 @@
+package uniswap
+
+import (
+	"PoolHelper/src/pool"
+	"PoolHelper/src/structs/token"
+	"errors"
+	"math/big"
+)
+
+var (
+	InvalidToken             = errors.New("token is not in the pool pair")
+	InsufficientInputAmount  = errors.New("insufficient input amount")
+	InsufficientOutputAmount = errors.New("insufficient output amount")
+	InsufficientLiquidity    = errors.New("insufficient liquidity")
+	InsufficientTickData     = errors.New("swap crosses ticks outside of the synced tick range")
+	InvalidTick              = errors.New("invalid tick")
+	InvalidSqrtPrice         = errors.New("invalid sqrt price")
+	InvalidPriceLimit        = errors.New("invalid sqrt price limit")
+	InvalidAmount            = errors.New("invalid swap amount")
+	InvalidDecimals          = errors.New("token decimals are not set")
+	UnsyncedPool             = errors.New("pool state is not synced")
+)
+
+// spotPrice converts the price of one token0 in token1 to the pair token order
+func spotPrice(tokenA token.ERC20, token0 token.ERC20, price0In1 *big.Rat) pool.Price {
+	if tokenA.Address == token0.Address {
+		return pool.NewPrice(price0In1)
+	}
+	return pool.NewPrice(new(big.Rat).Inv(price0In1))
+}
+
+// equalInt compares two optional integers, nil only equals nil
+func equalInt(a *big.Int, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
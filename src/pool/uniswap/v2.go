@@ -1,33 +1,48 @@
 package uniswap
 
 import (
+	"PoolHelper/src/pool"
 	"PoolHelper/src/structs/pair"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"math/big"
+	"sync"
 	"time"
 )
 
+// FeeDenominator is the denominator of the V2 swap fee (basis points)
+const FeeDenominator = 10_000
+
+// DefaultSwapFee is the 0.3% swap fee of the Uniswap V2 pools (basis points), used by factories configured without a fee
+const DefaultSwapFee = 30
+
 type V2Pool struct {
 	factory  common.Address
 	pair     pair.Pair[any]
 	reserve0 *big.Int
 	reserve1 *big.Int
 	initHash common.Hash
+	fee      uint64
+	m        sync.RWMutex
 
 	lastUpdateBlock     uint64
 	lastUpdateTimestamp uint64
+	history             *pool.History[Reserves]
 }
 
-func NewV2Pool(factory common.Address, initCode common.Hash, pair pair.Pair[any]) *V2Pool {
+// NewV2Pool creates a V2 pool charging fee basis points, a zero fee is a fee-free fork
+func NewV2Pool(factory common.Address, initCode common.Hash, fee uint64, pair pair.Pair[any]) *V2Pool {
 	return &V2Pool{
 		pair:                pair,
 		factory:             factory,
 		reserve0:            big.NewInt(0),
 		reserve1:            big.NewInt(0),
 		initHash:            initCode,
+		fee:                 fee,
+		m:                   sync.RWMutex{},
 		lastUpdateBlock:     0,
 		lastUpdateTimestamp: 0,
+		history:             pool.NewHistory[Reserves](pool.DefaultHistorySize),
 	}
 }
 
@@ -36,8 +51,13 @@ func NewV2Pool(factory common.Address, initCode common.Hash, pair pair.Pair[any]
 ///
 
 type Reserves struct {
-	Reserve0 *big.Int
-	Reserve1 *big.Int
+	Reserve0 *big.Int `json:"reserve0"`
+	Reserve1 *big.Int `json:"reserve1"`
+}
+
+// Equal returns true if both reserves are equal
+func (r Reserves) Equal(o Reserves) bool {
+	return equalInt(r.Reserve0, o.Reserve0) && equalInt(r.Reserve1, o.Reserve1)
 }
 
 func (p *V2Pool) Pair() pair.Pair[any] {
@@ -58,13 +78,27 @@ func (p *V2Pool) Address() common.Address {
 }
 
 func (p *V2Pool) Update(res Reserves, block uint64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
 	p.reserve0.Set(res.Reserve0)
 	p.reserve1.Set(res.Reserve1)
 	p.lastUpdateTimestamp = uint64(time.Now().Unix())
 	p.lastUpdateBlock = block
+	p.history.Push(pool.Record[Reserves]{
+		Block:     block,
+		Timestamp: p.lastUpdateTimestamp,
+		State: Reserves{
+			Reserve0: new(big.Int).Set(res.Reserve0),
+			Reserve1: new(big.Int).Set(res.Reserve1),
+		},
+	})
 }
 
 func (p *V2Pool) State() (Reserves, uint64, uint64) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
 	return Reserves{
 		Reserve0: new(big.Int).Set(p.reserve0),
 		Reserve1: new(big.Int).Set(p.reserve1),
@@ -74,3 +108,162 @@ func (p *V2Pool) State() (Reserves, uint64, uint64) {
 func (p *V2Pool) Factory() common.Address {
 	return p.factory
 }
+
+func (p *V2Pool) Fee() uint64 {
+	return p.fee
+}
+
+///
+/// History
+///
+
+// SetHistorySize sets the number of synced states kept, older states are dropped
+func (p *V2Pool) SetHistorySize(size int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.history.Resize(size)
+}
+
+// StateAt returns the reserves of the pool at a block, the last reserves synced at or before it
+func (p *V2Pool) StateAt(block uint64) (pool.Record[Reserves], error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if r, ok := p.history.Find(block); ok {
+		return r, nil
+	}
+	return pool.Record[Reserves]{}, pool.StateNotFound
+}
+
+// States returns the reserves synced between two blocks (inclusive), oldest first
+func (p *V2Pool) States(from uint64, to uint64) []pool.Record[Reserves] {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.history.Range(from, to)
+}
+
+// PriceAt returns the spot price of the pool pair at a block
+func (p *V2Pool) PriceAt(block uint64) (pool.Price, error) {
+	r, err := p.StateAt(block)
+	if err != nil {
+		return pool.Price{}, err
+	}
+	return p.price(r.State)
+}
+
+// PriceChange returns the change of the spot price between the last synced block and the given number of blocks before it
+func (p *V2Pool) PriceChange(blocks uint64) (pool.PriceChange, error) {
+	reserves, block, _ := p.State()
+	to, err := p.price(reserves)
+	if err != nil {
+		return pool.PriceChange{}, err
+	}
+
+	fromBlock := block - min(blocks, block)
+	from, err := p.PriceAt(fromBlock)
+	if err != nil {
+		return pool.PriceChange{}, err
+	}
+	return pool.NewPriceChange(fromBlock, from, block, to), nil
+}
+
+///
+/// Price
+///
+
+// Price returns the spot price of the pool pair from the reserves
+func (p *V2Pool) Price() (pool.Price, error) {
+	reserves, _, _ := p.State()
+	return p.price(reserves)
+}
+
+// price returns the spot price of the pool pair at the given reserves
+func (p *V2Pool) price(reserves Reserves) (pool.Price, error) {
+	token0, token1 := p.pair.SortTokens()
+	if token0.Decimals == nil || token1.Decimals == nil {
+		return pool.Price{}, InvalidDecimals
+	}
+
+	if reserves.Reserve0.Sign() == 0 || reserves.Reserve1.Sign() == 0 {
+		return pool.Price{}, InsufficientLiquidity
+	}
+
+	// price = reserve1 / 10^decimals1 / (reserve0 / 10^decimals0)
+	num := new(big.Int).Mul(reserves.Reserve1, pow10(token0.Decimals))
+	den := new(big.Int).Mul(reserves.Reserve0, pow10(token1.Decimals))
+
+	return spotPrice(p.pair.TokenA, token0, new(big.Rat).SetFrac(num, den)), nil
+}
+
+///
+/// Quote
+///
+
+// AmountOut returns the output amount for swapping amountIn of tokenIn
+// mirrors UniswapV2Library.getAmountOut rounding
+func (p *V2Pool) AmountOut(tokenIn common.Address, amountIn *big.Int) (*big.Int, error) {
+	if amountIn == nil || amountIn.Sign() <= 0 {
+		return nil, InsufficientInputAmount
+	}
+
+	reserveIn, reserveOut, err := p.reserves(tokenIn)
+	if err != nil {
+		return nil, err
+	}
+	if reserveIn.Sign() == 0 || reserveOut.Sign() == 0 {
+		return nil, InsufficientLiquidity
+	}
+
+	// amountInWithFee = amountIn * (10000 - fee)
+	amountInWithFee := new(big.Int).Mul(amountIn, new(big.Int).SetUint64(FeeDenominator-p.fee))
+
+	// amountOut = amountInWithFee * reserveOut / (reserveIn * 10000 + amountInWithFee)
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(FeeDenominator))
+	denominator.Add(denominator, amountInWithFee)
+
+	return numerator.Quo(numerator, denominator), nil
+}
+
+// AmountIn returns the input amount required to receive amountOut of tokenOut
+// mirrors UniswapV2Library.getAmountIn rounding
+func (p *V2Pool) AmountIn(tokenOut common.Address, amountOut *big.Int) (*big.Int, error) {
+	if amountOut == nil || amountOut.Sign() <= 0 {
+		return nil, InsufficientOutputAmount
+	}
+
+	reserveOut, reserveIn, err := p.reserves(tokenOut)
+	if err != nil {
+		return nil, err
+	}
+	if reserveIn.Sign() == 0 || reserveOut.Cmp(amountOut) <= 0 {
+		return nil, InsufficientLiquidity
+	}
+
+	// amountIn = reserveIn * amountOut * 10000 / ((reserveOut - amountOut) * (10000 - fee)) + 1
+	numerator := new(big.Int).Mul(reserveIn, amountOut)
+	numerator.Mul(numerator, big.NewInt(FeeDenominator))
+	denominator := new(big.Int).Sub(reserveOut, amountOut)
+	denominator.Mul(denominator, new(big.Int).SetUint64(FeeDenominator-p.fee))
+
+	amountIn := numerator.Quo(numerator, denominator)
+	return amountIn.Add(amountIn, big.NewInt(1)), nil
+}
+
+// reserves returns the reserves ordered as (token, other token)
+func (p *V2Pool) reserves(token common.Address) (*big.Int, *big.Int, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	token0, token1 := p.pair.SortAddresses()
+	switch token {
+	case token0:
+		return new(big.Int).Set(p.reserve0), new(big.Int).Set(p.reserve1), nil
+	case token1:
+		return new(big.Int).Set(p.reserve1), new(big.Int).Set(p.reserve0), nil
+	default:
+		return nil, nil, InvalidToken
+	}
+}
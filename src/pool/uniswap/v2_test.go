@@ -1,10 +1,13 @@
 package uniswap_test
 
 import (
+	"PoolHelper/src/pool"
 	"PoolHelper/src/pool/uniswap"
 	"PoolHelper/src/structs/pair"
 	"PoolHelper/src/structs/token"
+	"errors"
 	"github.com/ethereum/go-ethereum/common"
+	"math/big"
 	"testing"
 )
 
@@ -16,7 +19,7 @@ func TestAddressCalculation(t *testing.T) {
 	tokenA := common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
 	tokenB := common.HexToAddress("0xdac17f958d2ee523a2206206994597c13d831ec7")
 
-	p := uniswap.NewV2Pool(factory, common.HexToHash(initHash), pair.Pair[any]{
+	p := uniswap.NewV2Pool(factory, common.HexToHash(initHash), 30, pair.Pair[any]{
 		TokenA: token.ERC20{
 			Address: tokenA,
 		},
@@ -31,3 +34,149 @@ func TestAddressCalculation(t *testing.T) {
 		t.Fatalf("expected %v, got %v", expected, p.Address())
 	}
 }
+
+func newQuotePool() (*uniswap.V2Pool, common.Address, common.Address) {
+	factory := common.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f")
+	weth := common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+	usdt := common.HexToAddress("0xdac17f958d2ee523a2206206994597c13d831ec7")
+
+	p := uniswap.NewV2Pool(factory, common.HexToHash(initHash), 30, pair.Pair[any]{
+		TokenA: token.ERC20{Address: usdt},
+		TokenB: token.ERC20{Address: weth},
+	})
+
+	// 1000 WETH / 2,000,000 USDT
+	reserve0, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	reserve1, _ := new(big.Int).SetString("2000000000000", 10)
+	p.Update(uniswap.Reserves{Reserve0: reserve0, Reserve1: reserve1}, 1)
+
+	return p, weth, usdt
+}
+
+// TestV2Pool_AmountOut tests the getAmountOut rounding of a UniswapV2 pool.
+func TestV2Pool_AmountOut(t *testing.T) {
+	p, weth, usdt := newQuotePool()
+
+	amountOut, err := p.AmountOut(weth, big.NewInt(1e18))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := big.NewInt(1992013962)
+	if amountOut.Cmp(expected) != 0 {
+		t.Fatalf("expected %v, got %v", expected, amountOut)
+	}
+
+	// a zero fee pool of a fee-free fork quotes without a fee
+	free := uniswap.NewV2Pool(p.Factory(), common.HexToHash(initHash), 0, pair.Pair[any]{TokenA: token.ERC20{Address: usdt}, TokenB: token.ERC20{Address: weth}})
+	reserves, block, _ := p.State()
+	free.Update(reserves, block)
+	if amountOut, err := free.AmountOut(weth, big.NewInt(1e18)); err != nil || free.Fee() != 0 || amountOut.Cmp(big.NewInt(1998001998)) != 0 {
+		t.Errorf("wrong quote without a fee: %v %v", amountOut, err)
+	}
+}
+
+// TestV2Pool_AmountIn tests the getAmountIn rounding of a UniswapV2 pool.
+func TestV2Pool_AmountIn(t *testing.T) {
+	p, _, usdt := newQuotePool()
+
+	amountIn, err := p.AmountIn(usdt, big.NewInt(1000e6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := big.NewInt(501755391236239986)
+	if amountIn.Cmp(expected) != 0 {
+		t.Fatalf("expected %v, got %v", expected, amountIn)
+	}
+}
+
+// TestV2Pool_QuoteErrors tests the invalid quote inputs of a UniswapV2 pool.
+func TestV2Pool_QuoteErrors(t *testing.T) {
+	p, weth, usdt := newQuotePool()
+
+	if _, err := p.AmountOut(common.Address{}, big.NewInt(1)); !errors.Is(err, uniswap.InvalidToken) {
+		t.Errorf("expected invalid token, got %v", err)
+	}
+	if _, err := p.AmountOut(weth, big.NewInt(0)); !errors.Is(err, uniswap.InsufficientInputAmount) {
+		t.Errorf("expected insufficient input amount, got %v", err)
+	}
+	if _, err := p.AmountIn(usdt, big.NewInt(2_000_000e6)); !errors.Is(err, uniswap.InsufficientLiquidity) {
+		t.Errorf("expected insufficient liquidity, got %v", err)
+	}
+}
+
+// TestV2Pool_Price tests the decimal adjusted spot price of a UniswapV2 pool.
+func TestV2Pool_Price(t *testing.T) {
+	p, weth, usdt := newQuotePool()
+	if _, err := p.Price(); !errors.Is(err, uniswap.InvalidDecimals) {
+		t.Errorf("expected invalid decimals, got %v", err)
+	}
+
+	// same reserves with decimals
+	reserves, _, _ := p.State()
+	p = uniswap.NewV2Pool(p.Factory(), common.HexToHash(initHash), 30, pair.Pair[any]{
+		TokenA: token.ERC20{Address: usdt, Decimals: big.NewInt(6)},
+		TokenB: token.ERC20{Address: weth, Decimals: big.NewInt(18)},
+	})
+	p.Update(reserves, 1)
+
+	price, err := p.Price()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.AInB.Cmp(big.NewRat(1, 2000)) != 0 {
+		t.Errorf("expected 1/2000, got %v", price.AInB)
+	}
+	if price.BInA.Cmp(big.NewRat(2000, 1)) != 0 || price.BInAFloat() != 2000 {
+		t.Errorf("expected 2000, got %v", price.BInA)
+	}
+}
+
+// TestV2Pool_History tests the state history and price change of a UniswapV2 pool.
+func TestV2Pool_History(t *testing.T) {
+	weth := common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+	usdt := common.HexToAddress("0xdac17f958d2ee523a2206206994597c13d831ec7")
+	p := uniswap.NewV2Pool(common.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"), common.HexToHash(initHash), 30, pair.Pair[any]{
+		TokenA: token.ERC20{Address: usdt, Decimals: big.NewInt(0)},
+		TokenB: token.ERC20{Address: weth, Decimals: big.NewInt(0)},
+	})
+	p.SetHistorySize(3)
+
+	// the price of one WETH (token0) in USDT is 1, 2, 3, 4 at blocks 10, 20, 30, 40
+	for i := int64(1); i <= 4; i++ {
+		p.Update(uniswap.Reserves{Reserve0: big.NewInt(100), Reserve1: big.NewInt(100 * i)}, uint64(i*10))
+	}
+
+	// the oldest state is dropped
+	if _, err := p.StateAt(15); !errors.Is(err, pool.StateNotFound) {
+		t.Errorf("expected state not found, got %v", err)
+	}
+	r, err := p.StateAt(35)
+	if err != nil || r.Block != 30 || r.State.Reserve1.Int64() != 300 {
+		t.Errorf("wrong state at 35: %+v %v", r, err)
+	}
+	if states := p.States(25, 40); len(states) != 2 || states[0].Block != 30 || states[1].Block != 40 {
+		t.Errorf("wrong states: %+v", states)
+	}
+
+	change, err := p.PriceChange(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.FromBlock != 20 || change.ToBlock != 40 || change.BInA().Cmp(big.NewRat(1, 1)) != 0 {
+		t.Errorf("wrong price change: %+v %v", change, change.BInA())
+	}
+	if change.AInB().Cmp(big.NewRat(-1, 2)) != 0 {
+		t.Errorf("expected -1/2, got %v", change.AInB())
+	}
+	if _, err := p.PriceChange(30); !errors.Is(err, pool.StateNotFound) {
+		t.Errorf("expected state not found, got %v", err)
+	}
+
+	// a state of an earlier block replaces the later states
+	p.Update(uniswap.Reserves{Reserve0: big.NewInt(100), Reserve1: big.NewInt(500)}, 30)
+	if states := p.States(0, 40); len(states) != 2 || states[1].Block != 30 || states[1].State.Reserve1.Int64() != 500 {
+		t.Errorf("wrong states after rollback: %+v", states)
+	}
+}
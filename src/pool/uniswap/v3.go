@@ -1,11 +1,13 @@
 package uniswap
 
 import (
+	"PoolHelper/src/pool"
 	"PoolHelper/src/structs/pair"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"math/big"
+	"sync"
 	"time"
 )
 
@@ -22,11 +24,13 @@ type V3Pool struct {
 	pair     pair.Pair[V3FeeType]
 	factory  common.Address
 	initHash common.Hash
+	m        sync.RWMutex
 
-	// slot
-	slot                Slot0
+	// state
+	state               V3State
 	lastUpdateBlock     uint64
 	lastUpdateTimestamp uint64
+	history             *pool.History[V3State]
 }
 
 func NewV3Pool(factory common.Address, initHash common.Hash, pair pair.Pair[V3FeeType]) *V3Pool {
@@ -34,21 +38,97 @@ func NewV3Pool(factory common.Address, initHash common.Hash, pair pair.Pair[V3Fe
 		pair:     pair,
 		factory:  factory,
 		initHash: initHash,
+		m:        sync.RWMutex{},
+		history:  pool.NewHistory[V3State](pool.DefaultHistorySize),
 	}
 }
 
 ///
-/// Slot
+/// State
 ///
 
 type Slot0 struct {
-	SqrtPriceX96               *big.Int
-	Tick                       *big.Int
-	ObservationIndex           *big.Int
-	ObservationCardinality     *big.Int
-	ObservationCardinalityNext *big.Int
-	FeeProtocol                *big.Int
-	Unlocked                   bool
+	SqrtPriceX96               *big.Int `json:"sqrtPriceX96"`
+	Tick                       *big.Int `json:"tick"`
+	ObservationIndex           *big.Int `json:"observationIndex"`
+	ObservationCardinality     *big.Int `json:"observationCardinality"`
+	ObservationCardinalityNext *big.Int `json:"observationCardinalityNext"`
+	FeeProtocol                *big.Int `json:"feeProtocol"`
+	Unlocked                   bool     `json:"unlocked"`
+}
+
+// Equal returns true if both slots are equal
+func (s Slot0) Equal(o Slot0) bool {
+	return equalInt(s.SqrtPriceX96, o.SqrtPriceX96) &&
+		equalInt(s.Tick, o.Tick) &&
+		equalInt(s.ObservationIndex, o.ObservationIndex) &&
+		equalInt(s.ObservationCardinality, o.ObservationCardinality) &&
+		equalInt(s.ObservationCardinalityNext, o.ObservationCardinalityNext) &&
+		equalInt(s.FeeProtocol, o.FeeProtocol) &&
+		s.Unlocked == o.Unlocked
+}
+
+// slot0Outputs are the return types of UniswapV3Pool.slot0
+var slot0Outputs = abi.Arguments{
+	{Name: "sqrtPriceX96", Type: mustType("uint160")},
+	{Name: "tick", Type: mustType("int24")},
+	{Name: "observationIndex", Type: mustType("uint16")},
+	{Name: "observationCardinality", Type: mustType("uint16")},
+	{Name: "observationCardinalityNext", Type: mustType("uint16")},
+	{Name: "feeProtocol", Type: mustType("uint8")},
+	{Name: "unlocked", Type: mustType("bool")},
+}
+
+// DecodeSlot0 decodes the return data of UniswapV3Pool.slot0
+func DecodeSlot0(data []byte) (Slot0, error) {
+	values, err := slot0Outputs.Unpack(data)
+	if err != nil {
+		return Slot0{}, err
+	}
+
+	return Slot0{
+		SqrtPriceX96:               values[0].(*big.Int),
+		Tick:                       values[1].(*big.Int),
+		ObservationIndex:           new(big.Int).SetUint64(uint64(values[2].(uint16))),
+		ObservationCardinality:     new(big.Int).SetUint64(uint64(values[3].(uint16))),
+		ObservationCardinalityNext: new(big.Int).SetUint64(uint64(values[4].(uint16))),
+		FeeProtocol:                new(big.Int).SetUint64(uint64(values[5].(uint8))),
+		Unlocked:                   values[6].(bool),
+	}, nil
+}
+
+// Tick is an initialized tick of a V3 pool
+type Tick struct {
+	Index          int      `json:"index"`
+	LiquidityGross *big.Int `json:"liquidityGross"`
+	LiquidityNet   *big.Int `json:"liquidityNet"`
+}
+
+// V3State is the synced state of a V3 pool
+type V3State struct {
+	Slot0       Slot0    `json:"slot0"`
+	Liquidity   *big.Int `json:"liquidity"`
+	TickSpacing int      `json:"tickSpacing"`
+
+	// Ticks are the initialized ticks sorted by index
+	// only the tick bitmap words between MinWord and MaxWord are synced
+	Ticks   []Tick `json:"ticks"`
+	MinWord int    `json:"minWord"`
+	MaxWord int    `json:"maxWord"`
+}
+
+// Equal returns true if both states are equal
+func (s V3State) Equal(o V3State) bool {
+	if !s.Slot0.Equal(o.Slot0) || !equalInt(s.Liquidity, o.Liquidity) || s.TickSpacing != o.TickSpacing ||
+		s.MinWord != o.MinWord || s.MaxWord != o.MaxWord || len(s.Ticks) != len(o.Ticks) {
+		return false
+	}
+	for i, t := range s.Ticks {
+		if t.Index != o.Ticks[i].Index || !equalInt(t.LiquidityGross, o.Ticks[i].LiquidityGross) || !equalInt(t.LiquidityNet, o.Ticks[i].LiquidityNet) {
+			return false
+		}
+	}
+	return true
 }
 
 func (p *V3Pool) Pair() pair.Pair[V3FeeType] {
@@ -80,16 +160,194 @@ func (p *V3Pool) Address() common.Address {
 	return common.BytesToAddress(addressBytes)
 }
 
-func (p *V3Pool) Update(slot Slot0, block uint64) {
-	p.slot = slot
+func (p *V3Pool) Update(state V3State, block uint64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.state = state
 	p.lastUpdateBlock = block
 	p.lastUpdateTimestamp = uint64(time.Now().Unix())
+	p.history.Push(pool.Record[V3State]{Block: block, Timestamp: p.lastUpdateTimestamp, State: state})
 }
 
-func (p *V3Pool) State() (Slot0, uint64, uint64) {
-	return p.slot, p.lastUpdateBlock, p.lastUpdateTimestamp
+func (p *V3Pool) State() (V3State, uint64, uint64) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.state, p.lastUpdateBlock, p.lastUpdateTimestamp
 }
 
 func (p *V3Pool) Factory() common.Address {
 	return p.factory
 }
+
+///
+/// History
+///
+
+// SetHistorySize sets the number of synced states kept, older states are dropped
+func (p *V3Pool) SetHistorySize(size int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.history.Resize(size)
+}
+
+// StateAt returns the state of the pool at a block, the last state synced at or before it
+func (p *V3Pool) StateAt(block uint64) (pool.Record[V3State], error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if r, ok := p.history.Find(block); ok {
+		return r, nil
+	}
+	return pool.Record[V3State]{}, pool.StateNotFound
+}
+
+// States returns the states synced between two blocks (inclusive), oldest first
+func (p *V3Pool) States(from uint64, to uint64) []pool.Record[V3State] {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.history.Range(from, to)
+}
+
+// PriceAt returns the spot price of the pool pair at a block
+func (p *V3Pool) PriceAt(block uint64) (pool.Price, error) {
+	r, err := p.StateAt(block)
+	if err != nil {
+		return pool.Price{}, err
+	}
+	return p.price(r.State)
+}
+
+// PriceChange returns the change of the spot price between the last synced block and the given number of blocks before it
+func (p *V3Pool) PriceChange(blocks uint64) (pool.PriceChange, error) {
+	state, block, _ := p.State()
+	to, err := p.price(state)
+	if err != nil {
+		return pool.PriceChange{}, err
+	}
+
+	fromBlock := block - min(blocks, block)
+	from, err := p.PriceAt(fromBlock)
+	if err != nil {
+		return pool.PriceChange{}, err
+	}
+	return pool.NewPriceChange(fromBlock, from, block, to), nil
+}
+
+///
+/// Price
+///
+
+// Price returns the spot price of the pool pair from slot0
+func (p *V3Pool) Price() (pool.Price, error) {
+	state, _, _ := p.State()
+	return p.price(state)
+}
+
+// price returns the spot price of the pool pair at the given state
+func (p *V3Pool) price(state V3State) (pool.Price, error) {
+	token0, token1 := p.pair.SortTokens()
+	if token0.Decimals == nil || token1.Decimals == nil {
+		return pool.Price{}, InvalidDecimals
+	}
+
+	if state.Slot0.SqrtPriceX96 == nil || state.Slot0.SqrtPriceX96.Sign() == 0 {
+		return pool.Price{}, InsufficientLiquidity
+	}
+
+	price := SqrtPriceX96ToPrice(state.Slot0.SqrtPriceX96, token0.Decimals, token1.Decimals)
+	return spotPrice(p.pair.TokenA, token0, price), nil
+}
+
+///
+/// Quote
+///
+
+// AmountOut returns the output amount for swapping amountIn of tokenIn
+// fails if the pool can not fill the whole input amount
+func (p *V3Pool) AmountOut(tokenIn common.Address, amountIn *big.Int) (*big.Int, error) {
+	if amountIn == nil || amountIn.Sign() <= 0 {
+		return nil, InsufficientInputAmount
+	}
+
+	zeroForOne, err := p.zeroForOne(tokenIn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// simulate the swap
+	state, _, _ := p.State()
+	res, err := state.Swap(p.pair.PairOptions, zeroForOne, amountIn, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	amount0, amount1 := res.Amount0, res.Amount1
+	if !zeroForOne {
+		amount0, amount1 = amount1, amount0
+	}
+	if amount0.Cmp(amountIn) != 0 {
+		return nil, InsufficientLiquidity
+	}
+
+	return amount1.Neg(amount1), nil
+}
+
+// AmountIn returns the input amount required to receive amountOut of tokenOut
+// fails if the pool can not fill the whole output amount
+func (p *V3Pool) AmountIn(tokenOut common.Address, amountOut *big.Int) (*big.Int, error) {
+	if amountOut == nil || amountOut.Sign() <= 0 {
+		return nil, InsufficientOutputAmount
+	}
+
+	zeroForOne, err := p.zeroForOne(tokenOut, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// simulate the swap
+	state, _, _ := p.State()
+	res, err := state.Swap(p.pair.PairOptions, zeroForOne, new(big.Int).Neg(amountOut), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	amount0, amount1 := res.Amount0, res.Amount1
+	if !zeroForOne {
+		amount0, amount1 = amount1, amount0
+	}
+	if new(big.Int).Neg(amount1).Cmp(amountOut) != 0 {
+		return nil, InsufficientLiquidity
+	}
+
+	return amount0, nil
+}
+
+// zeroForOne returns the swap direction for the given token
+// isInput tells whether the token is the input or the output of the swap
+func (p *V3Pool) zeroForOne(token common.Address, isInput bool) (bool, error) {
+	token0, token1 := p.pair.SortAddresses()
+	switch token {
+	case token0:
+		return isInput, nil
+	case token1:
+		return !isInput, nil
+	default:
+		return false, InvalidToken
+	}
+}
+
+///
+/// Utils
+///
+
+func mustType(t string) abi.Type {
+	typ, err := abi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
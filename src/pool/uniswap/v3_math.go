@@ -0,0 +1,362 @@
+package uniswap
+
+import (
+	"math"
+	"math/big"
+)
+
+///
+/// Constants
+///
+
+const (
+	MinTick = -887272
+	MaxTick = 887272
+
+	// FeePipsDenominator is the denominator of the V3 fee types (hundredths of a bip)
+	FeePipsDenominator = 1_000_000
+)
+
+var (
+	Q96          = new(big.Int).Lsh(big.NewInt(1), 96)
+	MinSqrtRatio = big.NewInt(4295128739)
+	MaxSqrtRatio = mustBig("1461446703485210103287273052203988822378723970342")
+
+	maxUint160 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	mask32     = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 32), big.NewInt(1))
+
+	// tickRatios are the TickMath.getSqrtRatioAtTick magic numbers
+	// the ratio of bit i is 1 / sqrt(1.0001)^(2^i) as a Q128.128
+	tickRatios = []*big.Int{
+		mustHex("fffcb933bd6fad37aa2d162d1a594001"),
+		mustHex("fff97272373d413259a46990580e213a"),
+		mustHex("fff2e50f5f656932ef12357cf3c7fdcc"),
+		mustHex("ffe5caca7e10e4e61c3624eaa0941cd0"),
+		mustHex("ffcb9843d60f6159c9db58835c926644"),
+		mustHex("ff973b41fa98c081472e6896dfb254c0"),
+		mustHex("ff2ea16466c96a3843ec78b326b52861"),
+		mustHex("fe5dee046a99a2a811c461f1969c3053"),
+		mustHex("fcbe86c7900a88aedcffc83b479aa3a4"),
+		mustHex("f987a7253ac413176f2b074cf7815e54"),
+		mustHex("f3392b0822b70005940c7a398e4b70f3"),
+		mustHex("e7159475a2c29b7443b29c7fa6e889d9"),
+		mustHex("d097f3bdfd2022b8845ad8f792aa5825"),
+		mustHex("a9f746462d870fdf8a65dc1f90e061e5"),
+		mustHex("70d869a156d2a1b890bb3df62baf32f7"),
+		mustHex("31be135f97d08fd981231505542fcfa6"),
+		mustHex("9aa508b5b7a84e1c677de54f3e99bc9"),
+		mustHex("5d6af8dedb81196699c329225ee604"),
+		mustHex("2216e584f5fa1ea926041bedfe98"),
+		mustHex("48a170391f7dc42444e8fa2"),
+	}
+)
+
+///
+/// Tick Math
+///
+
+// GetSqrtRatioAtTick returns sqrt(1.0001^tick) as a Q64.96
+// mirrors TickMath.getSqrtRatioAtTick
+func GetSqrtRatioAtTick(tick int) (*big.Int, error) {
+	absTick := tick
+	if absTick < 0 {
+		absTick = -absTick
+	}
+	if absTick > MaxTick {
+		return nil, InvalidTick
+	}
+
+	ratio := new(big.Int).Lsh(big.NewInt(1), 128)
+	if absTick&0x1 != 0 {
+		ratio.Set(tickRatios[0])
+	}
+	for i := 1; i < len(tickRatios); i++ {
+		if absTick&(1<<i) != 0 {
+			ratio.Mul(ratio, tickRatios[i])
+			ratio.Rsh(ratio, 128)
+		}
+	}
+	if tick > 0 {
+		ratio.Quo(maxUint256, ratio)
+	}
+
+	// round up when converting from Q128.128 to Q64.96
+	roundUp := new(big.Int).And(ratio, mask32).Sign() != 0
+	ratio.Rsh(ratio, 32)
+	if roundUp {
+		ratio.Add(ratio, big.NewInt(1))
+	}
+
+	return ratio, nil
+}
+
+// GetTickAtSqrtRatio returns the greatest tick for which GetSqrtRatioAtTick(tick) <= sqrtPriceX96
+// mirrors TickMath.getTickAtSqrtRatio
+func GetTickAtSqrtRatio(sqrtPriceX96 *big.Int) (int, error) {
+	if sqrtPriceX96.Cmp(MinSqrtRatio) < 0 || sqrtPriceX96.Cmp(MaxSqrtRatio) >= 0 {
+		return 0, InvalidSqrtPrice
+	}
+
+	// estimate the tick with floating point
+	// tick = log(sqrtPrice / 2^96) * 2 / log(1.0001)
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(sqrtPriceX96), new(big.Float).SetInt(Q96)).Float64()
+	tick := int(math.Floor(2 * math.Log(ratio) / math.Log(1.0001)))
+	tick = max(MinTick, min(MaxTick-1, tick))
+
+	// correct the estimate with the exact tick math
+	for tick > MinTick {
+		sqrtRatio, _ := GetSqrtRatioAtTick(tick)
+		if sqrtRatio.Cmp(sqrtPriceX96) <= 0 {
+			break
+		}
+		tick--
+	}
+	for tick < MaxTick {
+		sqrtRatio, _ := GetSqrtRatioAtTick(tick + 1)
+		if sqrtRatio.Cmp(sqrtPriceX96) > 0 {
+			break
+		}
+		tick++
+	}
+
+	return tick, nil
+}
+
+///
+/// Full Math
+///
+
+// mulDiv returns floor(a * b / denominator)
+func mulDiv(a, b, denominator *big.Int) *big.Int {
+	product := new(big.Int).Mul(a, b)
+	return product.Quo(product, denominator)
+}
+
+// mulDivRoundingUp returns ceil(a * b / denominator)
+func mulDivRoundingUp(a, b, denominator *big.Int) *big.Int {
+	return divRoundingUp(new(big.Int).Mul(a, b), denominator)
+}
+
+// divRoundingUp returns ceil(a / b)
+func divRoundingUp(a, b *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+	if remainder.Sign() != 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	return quotient
+}
+
+// fitsUint256 returns true if the value does not overflow a uint256
+func fitsUint256(v *big.Int) bool {
+	return v.Sign() >= 0 && v.BitLen() <= 256
+}
+
+///
+/// Sqrt Price Math
+///
+
+// getNextSqrtPriceFromAmount0RoundingUp mirrors SqrtPriceMath.getNextSqrtPriceFromAmount0RoundingUp
+func getNextSqrtPriceFromAmount0RoundingUp(sqrtPX96, liquidity, amount *big.Int, add bool) (*big.Int, error) {
+	if amount.Sign() == 0 {
+		return new(big.Int).Set(sqrtPX96), nil
+	}
+
+	numerator1 := new(big.Int).Lsh(liquidity, 96)
+	product := new(big.Int).Mul(amount, sqrtPX96)
+
+	if add {
+		if fitsUint256(product) {
+			denominator := new(big.Int).Add(numerator1, product)
+			if fitsUint256(denominator) {
+				return mulDivRoundingUp(numerator1, sqrtPX96, denominator), nil
+			}
+		}
+
+		// numerator1 / (numerator1 / sqrtPX96 + amount)
+		denominator := new(big.Int).Quo(numerator1, sqrtPX96)
+		return divRoundingUp(numerator1, denominator.Add(denominator, amount)), nil
+	}
+
+	if !fitsUint256(product) || numerator1.Cmp(product) <= 0 {
+		return nil, InsufficientLiquidity
+	}
+	denominator := new(big.Int).Sub(numerator1, product)
+	return mulDivRoundingUp(numerator1, sqrtPX96, denominator), nil
+}
+
+// getNextSqrtPriceFromAmount1RoundingDown mirrors SqrtPriceMath.getNextSqrtPriceFromAmount1RoundingDown
+func getNextSqrtPriceFromAmount1RoundingDown(sqrtPX96, liquidity, amount *big.Int, add bool) (*big.Int, error) {
+	if add {
+		quotient := mulDiv(amount, Q96, liquidity)
+		return quotient.Add(quotient, sqrtPX96), nil
+	}
+
+	quotient := mulDivRoundingUp(amount, Q96, liquidity)
+	if sqrtPX96.Cmp(quotient) <= 0 {
+		return nil, InsufficientLiquidity
+	}
+	return quotient.Sub(sqrtPX96, quotient), nil
+}
+
+// getNextSqrtPriceFromInput mirrors SqrtPriceMath.getNextSqrtPriceFromInput
+func getNextSqrtPriceFromInput(sqrtPX96, liquidity, amountIn *big.Int, zeroForOne bool) (*big.Int, error) {
+	if sqrtPX96.Sign() <= 0 || liquidity.Sign() <= 0 {
+		return nil, InsufficientLiquidity
+	}
+	if zeroForOne {
+		return getNextSqrtPriceFromAmount0RoundingUp(sqrtPX96, liquidity, amountIn, true)
+	}
+	return getNextSqrtPriceFromAmount1RoundingDown(sqrtPX96, liquidity, amountIn, true)
+}
+
+// getNextSqrtPriceFromOutput mirrors SqrtPriceMath.getNextSqrtPriceFromOutput
+func getNextSqrtPriceFromOutput(sqrtPX96, liquidity, amountOut *big.Int, zeroForOne bool) (*big.Int, error) {
+	if sqrtPX96.Sign() <= 0 || liquidity.Sign() <= 0 {
+		return nil, InsufficientLiquidity
+	}
+	if zeroForOne {
+		return getNextSqrtPriceFromAmount1RoundingDown(sqrtPX96, liquidity, amountOut, false)
+	}
+	return getNextSqrtPriceFromAmount0RoundingUp(sqrtPX96, liquidity, amountOut, false)
+}
+
+// getAmount0Delta mirrors SqrtPriceMath.getAmount0Delta
+func getAmount0Delta(sqrtRatioAX96, sqrtRatioBX96, liquidity *big.Int, roundUp bool) *big.Int {
+	if sqrtRatioAX96.Cmp(sqrtRatioBX96) > 0 {
+		sqrtRatioAX96, sqrtRatioBX96 = sqrtRatioBX96, sqrtRatioAX96
+	}
+
+	numerator1 := new(big.Int).Lsh(liquidity, 96)
+	numerator2 := new(big.Int).Sub(sqrtRatioBX96, sqrtRatioAX96)
+
+	if roundUp {
+		return divRoundingUp(mulDivRoundingUp(numerator1, numerator2, sqrtRatioBX96), sqrtRatioAX96)
+	}
+	amount := mulDiv(numerator1, numerator2, sqrtRatioBX96)
+	return amount.Quo(amount, sqrtRatioAX96)
+}
+
+// getAmount1Delta mirrors SqrtPriceMath.getAmount1Delta
+func getAmount1Delta(sqrtRatioAX96, sqrtRatioBX96, liquidity *big.Int, roundUp bool) *big.Int {
+	if sqrtRatioAX96.Cmp(sqrtRatioBX96) > 0 {
+		sqrtRatioAX96, sqrtRatioBX96 = sqrtRatioBX96, sqrtRatioAX96
+	}
+
+	diff := new(big.Int).Sub(sqrtRatioBX96, sqrtRatioAX96)
+	if roundUp {
+		return mulDivRoundingUp(liquidity, diff, Q96)
+	}
+	return mulDiv(liquidity, diff, Q96)
+}
+
+///
+/// Swap Math
+///
+
+// swapStep is the result of a single swap step within one tick range
+type swapStep struct {
+	sqrtRatioNextX96 *big.Int
+	amountIn         *big.Int
+	amountOut        *big.Int
+	feeAmount        *big.Int
+}
+
+// computeSwapStep mirrors SwapMath.computeSwapStep
+// amountRemaining is positive for exact input and negative for exact output
+func computeSwapStep(sqrtRatioCurrentX96, sqrtRatioTargetX96, liquidity, amountRemaining *big.Int, feePips uint64) (swapStep, error) {
+	zeroForOne := sqrtRatioCurrentX96.Cmp(sqrtRatioTargetX96) >= 0
+	exactIn := amountRemaining.Sign() >= 0
+	fee := new(big.Int).SetUint64(feePips)
+	feeComplement := new(big.Int).SetUint64(FeePipsDenominator - feePips)
+
+	var err error
+	step := swapStep{}
+
+	if exactIn {
+		amountRemainingLessFee := mulDiv(amountRemaining, feeComplement, big.NewInt(FeePipsDenominator))
+		if zeroForOne {
+			step.amountIn = getAmount0Delta(sqrtRatioTargetX96, sqrtRatioCurrentX96, liquidity, true)
+		} else {
+			step.amountIn = getAmount1Delta(sqrtRatioCurrentX96, sqrtRatioTargetX96, liquidity, true)
+		}
+
+		if amountRemainingLessFee.Cmp(step.amountIn) >= 0 {
+			step.sqrtRatioNextX96 = new(big.Int).Set(sqrtRatioTargetX96)
+		} else {
+			step.sqrtRatioNextX96, err = getNextSqrtPriceFromInput(sqrtRatioCurrentX96, liquidity, amountRemainingLessFee, zeroForOne)
+			if err != nil {
+				return swapStep{}, err
+			}
+		}
+	} else {
+		if zeroForOne {
+			step.amountOut = getAmount1Delta(sqrtRatioTargetX96, sqrtRatioCurrentX96, liquidity, false)
+		} else {
+			step.amountOut = getAmount0Delta(sqrtRatioCurrentX96, sqrtRatioTargetX96, liquidity, false)
+		}
+
+		amountRemainingOut := new(big.Int).Neg(amountRemaining)
+		if amountRemainingOut.Cmp(step.amountOut) >= 0 {
+			step.sqrtRatioNextX96 = new(big.Int).Set(sqrtRatioTargetX96)
+		} else {
+			step.sqrtRatioNextX96, err = getNextSqrtPriceFromOutput(sqrtRatioCurrentX96, liquidity, amountRemainingOut, zeroForOne)
+			if err != nil {
+				return swapStep{}, err
+			}
+		}
+	}
+
+	isMax := sqrtRatioTargetX96.Cmp(step.sqrtRatioNextX96) == 0
+
+	// get the input/output amounts
+	if zeroForOne {
+		if !isMax || !exactIn {
+			step.amountIn = getAmount0Delta(step.sqrtRatioNextX96, sqrtRatioCurrentX96, liquidity, true)
+		}
+		if !isMax || exactIn {
+			step.amountOut = getAmount1Delta(step.sqrtRatioNextX96, sqrtRatioCurrentX96, liquidity, false)
+		}
+	} else {
+		if !isMax || !exactIn {
+			step.amountIn = getAmount1Delta(sqrtRatioCurrentX96, step.sqrtRatioNextX96, liquidity, true)
+		}
+		if !isMax || exactIn {
+			step.amountOut = getAmount0Delta(sqrtRatioCurrentX96, step.sqrtRatioNextX96, liquidity, false)
+		}
+	}
+
+	// cap the output amount to not exceed the remaining output amount
+	if !exactIn && step.amountOut.Cmp(new(big.Int).Neg(amountRemaining)) > 0 {
+		step.amountOut = new(big.Int).Neg(amountRemaining)
+	}
+
+	if exactIn && !isMax {
+		// take the remainder of the maximum input as fee
+		step.feeAmount = new(big.Int).Sub(amountRemaining, step.amountIn)
+	} else {
+		step.feeAmount = mulDivRoundingUp(step.amountIn, fee, feeComplement)
+	}
+
+	return step, nil
+}
+
+///
+/// Utils
+///
+
+func mustBig(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big int: " + s)
+	}
+	return v
+}
+
+func mustHex(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid hex big int: " + s)
+	}
+	return v
+}
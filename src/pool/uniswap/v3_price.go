@@ -0,0 +1,68 @@
+package uniswap
+
+import (
+	"math/big"
+)
+
+///
+/// Price Conversions
+///
+
+// SqrtPriceX96ToPrice returns the price of one token0 in token1 adjusted by the token decimals
+func SqrtPriceX96ToPrice(sqrtPriceX96 *big.Int, decimals0 *big.Int, decimals1 *big.Int) *big.Rat {
+	// price = sqrtPriceX96^2 / 2^192 * 10^decimals0 / 10^decimals1
+	num := new(big.Int).Mul(sqrtPriceX96, sqrtPriceX96)
+	num.Mul(num, pow10(decimals0))
+	den := new(big.Int).Lsh(big.NewInt(1), 192)
+	den.Mul(den, pow10(decimals1))
+
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// PriceToSqrtPriceX96 returns the sqrt price of a decimal adjusted price of one token0 in token1
+// the result is rounded down
+func PriceToSqrtPriceX96(price *big.Rat, decimals0 *big.Int, decimals1 *big.Int) (*big.Int, error) {
+	if price.Sign() <= 0 {
+		return nil, InvalidSqrtPrice
+	}
+
+	// sqrtPriceX96 = sqrt(price * 10^decimals1 / 10^decimals0 * 2^192)
+	num := new(big.Int).Mul(price.Num(), pow10(decimals1))
+	num.Lsh(num, 192)
+	den := new(big.Int).Mul(price.Denom(), pow10(decimals0))
+
+	return num.Quo(num, den).Sqrt(num), nil
+}
+
+// TickToPrice returns the price of one token0 in token1 at the given tick
+// the price is derived from the Q64.96 sqrt ratio of the tick
+func TickToPrice(tick int, decimals0 *big.Int, decimals1 *big.Int) (*big.Rat, error) {
+	sqrtPriceX96, err := GetSqrtRatioAtTick(tick)
+	if err != nil {
+		return nil, err
+	}
+
+	return SqrtPriceX96ToPrice(sqrtPriceX96, decimals0, decimals1), nil
+}
+
+// PriceToTick returns the greatest tick at or below the price of one token0 in token1
+func PriceToTick(price *big.Rat, decimals0 *big.Int, decimals1 *big.Int) (int, error) {
+	sqrtPriceX96, err := PriceToSqrtPriceX96(price, decimals0, decimals1)
+	if err != nil {
+		return 0, err
+	}
+
+	return GetTickAtSqrtRatio(sqrtPriceX96)
+}
+
+///
+/// Utils
+///
+
+// pow10 returns 10^exp, a nil exponent is treated as zero
+func pow10(exp *big.Int) *big.Int {
+	if exp == nil {
+		return big.NewInt(1)
+	}
+	return new(big.Int).Exp(big.NewInt(10), exp, nil)
+}
@@ -0,0 +1,291 @@
+package uniswap
+
+import (
+	"math/big"
+	"sort"
+)
+
+// SwapResult is the outcome of a simulated V3 swap
+// Amount0 and Amount1 are the pool balance deltas, positive amounts are paid to the pool
+type SwapResult struct {
+	Amount0      *big.Int
+	Amount1      *big.Int
+	SqrtPriceX96 *big.Int
+	Tick         int
+	Liquidity    *big.Int
+}
+
+// Swap simulates UniswapV3Pool.swap against the synced state
+// amountSpecified is positive for exact input and negative for exact output
+// a nil sqrtPriceLimitX96 swaps until the amount is filled or the price bound is reached
+func (s V3State) Swap(fee V3FeeType, zeroForOne bool, amountSpecified *big.Int, sqrtPriceLimitX96 *big.Int) (SwapResult, error) {
+	if amountSpecified == nil || amountSpecified.Sign() == 0 {
+		return SwapResult{}, InvalidAmount
+	}
+	// pools that were cached but never synced have no price, tick or tick spacing
+	if s.TickSpacing <= 0 || s.Slot0.SqrtPriceX96 == nil || s.Slot0.SqrtPriceX96.Sign() == 0 || s.Slot0.Tick == nil || s.Liquidity == nil {
+		return SwapResult{}, UnsyncedPool
+	}
+
+	// validate the price limit
+	if sqrtPriceLimitX96 == nil {
+		if zeroForOne {
+			sqrtPriceLimitX96 = new(big.Int).Add(MinSqrtRatio, big.NewInt(1))
+		} else {
+			sqrtPriceLimitX96 = new(big.Int).Sub(MaxSqrtRatio, big.NewInt(1))
+		}
+	}
+	if zeroForOne {
+		if sqrtPriceLimitX96.Cmp(s.Slot0.SqrtPriceX96) >= 0 || sqrtPriceLimitX96.Cmp(MinSqrtRatio) <= 0 {
+			return SwapResult{}, InvalidPriceLimit
+		}
+	} else {
+		if sqrtPriceLimitX96.Cmp(s.Slot0.SqrtPriceX96) <= 0 || sqrtPriceLimitX96.Cmp(MaxSqrtRatio) >= 0 {
+			return SwapResult{}, InvalidPriceLimit
+		}
+	}
+
+	exactInput := amountSpecified.Sign() > 0
+	amountRemaining := new(big.Int).Set(amountSpecified)
+	amountCalculated := big.NewInt(0)
+	sqrtPriceX96 := new(big.Int).Set(s.Slot0.SqrtPriceX96)
+	tick := int(s.Slot0.Tick.Int64())
+	liquidity := new(big.Int).Set(s.Liquidity)
+
+	// swap until the amount is filled or the price limit is reached
+	for amountRemaining.Sign() != 0 && sqrtPriceX96.Cmp(sqrtPriceLimitX96) != 0 {
+		sqrtPriceStartX96 := sqrtPriceX96
+
+		// find the next initialized tick within the current bitmap word
+		tickNext, initialized, err := s.nextInitializedTickWithinOneWord(tick, zeroForOne)
+		if err != nil {
+			return SwapResult{}, err
+		}
+		tickNext = max(MinTick, min(MaxTick, tickNext))
+
+		sqrtPriceNextX96, err := GetSqrtRatioAtTick(tickNext)
+		if err != nil {
+			return SwapResult{}, err
+		}
+
+		// swap towards the next tick, bounded by the price limit
+		sqrtPriceTargetX96 := sqrtPriceNextX96
+		if (zeroForOne && sqrtPriceNextX96.Cmp(sqrtPriceLimitX96) < 0) || (!zeroForOne && sqrtPriceNextX96.Cmp(sqrtPriceLimitX96) > 0) {
+			sqrtPriceTargetX96 = sqrtPriceLimitX96
+		}
+		step, err := computeSwapStep(sqrtPriceX96, sqrtPriceTargetX96, liquidity, amountRemaining, uint64(fee))
+		if err != nil {
+			return SwapResult{}, err
+		}
+		sqrtPriceX96 = step.sqrtRatioNextX96
+
+		if exactInput {
+			amountRemaining.Sub(amountRemaining, step.amountIn)
+			amountRemaining.Sub(amountRemaining, step.feeAmount)
+			amountCalculated.Sub(amountCalculated, step.amountOut)
+		} else {
+			amountRemaining.Add(amountRemaining, step.amountOut)
+			amountCalculated.Add(amountCalculated, step.amountIn)
+			amountCalculated.Add(amountCalculated, step.feeAmount)
+		}
+
+		// cross the tick if the price reached it
+		if sqrtPriceX96.Cmp(sqrtPriceNextX96) == 0 {
+			if initialized {
+				liquidityNet := s.tick(tickNext).LiquidityNet
+				if zeroForOne {
+					liquidity.Sub(liquidity, liquidityNet)
+				} else {
+					liquidity.Add(liquidity, liquidityNet)
+				}
+				if liquidity.Sign() < 0 {
+					return SwapResult{}, InsufficientLiquidity
+				}
+			}
+
+			if zeroForOne {
+				tick = tickNext - 1
+			} else {
+				tick = tickNext
+			}
+		} else if sqrtPriceX96.Cmp(sqrtPriceStartX96) != 0 {
+			tick, err = GetTickAtSqrtRatio(sqrtPriceX96)
+			if err != nil {
+				return SwapResult{}, err
+			}
+		}
+	}
+
+	// calculate the pool deltas
+	amountUsed := new(big.Int).Sub(amountSpecified, amountRemaining)
+	res := SwapResult{
+		Amount0:      amountUsed,
+		Amount1:      amountCalculated,
+		SqrtPriceX96: sqrtPriceX96,
+		Tick:         tick,
+		Liquidity:    liquidity,
+	}
+	if zeroForOne != exactInput {
+		res.Amount0, res.Amount1 = amountCalculated, amountUsed
+	}
+
+	return res, nil
+}
+
+// nextInitializedTickWithinOneWord mirrors TickBitmap.nextInitializedTickWithinOneWord
+// returns the next initialized tick or the word boundary if none is initialized
+func (s V3State) nextInitializedTickWithinOneWord(tick int, lte bool) (int, bool, error) {
+	compressed := tick / s.TickSpacing
+	if tick < 0 && tick%s.TickSpacing != 0 {
+		compressed--
+	}
+
+	if lte {
+		wordPos := compressed >> 8
+		if wordPos < s.MinWord || wordPos > s.MaxWord {
+			return 0, false, InsufficientTickData
+		}
+
+		// highest initialized tick at or below the current tick in the word
+		wordStart := (wordPos << 8) * s.TickSpacing
+		i := sort.Search(len(s.Ticks), func(i int) bool {
+			return s.Ticks[i].Index > compressed*s.TickSpacing
+		}) - 1
+		if i >= 0 && s.Ticks[i].Index >= wordStart {
+			return s.Ticks[i].Index, true, nil
+		}
+		return wordStart, false, nil
+	}
+
+	// start from the next compressed tick
+	compressed++
+	wordPos := compressed >> 8
+	if wordPos < s.MinWord || wordPos > s.MaxWord {
+		return 0, false, InsufficientTickData
+	}
+
+	// lowest initialized tick above the current tick in the word
+	wordEnd := ((wordPos << 8) + 255) * s.TickSpacing
+	i := sort.Search(len(s.Ticks), func(i int) bool {
+		return s.Ticks[i].Index >= compressed*s.TickSpacing
+	})
+	if i < len(s.Ticks) && s.Ticks[i].Index <= wordEnd {
+		return s.Ticks[i].Index, true, nil
+	}
+	return wordEnd, false, nil
+}
+
+// tick returns the initialized tick at the given index
+func (s V3State) tick(index int) Tick {
+	i := sort.Search(len(s.Ticks), func(i int) bool {
+		return s.Ticks[i].Index >= index
+	})
+	if i < len(s.Ticks) && s.Ticks[i].Index == index {
+		return s.Ticks[i]
+	}
+	return Tick{Index: index, LiquidityGross: big.NewInt(0), LiquidityNet: big.NewInt(0)}
+}
+
+///
+/// Events
+///
+
+// ApplySwap returns the state after a Swap event
+func (s V3State) ApplySwap(sqrtPriceX96 *big.Int, liquidity *big.Int, tick int) V3State {
+	s.Slot0.SqrtPriceX96 = new(big.Int).Set(sqrtPriceX96)
+	s.Slot0.Tick = big.NewInt(int64(tick))
+	s.Liquidity = new(big.Int).Set(liquidity)
+	return s
+}
+
+// ApplyInitialize returns the state after an Initialize event
+// a pool has no liquidity and no initialized ticks before it is initialized, minWord and maxWord are the words tracked from now on
+func (s V3State) ApplyInitialize(sqrtPriceX96 *big.Int, tick int, minWord int, maxWord int) V3State {
+	s.Slot0.SqrtPriceX96 = new(big.Int).Set(sqrtPriceX96)
+	s.Slot0.Tick = big.NewInt(int64(tick))
+	s.Slot0.Unlocked = true
+	s.Liquidity = big.NewInt(0)
+	s.Ticks = make([]Tick, 0)
+	s.MinWord, s.MaxWord = minWord, maxWord
+	return s
+}
+
+// ModifyPosition returns the state after a Mint (positive delta) or Burn (negative delta) event
+// mirrors UniswapV3Pool._modifyPosition, ticks outside of the synced words are not tracked
+func (s V3State) ModifyPosition(tickLower int, tickUpper int, liquidityDelta *big.Int) V3State {
+	if liquidityDelta.Sign() == 0 {
+		return s
+	}
+
+	// copy the ticks before modifying them
+	ticks := make([]Tick, len(s.Ticks))
+	copy(ticks, s.Ticks)
+	s.Ticks = ticks
+
+	s.updateTick(tickLower, liquidityDelta, false)
+	s.updateTick(tickUpper, liquidityDelta, true)
+
+	// update the active liquidity if the position is in range, unsynced states have no current tick
+	if s.Liquidity != nil && s.Slot0.Tick != nil {
+		if current := int(s.Slot0.Tick.Int64()); tickLower <= current && current < tickUpper {
+			s.Liquidity = new(big.Int).Add(s.Liquidity, liquidityDelta)
+		}
+	}
+
+	return s
+}
+
+// updateTick mirrors Tick.update, the ticks must be copied before the update
+func (s *V3State) updateTick(index int, liquidityDelta *big.Int, upper bool) {
+	if s.TickSpacing <= 0 {
+		return
+	}
+	if word := floorDiv(index, s.TickSpacing) >> 8; word < s.MinWord || word > s.MaxWord {
+		return
+	}
+
+	// the lower tick adds liquidity when crossed left to right, the upper tick removes it
+	netDelta := liquidityDelta
+	if upper {
+		netDelta = new(big.Int).Neg(liquidityDelta)
+	}
+
+	i := sort.Search(len(s.Ticks), func(i int) bool {
+		return s.Ticks[i].Index >= index
+	})
+	if i < len(s.Ticks) && s.Ticks[i].Index == index {
+		t := Tick{
+			Index:          index,
+			LiquidityGross: new(big.Int).Add(s.Ticks[i].LiquidityGross, liquidityDelta),
+			LiquidityNet:   new(big.Int).Add(s.Ticks[i].LiquidityNet, netDelta),
+		}
+
+		// uninitialize the tick if it has no liquidity left
+		if t.LiquidityGross.Sign() <= 0 {
+			s.Ticks = append(s.Ticks[:i], s.Ticks[i+1:]...)
+			return
+		}
+		s.Ticks[i] = t
+		return
+	}
+
+	// initialize the tick
+	if liquidityDelta.Sign() <= 0 {
+		return
+	}
+	s.Ticks = append(s.Ticks, Tick{})
+	copy(s.Ticks[i+1:], s.Ticks[i:])
+	s.Ticks[i] = Tick{
+		Index:          index,
+		LiquidityGross: new(big.Int).Set(liquidityDelta),
+		LiquidityNet:   new(big.Int).Set(netDelta),
+	}
+}
+
+// floorDiv returns a / b rounded towards negative infinity
+func floorDiv(a, b int) int {
+	if a < 0 && a%b != 0 {
+		return a/b - 1
+	}
+	return a / b
+}
@@ -4,7 +4,17 @@ import (
 	"PoolHelper/src/pool/uniswap"
 	"PoolHelper/src/structs/pair"
 	"PoolHelper/src/structs/token"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"math/big"
+	"os"
 	"testing"
 )
 
@@ -31,3 +41,521 @@ func TestVV3AddressCalculation(t *testing.T) {
 		t.Fatalf("expected %v, got %v", expected, p.Address())
 	}
 }
+
+func mustBig(t *testing.T, s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid big int: %s", s)
+	}
+	return v
+}
+
+// TestGetSqrtRatioAtTick tests the tick math bounds.
+func TestGetSqrtRatioAtTick(t *testing.T) {
+	cases := map[int]*big.Int{
+		0:                   uniswap.Q96,
+		uniswap.MinTick:     uniswap.MinSqrtRatio,
+		uniswap.MaxTick:     uniswap.MaxSqrtRatio,
+		uniswap.MinTick + 1: big.NewInt(4295343490),
+	}
+	for tick, expected := range cases {
+		sqrtRatio, err := uniswap.GetSqrtRatioAtTick(tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sqrtRatio.Cmp(expected) != 0 {
+			t.Errorf("tick %d: expected %v, got %v", tick, expected, sqrtRatio)
+		}
+	}
+
+	if _, err := uniswap.GetSqrtRatioAtTick(uniswap.MaxTick + 1); err == nil {
+		t.Errorf("expected invalid tick error")
+	}
+}
+
+// TestGetTickAtSqrtRatio tests the tick math round trip.
+func TestGetTickAtSqrtRatio(t *testing.T) {
+	for _, tick := range []int{uniswap.MinTick, -276324, -50, -1, 0, 1, 50, 201234, uniswap.MaxTick - 1} {
+		sqrtRatio, _ := uniswap.GetSqrtRatioAtTick(tick)
+
+		got, err := uniswap.GetTickAtSqrtRatio(sqrtRatio)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tick {
+			t.Errorf("expected %d, got %d", tick, got)
+		}
+
+		// one below the tick price belongs to the previous tick
+		if tick > uniswap.MinTick {
+			got, _ = uniswap.GetTickAtSqrtRatio(new(big.Int).Sub(sqrtRatio, big.NewInt(1)))
+			if got != tick-1 {
+				t.Errorf("expected %d, got %d", tick-1, got)
+			}
+		}
+	}
+}
+
+// TestV3State_Swap tests single step swaps against the v3-core SwapMath vectors.
+func TestV3State_Swap(t *testing.T) {
+	state := uniswap.V3State{
+		Slot0:       uniswap.Slot0{SqrtPriceX96: uniswap.Q96, Tick: big.NewInt(0)},
+		Liquidity:   mustBig(t, "2000000000000000000"),
+		TickSpacing: 200,
+		Ticks:       []uniswap.Tick{},
+		MinWord:     -1,
+		MaxWord:     0,
+	}
+	amount := mustBig(t, "1000000000000000000")
+
+	// exact input capped at the price limit
+	limit := mustBig(t, "79623317895830914510639640423")
+	res, err := state.Swap(600, false, amount, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Amount1.Cmp(mustBig(t, "9981112891913203")) != 0 {
+		t.Errorf("wrong amount1: %v", res.Amount1)
+	}
+	if res.Amount0.Cmp(mustBig(t, "-9925619580021728")) != 0 {
+		t.Errorf("wrong amount0: %v", res.Amount0)
+	}
+	if res.SqrtPriceX96.Cmp(limit) != 0 {
+		t.Errorf("wrong sqrt price: %v", res.SqrtPriceX96)
+	}
+
+	// exact input fully spent
+	res, err = state.Swap(600, false, amount, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Amount1.Cmp(amount) != 0 {
+		t.Errorf("wrong amount1: %v", res.Amount1)
+	}
+	if res.Amount0.Cmp(mustBig(t, "-666399946655997866")) != 0 {
+		t.Errorf("wrong amount0: %v", res.Amount0)
+	}
+	if res.SqrtPriceX96.Cmp(mustBig(t, "118818475322642227089037862318")) != 0 {
+		t.Errorf("wrong sqrt price: %v", res.SqrtPriceX96)
+	}
+
+	// exact output capped at the price limit
+	res, err = state.Swap(600, false, new(big.Int).Neg(amount), limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Amount1.Cmp(mustBig(t, "9981112891913203")) != 0 {
+		t.Errorf("wrong amount1: %v", res.Amount1)
+	}
+	if res.Amount0.Cmp(mustBig(t, "-9925619580021728")) != 0 {
+		t.Errorf("wrong amount0: %v", res.Amount0)
+	}
+}
+
+// TestV3Pool_Quote tests quoting across an initialized tick.
+func TestV3Pool_Quote(t *testing.T) {
+	token0 := common.HexToAddress("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599")
+	token1 := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	p := uniswap.NewV3Pool(common.Address{}, common.HexToHash(initHashV3), pair.Pair[uniswap.V3FeeType]{
+		TokenA:      token.ERC20{Address: token0},
+		TokenB:      token.ERC20{Address: token1},
+		PairOptions: uniswap.NORMAL,
+	})
+
+	// liquidity drops to a quarter below tick -60
+	liquidity := mustBig(t, "1000000000000000000")
+	p.Update(uniswap.V3State{
+		Slot0:       uniswap.Slot0{SqrtPriceX96: uniswap.Q96, Tick: big.NewInt(0)},
+		Liquidity:   liquidity,
+		TickSpacing: 60,
+		Ticks: []uniswap.Tick{
+			{Index: -120, LiquidityGross: big.NewInt(250), LiquidityNet: mustBig(t, "250000000000000000")},
+			{Index: -60, LiquidityGross: big.NewInt(750), LiquidityNet: mustBig(t, "750000000000000000")},
+		},
+		MinWord: -1,
+		MaxWord: 0,
+	}, 1)
+
+	// crosses tick -60
+	amountIn := mustBig(t, "3500000000000000")
+	amountOut, err := p.AmountOut(token0, amountIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// exact output of the same amount needs at most the same input
+	required, err := p.AmountIn(token1, amountOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if required.Cmp(amountIn) > 0 || new(big.Int).Sub(amountIn, required).Cmp(big.NewInt(10)) > 0 {
+		t.Errorf("expected ~%v, got %v", amountIn, required)
+	}
+
+	// runs out of liquidity below tick -120 and leaves the synced words
+	if _, err := p.AmountOut(token0, mustBig(t, "100000000000000000")); !errors.Is(err, uniswap.InsufficientTickData) {
+		t.Errorf("expected insufficient tick data, got %v", err)
+	}
+}
+
+// TestV3Pool_QuoteUnsynced tests quoting a cached pool that was never synced.
+func TestV3Pool_QuoteUnsynced(t *testing.T) {
+	token0 := common.HexToAddress("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599")
+	token1 := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	p := uniswap.NewV3Pool(common.Address{}, common.HexToHash(initHashV3), pair.Pair[uniswap.V3FeeType]{
+		TokenA:      token.ERC20{Address: token0},
+		TokenB:      token.ERC20{Address: token1},
+		PairOptions: uniswap.NORMAL,
+	})
+	if _, err := p.AmountOut(token0, big.NewInt(1000)); !errors.Is(err, uniswap.UnsyncedPool) {
+		t.Errorf("expected an unsynced pool, got %v", err)
+	}
+
+	// a state without a tick is not synced either
+	p.Update(uniswap.V3State{Slot0: uniswap.Slot0{SqrtPriceX96: uniswap.Q96}, Liquidity: big.NewInt(1), TickSpacing: 60}, 1)
+	if _, err := p.AmountIn(token1, big.NewInt(1000)); !errors.Is(err, uniswap.UnsyncedPool) {
+		t.Errorf("expected an unsynced pool, got %v", err)
+	}
+}
+
+var (
+	record      = flag.String("record", "", "capture the slot0 fixtures from this RPC endpoint instead of reading them")
+	recordBlock = flag.Uint64("record-block", 0, "block to capture the slot0 fixtures at, 0 is the latest block")
+)
+
+// slot0Fixture is a slot0 return data fixture
+// Block is the block the return data was captured at, 0 if it was not captured from a node
+type slot0Fixture struct {
+	Name                       string `json:"name"`
+	Pool                       string `json:"pool"`
+	Block                      uint64 `json:"block,omitempty"`
+	Decimals0                  int64  `json:"decimals0"`
+	Decimals1                  int64  `json:"decimals1"`
+	ReturnData                 string `json:"returnData"`
+	SqrtPriceX96               string `json:"sqrtPriceX96"`
+	Tick                       int64  `json:"tick"`
+	ObservationIndex           uint64 `json:"observationIndex"`
+	ObservationCardinality     uint64 `json:"observationCardinality"`
+	ObservationCardinalityNext uint64 `json:"observationCardinalityNext"`
+	FeeProtocol                uint64 `json:"feeProtocol"`
+	Unlocked                   bool   `json:"unlocked"`
+	Price                      string `json:"price"`
+}
+
+func loadSlot0Fixtures(t *testing.T, path string) []slot0Fixture {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fixtures []slot0Fixture
+	if err := json.Unmarshal(raw, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	return fixtures
+}
+
+// capturedSlot0Fixtures returns the golden fixtures captured from mainnet, capturing them first with -record
+// pools without return data are not captured yet, the test is skipped if no pool is captured
+func capturedSlot0Fixtures(t *testing.T) []slot0Fixture {
+	fixtures := loadSlot0Fixtures(t, "testdata/slot0.json")
+	if *record != "" {
+		fixtures = captureSlot0Fixtures(t, fixtures)
+	}
+
+	captured := make([]slot0Fixture, 0, len(fixtures))
+	for _, f := range fixtures {
+		if f.ReturnData == "" {
+			continue
+		}
+		if f.Pool == "" || f.Block == 0 {
+			t.Fatalf("%s: return data without the pool and block it was captured at", f.Name)
+		}
+		captured = append(captured, f)
+	}
+	if len(captured) == 0 {
+		t.Skip("testdata/slot0.json has no captured pools, capture them with -record")
+	}
+	return captured
+}
+
+// captureSlot0Fixtures calls slot0() of the fixture pools at a pinned block and saves the return data
+// the expected values are decoded word by word, independently of DecodeSlot0
+func captureSlot0Fixtures(t *testing.T, fixtures []slot0Fixture) []slot0Fixture {
+	client, err := ethclient.Dial(*record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	block := *recordBlock
+	if block == 0 {
+		header, err := client.HeaderByNumber(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = header.Number.Uint64()
+	}
+
+	for i, f := range fixtures {
+		pool := common.HexToAddress(f.Pool)
+		data, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &pool, Data: crypto.Keccak256([]byte("slot0()"))[:4]}, new(big.Int).SetUint64(block))
+		if err != nil || len(data) != 7*32 {
+			t.Fatalf("%s: slot0() failed: %v", f.Name, err)
+		}
+		word := func(i int) *big.Int { return new(big.Int).SetBytes(data[i*32 : (i+1)*32]) }
+
+		// int24 tick, sign extended from its lowest 3 bytes
+		tick := word(1).Int64() & 0xffffff
+		if tick >= 1<<23 {
+			tick -= 1 << 24
+		}
+
+		// price of token0 in token1 = sqrtPriceX96^2 / 2^192 * 10^(decimals0 - decimals1)
+		sqrtPrice := word(0)
+		price := new(big.Rat).SetFrac(new(big.Int).Mul(sqrtPrice, sqrtPrice), new(big.Int).Lsh(big.NewInt(1), 192))
+		scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(abs(f.Decimals0-f.Decimals1)), nil))
+		if f.Decimals0 >= f.Decimals1 {
+			price.Mul(price, scale)
+		} else {
+			price.Quo(price, scale)
+		}
+
+		fixtures[i] = slot0Fixture{
+			Name:                       f.Name,
+			Pool:                       f.Pool,
+			Block:                      block,
+			Decimals0:                  f.Decimals0,
+			Decimals1:                  f.Decimals1,
+			ReturnData:                 hexutil.Encode(data),
+			SqrtPriceX96:               sqrtPrice.String(),
+			Tick:                       tick,
+			ObservationIndex:           word(2).Uint64(),
+			ObservationCardinality:     word(3).Uint64(),
+			ObservationCardinalityNext: word(4).Uint64(),
+			FeeProtocol:                word(5).Uint64(),
+			Unlocked:                   word(6).Sign() != 0,
+			Price:                      price.FloatString(30),
+		}
+	}
+
+	raw, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("testdata/slot0.json", append(raw, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fixtures
+}
+
+// abs returns the absolute value of a
+func abs(a int64) int64 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// TestDecodeSlot0 tests the slot0 decoding against the golden fixtures.
+func TestDecodeSlot0(t *testing.T) {
+	checkDecodeSlot0(t, capturedSlot0Fixtures(t))
+}
+
+// TestDecodeSlot0_Synthetic tests the slot0 decoding against hand assembled return data.
+func TestDecodeSlot0_Synthetic(t *testing.T) {
+	checkDecodeSlot0(t, loadSlot0Fixtures(t, "testdata/slot0_synthetic.json"))
+
+	if _, err := uniswap.DecodeSlot0(make([]byte, 64)); err == nil {
+		t.Errorf("expected error for short return data")
+	}
+}
+
+// checkDecodeSlot0 checks the decoded slot0 of the fixtures
+func checkDecodeSlot0(t *testing.T, fixtures []slot0Fixture) {
+	for _, f := range fixtures {
+		slot, err := uniswap.DecodeSlot0(common.FromHex(f.ReturnData))
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+
+		if slot.SqrtPriceX96.String() != f.SqrtPriceX96 {
+			t.Errorf("%s: expected sqrt price %s, got %v", f.Name, f.SqrtPriceX96, slot.SqrtPriceX96)
+		}
+		if slot.Tick.Int64() != f.Tick {
+			t.Errorf("%s: expected tick %d, got %v", f.Name, f.Tick, slot.Tick)
+		}
+		if slot.ObservationIndex.Uint64() != f.ObservationIndex ||
+			slot.ObservationCardinality.Uint64() != f.ObservationCardinality ||
+			slot.ObservationCardinalityNext.Uint64() != f.ObservationCardinalityNext {
+			t.Errorf("%s: wrong observations %v %v %v", f.Name, slot.ObservationIndex, slot.ObservationCardinality, slot.ObservationCardinalityNext)
+		}
+		if slot.FeeProtocol.Uint64() != f.FeeProtocol {
+			t.Errorf("%s: expected fee protocol %d, got %v", f.Name, f.FeeProtocol, slot.FeeProtocol)
+		}
+		if slot.Unlocked != f.Unlocked {
+			t.Errorf("%s: expected unlocked %v, got %v", f.Name, f.Unlocked, slot.Unlocked)
+		}
+	}
+}
+
+// TestDecodeSlot0_Bounds tests the decoding of the largest field values, the return data is synthetic
+func TestDecodeSlot0_Bounds(t *testing.T) {
+	words := [][]byte{
+		common.LeftPadBytes(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1)).Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(uniswap.MaxTick).Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(65534).Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(65535).Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(65535).Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(255).Bytes(), 32),
+		make([]byte, 32),
+	}
+	data := make([]byte, 0, 7*32)
+	for _, w := range words {
+		data = append(data, w...)
+	}
+
+	slot, err := uniswap.DecodeSlot0(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.SqrtPriceX96.BitLen() != 160 || slot.Tick.Int64() != uniswap.MaxTick || slot.ObservationIndex.Uint64() != 65534 ||
+		slot.ObservationCardinality.Uint64() != 65535 || slot.ObservationCardinalityNext.Uint64() != 65535 || slot.FeeProtocol.Uint64() != 255 || slot.Unlocked {
+		t.Errorf("wrong bounds: %+v", slot)
+	}
+}
+
+// TestSlot0Prices tests the price conversions against the golden fixtures.
+func TestSlot0Prices(t *testing.T) {
+	checkSlot0Prices(t, capturedSlot0Fixtures(t))
+}
+
+// TestSlot0Prices_Synthetic tests the price conversions against hand assembled return data.
+func TestSlot0Prices_Synthetic(t *testing.T) {
+	checkSlot0Prices(t, loadSlot0Fixtures(t, "testdata/slot0_synthetic.json"))
+}
+
+// checkSlot0Prices checks the price conversions of the fixtures
+func checkSlot0Prices(t *testing.T, fixtures []slot0Fixture) {
+	for _, f := range fixtures {
+		slot, _ := uniswap.DecodeSlot0(common.FromHex(f.ReturnData))
+		decimals0, decimals1 := big.NewInt(f.Decimals0), big.NewInt(f.Decimals1)
+		expected, _ := new(big.Rat).SetString(f.Price)
+
+		// tick of the sqrt price
+		tick, err := uniswap.GetTickAtSqrtRatio(slot.SqrtPriceX96)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(tick) != f.Tick {
+			t.Errorf("%s: expected tick %d, got %d", f.Name, f.Tick, tick)
+		}
+
+		// sqrt price to price within rounding
+		price := uniswap.SqrtPriceX96ToPrice(slot.SqrtPriceX96, decimals0, decimals1)
+		diff := new(big.Rat).Quo(new(big.Rat).Sub(price, expected), expected)
+		if diff.Abs(diff).Cmp(big.NewRat(1, 1e12)) > 0 {
+			t.Errorf("%s: expected price %s, got %s", f.Name, f.Price, price.FloatString(18))
+		}
+
+		// price to sqrt price round trip, the fixture price is rounded
+		sqrtPriceX96, err := uniswap.PriceToSqrtPriceX96(expected, decimals0, decimals1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqrtDiff := new(big.Rat).SetFrac(new(big.Int).Sub(sqrtPriceX96, slot.SqrtPriceX96), slot.SqrtPriceX96)
+		if sqrtDiff.Abs(sqrtDiff).Cmp(big.NewRat(1, 1e12)) > 0 {
+			t.Errorf("%s: expected sqrt price %s, got %v", f.Name, f.SqrtPriceX96, sqrtPriceX96)
+		}
+
+		// price to tick and back
+		priceTick, err := uniswap.PriceToTick(expected, decimals0, decimals1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(priceTick) != f.Tick {
+			t.Errorf("%s: expected tick %d, got %d", f.Name, f.Tick, priceTick)
+		}
+		tickPrice, _ := uniswap.TickToPrice(priceTick, decimals0, decimals1)
+		nextPrice, _ := uniswap.TickToPrice(priceTick+1, decimals0, decimals1)
+		if tickPrice.Cmp(expected) > 0 || nextPrice.Cmp(expected) <= 0 {
+			t.Errorf("%s: price %s not within tick %d", f.Name, f.Price, priceTick)
+		}
+	}
+}
+
+// TestV3Pool_Price tests the decimal adjusted spot price of a UniswapV3 pool.
+func TestV3Pool_Price(t *testing.T) {
+	f := loadSlot0Fixtures(t, "testdata/slot0_synthetic.json")[0]
+	slot, _ := uniswap.DecodeSlot0(common.FromHex(f.ReturnData))
+
+	// DAI/USDC with the pair tokens reversed
+	dai := token.ERC20{Address: common.HexToAddress("0x6b175474e89094c44da98b954eedeac495271d0f"), Decimals: big.NewInt(f.Decimals0)}
+	usdc := token.ERC20{Address: common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"), Decimals: big.NewInt(f.Decimals1)}
+	p := uniswap.NewV3Pool(common.Address{}, common.HexToHash(initHashV3), pair.Pair[uniswap.V3FeeType]{
+		TokenA:      usdc,
+		TokenB:      dai,
+		PairOptions: uniswap.MIN,
+	})
+	if _, err := p.Price(); !errors.Is(err, uniswap.InsufficientLiquidity) {
+		t.Errorf("expected insufficient liquidity, got %v", err)
+	}
+	p.Update(uniswap.V3State{Slot0: slot}, 1)
+
+	price, err := p.Price()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bInA := price.BInAFloat(); bInA < 0.99989 || bInA > 0.99991 {
+		t.Errorf("expected 1 DAI = 0.9999 USDC, got %v", bInA)
+	}
+	if aInB := price.AInBFloat(); aInB < 1.00009 || aInB > 1.00011 {
+		t.Errorf("expected 1 USDC = 1.0001 DAI, got %v", aInB)
+	}
+}
+
+// TestV3State_ModifyPosition tests applying Mint and Burn events to the ticks.
+func TestV3State_ModifyPosition(t *testing.T) {
+	state := uniswap.V3State{
+		Slot0:       uniswap.Slot0{SqrtPriceX96: uniswap.Q96, Tick: big.NewInt(0)},
+		Liquidity:   big.NewInt(1_000),
+		TickSpacing: 60,
+		Ticks: []uniswap.Tick{
+			{Index: -120, LiquidityGross: big.NewInt(1_000), LiquidityNet: big.NewInt(1_000)},
+			{Index: 120, LiquidityGross: big.NewInt(1_000), LiquidityNet: big.NewInt(-1_000)},
+		},
+		MinWord: -1,
+		MaxWord: 0,
+	}
+
+	// mint in range, the upper tick is shared
+	minted := state.ModifyPosition(-60, 120, big.NewInt(500))
+	if minted.Liquidity.Int64() != 1_500 {
+		t.Errorf("expected liquidity 1500, got %v", minted.Liquidity)
+	}
+	if len(minted.Ticks) != 3 || minted.Ticks[1].Index != -60 || minted.Ticks[1].LiquidityNet.Int64() != 500 {
+		t.Fatalf("expected tick -60 to be initialized, got %v", minted.Ticks)
+	}
+	if minted.Ticks[2].LiquidityGross.Int64() != 1_500 || minted.Ticks[2].LiquidityNet.Int64() != -1_500 {
+		t.Errorf("wrong upper tick %v", minted.Ticks[2])
+	}
+	if len(state.Ticks) != 2 || state.Ticks[1].LiquidityGross.Int64() != 1_000 {
+		t.Errorf("original state was modified")
+	}
+
+	// mint out of range and outside of the synced words
+	minted = minted.ModifyPosition(60, 1_000_000/60*60, big.NewInt(100))
+	if minted.Liquidity.Int64() != 1_500 || len(minted.Ticks) != 4 {
+		t.Errorf("expected only tick 60 to be initialized, got %v", minted.Ticks)
+	}
+
+	// burn everything back
+	burned := minted.ModifyPosition(60, 1_000_000/60*60, big.NewInt(-100))
+	burned = burned.ModifyPosition(-60, 120, big.NewInt(-500))
+	if burned.Liquidity.Int64() != 1_000 || len(burned.Ticks) != 2 {
+		t.Errorf("expected the original state, got %v %v", burned.Liquidity, burned.Ticks)
+	}
+	if !burned.Equal(state) || minted.Equal(state) {
+		t.Errorf("wrong state equality")
+	}
+}
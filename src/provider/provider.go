@@ -0,0 +1,459 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	NoEndpoints     = errors.New("no rpc endpoints")
+	NoSubscriptions = errors.New("no rpc endpoint supports subscriptions")
+)
+
+// Strategy is the load balancing strategy of a dispatcher
+type Strategy string
+
+const (
+	// RoundRobin sends the requests to the healthy endpoints in turn
+	RoundRobin Strategy = "roundRobin"
+	// Weighted sends each healthy endpoint a share of the requests proportional to its weight
+	Weighted Strategy = "weighted"
+)
+
+// DefaultMaxFailures is the default number of consecutive failures after which an endpoint is unhealthy
+const DefaultMaxFailures = 3
+
+// DefaultCooldown is the default time an unhealthy endpoint is skipped
+const DefaultCooldown = 30 * time.Second
+
+// Client is the RPC API of an endpoint, implemented by ethclient.Client
+type Client interface {
+	CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error)
+	EstimateGas(context.Context, ethereum.CallMsg) (uint64, error)
+	HeaderByNumber(context.Context, *big.Int) (*types.Header, error)
+	HeaderByHash(context.Context, common.Hash) (*types.Header, error)
+	FilterLogs(context.Context, ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Subscriber subscribes to the notifications of an endpoint, implemented by rpc.Client
+type Subscriber interface {
+	EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error)
+}
+
+// Endpoint is an RPC endpoint of a dispatcher
+type Endpoint struct {
+	URL    string
+	Client Client
+	// Subscriber is nil if the endpoint does not support subscriptions, e.g. over HTTP
+	Subscriber Subscriber
+	// Weight is the share of the requests of the endpoint with the weighted strategy
+	Weight int
+	// RateLimit is the maximum number of requests per second, 0 does not limit the endpoint
+	RateLimit float64
+}
+
+// Status is the health of an endpoint
+type Status struct {
+	URL      string `json:"url"`
+	Healthy  bool   `json:"healthy"`
+	Failures int    `json:"failures"`
+}
+
+// endpoint is an endpoint with its balancing and health state
+type endpoint struct {
+	Endpoint
+	limiter *limiter
+
+	// current is the smooth weighted round-robin counter
+	current int
+	// failures is the number of consecutive failures, the endpoint is skipped until downUntil
+	failures  int
+	downUntil time.Time
+}
+
+///
+/// Dispatcher
+///
+
+// Dispatcher spreads requests over several RPC endpoints
+// failed endpoints are skipped for a cooldown and their requests fail over to the next endpoint,
+// with hedging a request is also sent to the next endpoint if no answer arrived within the hedge delay
+type Dispatcher struct {
+	m           sync.Mutex
+	endpoints   []*endpoint
+	strategy    Strategy
+	hedge       time.Duration
+	maxFailures int
+	cooldown    time.Duration
+}
+
+// NewDispatcher creates a round-robin dispatcher without hedging
+func NewDispatcher(endpoints []Endpoint) *Dispatcher {
+	d := &Dispatcher{
+		endpoints:   make([]*endpoint, 0, len(endpoints)),
+		strategy:    RoundRobin,
+		maxFailures: DefaultMaxFailures,
+		cooldown:    DefaultCooldown,
+	}
+	for _, e := range endpoints {
+		d.endpoints = append(d.endpoints, &endpoint{
+			Endpoint: e,
+			limiter:  newLimiter(e.RateLimit),
+		})
+	}
+	return d
+}
+
+// SetStrategy sets the load balancing strategy
+func (d *Dispatcher) SetStrategy(strategy Strategy) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.strategy = strategy
+}
+
+// SetHedge sets the delay after which a request is also sent to the next endpoint, 0 disables hedging
+func (d *Dispatcher) SetHedge(hedge time.Duration) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.hedge = max(hedge, 0)
+}
+
+// SetHealth sets the number of consecutive failures after which an endpoint is skipped and for how long
+func (d *Dispatcher) SetHealth(maxFailures int, cooldown time.Duration) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.maxFailures = max(maxFailures, 1)
+	d.cooldown = max(cooldown, 0)
+}
+
+// Status returns the health of the endpoints
+func (d *Dispatcher) Status() []Status {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	now := time.Now()
+	status := make([]Status, 0, len(d.endpoints))
+	for _, e := range d.endpoints {
+		status = append(status, Status{
+			URL:      e.URL,
+			Healthy:  !now.Before(e.downUntil),
+			Failures: e.failures,
+		})
+	}
+	return status
+}
+
+///
+/// Client
+///
+
+func (d *Dispatcher) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	return call(ctx, d, func(ctx context.Context, c Client) ([]byte, error) {
+		return c.CallContract(ctx, msg, block)
+	})
+}
+
+func (d *Dispatcher) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return call(ctx, d, func(ctx context.Context, c Client) (uint64, error) {
+		return c.EstimateGas(ctx, msg)
+	})
+}
+
+func (d *Dispatcher) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return call(ctx, d, func(ctx context.Context, c Client) (*types.Header, error) {
+		return c.HeaderByNumber(ctx, number)
+	})
+}
+
+func (d *Dispatcher) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return call(ctx, d, func(ctx context.Context, c Client) (*types.Header, error) {
+		return c.HeaderByHash(ctx, hash)
+	})
+}
+
+func (d *Dispatcher) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return call(ctx, d, func(ctx context.Context, c Client) ([]types.Log, error) {
+		return c.FilterLogs(ctx, q)
+	})
+}
+
+// EthSubscribe subscribes on the first healthy endpoint supporting subscriptions, failing over to the next ones
+// re-subscriptions after a dropped subscription move on to another endpoint if the endpoint failed
+func (d *Dispatcher) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	err := NoSubscriptions
+	for _, e := range d.order() {
+		if e.Subscriber == nil {
+			continue
+		}
+		if err := e.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		sub, subErr := e.Subscriber.EthSubscribe(ctx, channel, args...)
+		if subErr == nil {
+			d.succeeded(e)
+			return sub, nil
+		}
+		if ctx.Err() != nil {
+			return nil, subErr
+		}
+		if !errors.Is(subErr, rpc.ErrNotificationsUnsupported) {
+			d.failed(e)
+		}
+		err = subErr
+	}
+	return nil, err
+}
+
+///
+/// Dispatch
+///
+
+// call sends a request to the endpoints in load balancing order until one answers
+// JSON-RPC errors are answers of the endpoint and are returned without failing over
+func call[T any](ctx context.Context, d *Dispatcher, request func(context.Context, Client) (T, error)) (T, error) {
+	var zero T
+	candidates := d.order()
+	if len(candidates) == 0 {
+		return zero, NoEndpoints
+	}
+	d.m.Lock()
+	hedge := d.hedge
+	d.m.Unlock()
+
+	// the losing hedged requests are cancelled
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type answer struct {
+		res T
+		err error
+		e   *endpoint
+	}
+	answers := make(chan answer, len(candidates))
+	next, pending := 0, 0
+	send := func() {
+		e := candidates[next]
+		next++
+		pending++
+		go func() {
+			if err := e.limiter.wait(reqCtx); err != nil {
+				answers <- answer{err: err, e: e}
+				return
+			}
+			res, err := request(reqCtx, e.Client)
+			answers <- answer{res: res, err: err, e: e}
+		}()
+	}
+
+	send()
+	var lastErr error
+	for pending > 0 {
+		var hedgeTimer <-chan time.Time
+		if hedge > 0 && next < len(candidates) {
+			hedgeTimer = time.After(hedge)
+		}
+
+		select {
+		case a := <-answers:
+			pending--
+			if a.err == nil || isAnswer(a.err) {
+				d.succeeded(a.e)
+				return a.res, a.err
+			}
+			if ctx.Err() != nil {
+				return zero, ctx.Err()
+			}
+
+			// fail over to the next endpoint
+			d.failed(a.e)
+			lastErr = a.err
+			if pending == 0 && next < len(candidates) {
+				send()
+			}
+		case <-hedgeTimer:
+			send()
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+	return zero, lastErr
+}
+
+// JSON-RPC error codes answered the same by every endpoint
+const (
+	revertCode        = 3
+	invalidParamsCode = -32602
+)
+
+// isAnswer returns true if the error was answered by the endpoint, another endpoint would answer the same
+// only reverts, invalid parameters and missing results are answers, other JSON-RPC errors (rate limits, internal errors) fail over
+func isAnswer(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return true
+	}
+
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.ErrorCode() {
+	case revertCode, invalidParamsCode:
+		return true
+	}
+
+	// some nodes answer reverts without data with the generic server error code
+	return strings.Contains(rpcErr.Error(), "execution reverted")
+}
+
+// order returns the endpoints in the order requests are sent to them
+// the endpoint picked by the strategy comes first, followed by the other healthy endpoints
+// with free rate limit, the rate limited ones and the unhealthy ones, which failed most recently last
+func (d *Dispatcher) order() []*endpoint {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	now := time.Now()
+	healthy, unhealthy := make([]*endpoint, 0, len(d.endpoints)), make([]*endpoint, 0)
+	for _, e := range d.endpoints {
+		if now.Before(e.downUntil) {
+			unhealthy = append(unhealthy, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+
+	// pick the first endpoint with smooth weighted round-robin
+	ordered := make([]*endpoint, 0, len(d.endpoints))
+	if len(healthy) > 0 {
+		total, best := 0, 0
+		for i, e := range healthy {
+			weight := 1
+			if d.strategy == Weighted {
+				weight = max(e.Weight, 1)
+			}
+			e.current += weight
+			total += weight
+			if e.current > healthy[best].current {
+				best = i
+			}
+		}
+		healthy[best].current -= total
+		ordered = append(ordered, healthy[best])
+
+		// the others in turn after the picked one, rate limited ones last
+		limited := make([]*endpoint, 0)
+		for i := 1; i < len(healthy); i++ {
+			e := healthy[(best+i)%len(healthy)]
+			if e.limiter.available() {
+				ordered = append(ordered, e)
+			} else {
+				limited = append(limited, e)
+			}
+		}
+		ordered = append(ordered, limited...)
+	}
+
+	for i := 1; i < len(unhealthy); i++ {
+		for j := i; j > 0 && unhealthy[j].downUntil.Before(unhealthy[j-1].downUntil); j-- {
+			unhealthy[j], unhealthy[j-1] = unhealthy[j-1], unhealthy[j]
+		}
+	}
+	return append(ordered, unhealthy...)
+}
+
+// succeeded resets the failures of an endpoint
+func (d *Dispatcher) succeeded(e *endpoint) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	e.failures = 0
+	e.downUntil = time.Time{}
+}
+
+// failed counts a failure of an endpoint, the endpoint is skipped for the cooldown after too many failures
+func (d *Dispatcher) failed(e *endpoint) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	e.failures++
+	if e.failures >= d.maxFailures {
+		e.downUntil = time.Now().Add(d.cooldown)
+	}
+}
+
+///
+/// Rate Limit
+///
+
+// limiter is a token bucket allowing rate requests per second with bursts of up to rate requests
+// a nil limiter does not limit
+type limiter struct {
+	m      sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter creates a limiter, a rate of 0 does not limit
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate, tokens: max(rate, 1), last: time.Now()}
+}
+
+// refill adds the tokens since the last refill, the lock must be held
+func (l *limiter) refill() {
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, max(l.rate, 1))
+	l.last = now
+}
+
+// available returns true if a request can be sent without waiting
+func (l *limiter) available() bool {
+	if l == nil {
+		return true
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.refill()
+	return l.tokens >= 1
+}
+
+// wait takes a token, waiting until one is available
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		l.m.Lock()
+		l.refill()
+		if l.tokens >= 1 {
+			l.tokens--
+			l.m.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.m.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
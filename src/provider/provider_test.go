@@ -0,0 +1,206 @@
+package provider_test
+
+import (
+	"PoolHelper/src/provider"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rpcError is a JSON-RPC error answered by an endpoint
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (e rpcError) Error() string  { return e.message }
+func (e rpcError) ErrorCode() int { return e.code }
+
+// revertError is the JSON-RPC error of a reverted call
+var revertError = rpcError{code: 3, message: "execution reverted"}
+
+// fakeClient answers with its name after a delay, or fails
+type fakeClient struct {
+	name     byte
+	delay    time.Duration
+	err      error
+	requests atomic.Int32
+}
+
+func (c *fakeClient) CallContract(ctx context.Context, _ ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	c.requests.Add(1)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(c.delay):
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return []byte{c.name}, nil
+}
+
+func (c *fakeClient) EstimateGas(context.Context, ethereum.CallMsg) (uint64, error) {
+	return 0, c.err
+}
+
+func (c *fakeClient) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return nil, c.err
+}
+
+func (c *fakeClient) HeaderByHash(context.Context, common.Hash) (*types.Header, error) {
+	return nil, c.err
+}
+
+func (c *fakeClient) FilterLogs(context.Context, ethereum.FilterQuery) ([]types.Log, error) {
+	return nil, c.err
+}
+
+// newDispatcher creates a dispatcher over the clients
+func newDispatcher(clients ...*fakeClient) *provider.Dispatcher {
+	endpoints := make([]provider.Endpoint, len(clients))
+	for i, c := range clients {
+		endpoints[i] = provider.Endpoint{URL: string('a' + rune(i)), Client: c, Weight: int(c.name)}
+	}
+	return provider.NewDispatcher(endpoints)
+}
+
+// answers counts the answering endpoint of n requests
+func answers(t *testing.T, d *provider.Dispatcher, n int) map[byte]int {
+	counts := make(map[byte]int)
+	for i := 0; i < n; i++ {
+		res, err := d.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[res[0]]++
+	}
+	return counts
+}
+
+func TestDispatcher_Balancing(t *testing.T) {
+	a, b := &fakeClient{name: 1}, &fakeClient{name: 3}
+	d := newDispatcher(a, b)
+
+	if counts := answers(t, d, 8); counts[1] != 4 || counts[3] != 4 {
+		t.Errorf("wrong round-robin answers: %v", counts)
+	}
+
+	// the weights are the names
+	d.SetStrategy(provider.Weighted)
+	if counts := answers(t, d, 8); counts[1] != 2 || counts[3] != 6 {
+		t.Errorf("wrong weighted answers: %v", counts)
+	}
+}
+
+func TestDispatcher_Failover(t *testing.T) {
+	a, b := &fakeClient{name: 1, err: errors.New("connection refused")}, &fakeClient{name: 2}
+	d := newDispatcher(a, b)
+	d.SetHealth(2, time.Hour)
+
+	// requests to the failing endpoint fail over until it is skipped
+	if counts := answers(t, d, 6); counts[2] != 6 {
+		t.Errorf("wrong answers: %v", counts)
+	}
+	if n := a.requests.Load(); n != 2 {
+		t.Errorf("wrong number of requests to the failing endpoint: %v", n)
+	}
+	if status := d.Status(); status[0].Healthy || status[0].Failures != 2 || !status[1].Healthy {
+		t.Errorf("wrong status: %+v", status)
+	}
+
+	// reverts are answers and do not fail over
+	b.err = revertError
+	var rpcErr rpc.Error
+	if _, err := d.CallContract(context.Background(), ethereum.CallMsg{}, nil); !errors.As(err, &rpcErr) {
+		t.Errorf("expected a revert, got %v", err)
+	}
+	if b.requests.Load() != 7 || a.requests.Load() != 2 {
+		t.Errorf("wrong requests: %v %v", a.requests.Load(), b.requests.Load())
+	}
+
+	// unhealthy endpoints are still tried if every endpoint fails
+	b.err = errors.New("connection refused")
+	if _, err := d.CallContract(context.Background(), ethereum.CallMsg{}, nil); err == nil {
+		t.Errorf("expected an error")
+	}
+	if a.requests.Load() != 3 {
+		t.Errorf("expected a request to the unhealthy endpoint")
+	}
+}
+
+func TestDispatcher_RPCErrors(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		answer bool
+	}{
+		{revertError, true},
+		{rpcError{code: -32000, message: "execution reverted"}, true},
+		{rpcError{code: -32602, message: "invalid argument 0: hex string without 0x prefix"}, true},
+		{ethereum.NotFound, true},
+		{rpcError{code: -32005, message: "limit exceeded"}, false},
+		{rpcError{code: -32603, message: "internal error"}, false},
+		{rpcError{code: -32000, message: "header not found"}, false},
+		{rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, false},
+	} {
+		// the failing endpoint has the higher weight and is tried first
+		a, b := &fakeClient{name: 3, err: test.err}, &fakeClient{name: 1}
+		d := newDispatcher(a, b)
+
+		res, err := d.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+		if test.answer && (!errors.Is(err, test.err) || b.requests.Load() != 0) {
+			t.Errorf("%v: expected the answer, got %v %v", test.err, res, err)
+		}
+		if !test.answer && (err != nil || len(res) != 1 || res[0] != 1) {
+			t.Errorf("%v: expected a fail over, got %v %v", test.err, res, err)
+		}
+	}
+}
+
+func TestDispatcher_Hedge(t *testing.T) {
+	slow, fast := &fakeClient{name: 1, delay: time.Second}, &fakeClient{name: 2}
+	d := newDispatcher(slow, fast)
+	d.SetHedge(10 * time.Millisecond)
+
+	// the first request goes to the slow endpoint and is hedged to the fast one
+	start := time.Now()
+	res, err := d.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0] != 2 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected the fast answer, got %v after %v", res[0], time.Since(start))
+	}
+}
+
+func TestDispatcher_RateLimit(t *testing.T) {
+	c := &fakeClient{name: 1}
+	d := provider.NewDispatcher([]provider.Endpoint{{URL: "a", Client: c, RateLimit: 20}})
+
+	// a burst of 20 requests, then 20 per second
+	start := time.Now()
+	answers(t, d, 25)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("requests not rate limited: %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.CallContract(ctx, ethereum.CallMsg{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled request, got %v", err)
+	}
+}
+
+func TestDispatcher_EthSubscribe(t *testing.T) {
+	d := newDispatcher(&fakeClient{name: 1})
+	if _, err := d.EthSubscribe(context.Background(), make(chan *types.Header), "newHeads"); !errors.Is(err, provider.NoSubscriptions) {
+		t.Errorf("expected no subscriptions, got %v", err)
+	}
+}
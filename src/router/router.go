@@ -0,0 +1,229 @@
+package router
+
+import (
+	"PoolHelper/src/pool"
+	"PoolHelper/src/structs/token"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+var (
+	NoRoute       = errors.New("no route found")
+	InvalidAmount = errors.New("invalid amount")
+	InvalidHops   = errors.New("invalid max hops")
+)
+
+// Edge is a directed swap through a pool
+type Edge struct {
+	Pool     common.Address
+	Factory  common.Address
+	TokenIn  token.ERC20
+	TokenOut token.ERC20
+
+	quoter    pool.Quoter
+	lastBlock func() uint64
+}
+
+// AmountOut quotes the edge with the last synced pool state
+func (e Edge) AmountOut(amountIn *big.Int) (*big.Int, error) {
+	return e.quoter.AmountOut(e.TokenIn.Address, amountIn)
+}
+
+// LastBlock returns the block of the last synced pool state
+func (e Edge) LastBlock() uint64 {
+	return e.lastBlock()
+}
+
+// Hop is a quoted edge of a route
+type Hop struct {
+	Edge
+	AmountIn  *big.Int
+	AmountOut *big.Int
+}
+
+// Route is a quoted path from one token to another
+type Route struct {
+	Hops      []Hop
+	AmountIn  *big.Int
+	AmountOut *big.Int
+
+	// Block is the oldest synced block of the route pools
+	Block uint64
+}
+
+// Tokens returns the tokens along the route
+func (r Route) Tokens() []token.ERC20 {
+	tokens := make([]token.ERC20, 0, len(r.Hops)+1)
+	for i, h := range r.Hops {
+		if i == 0 {
+			tokens = append(tokens, h.TokenIn)
+		}
+		tokens = append(tokens, h.TokenOut)
+	}
+	return tokens
+}
+
+// Router finds the best routes through a graph of pools
+type Router struct {
+	edges map[common.Address][]Edge
+	m     sync.RWMutex
+}
+
+func NewRouter() *Router {
+	return &Router{
+		edges: make(map[common.Address][]Edge),
+		m:     sync.RWMutex{},
+	}
+}
+
+// AddPools adds both swap directions of the pools to the router graph
+func AddPools[ReserveType any, PairOption any](r *Router, pools []pool.Pool[ReserveType, PairOption]) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, p := range pools {
+		p := p
+		poolPair := p.Pair()
+		lastBlock := func() uint64 {
+			_, block, _ := p.State()
+			return block
+		}
+
+		for _, tokens := range [][2]token.ERC20{
+			{poolPair.TokenA, poolPair.TokenB},
+			{poolPair.TokenB, poolPair.TokenA},
+		} {
+			r.edges[tokens[0].Address] = append(r.edges[tokens[0].Address], Edge{
+				Pool:      p.Address(),
+				Factory:   p.Factory(),
+				TokenIn:   tokens[0],
+				TokenOut:  tokens[1],
+				quoter:    p,
+				lastBlock: lastBlock,
+			})
+		}
+	}
+}
+
+// Edges returns the edges starting from a token
+func (r *Router) Edges(tokenIn common.Address) []Edge {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return append([]Edge(nil), r.edges[tokenIn]...)
+}
+
+// Routes returns the best routes from tokenIn to tokenOut sorted by output amount
+// routes have at most maxHops pools and do not visit a token twice
+// at most limit routes are returned and kept for each intermediate token
+func (r *Router) Routes(tokenIn common.Address, tokenOut common.Address, amountIn *big.Int, maxHops int, limit int) ([]Route, error) {
+	if amountIn == nil || amountIn.Sign() <= 0 || limit <= 0 {
+		return nil, InvalidAmount
+	}
+	if maxHops <= 0 {
+		return nil, InvalidHops
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	routes := make([]Route, 0)
+	partials := []Route{{Hops: []Hop{}, AmountIn: amountIn, AmountOut: amountIn}}
+
+	for hop := 0; hop < maxHops && len(partials) > 0; hop++ {
+		// extend partial routes by one pool, grouped by the last token
+		next := make(map[common.Address][]Route)
+		for _, partial := range partials {
+			last := tokenIn
+			if len(partial.Hops) > 0 {
+				last = partial.Hops[len(partial.Hops)-1].TokenOut.Address
+			}
+
+			for _, e := range r.edges[last] {
+				if visits(partial, tokenIn, e.TokenOut.Address) {
+					continue
+				}
+
+				// skip pools that can not fill the amount
+				amountOut, err := e.AmountOut(partial.AmountOut)
+				if err != nil || amountOut.Sign() <= 0 {
+					continue
+				}
+
+				extended := extend(partial, e, amountOut)
+				if e.TokenOut.Address == tokenOut {
+					routes = append(routes, extended)
+				} else if hop+1 < maxHops {
+					next[e.TokenOut.Address] = append(next[e.TokenOut.Address], extended)
+				}
+			}
+		}
+
+		// keep the best partial routes for each intermediate token
+		partials = partials[:0]
+		for _, candidates := range next {
+			sortRoutes(candidates)
+			partials = append(partials, candidates[:min(limit, len(candidates))]...)
+		}
+	}
+
+	if len(routes) == 0 {
+		return nil, NoRoute
+	}
+
+	sortRoutes(routes)
+	return routes[:min(limit, len(routes))], nil
+}
+
+///
+/// Utils
+///
+
+// visits returns true if the route already visits the token
+func visits(r Route, tokenIn common.Address, t common.Address) bool {
+	if t == tokenIn {
+		return true
+	}
+	for _, h := range r.Hops {
+		if h.TokenOut.Address == t {
+			return true
+		}
+	}
+	return false
+}
+
+// extend returns a copy of the route with an additional hop
+func extend(r Route, e Edge, amountOut *big.Int) Route {
+	hops := make([]Hop, len(r.Hops), len(r.Hops)+1)
+	copy(hops, r.Hops)
+	hops = append(hops, Hop{
+		Edge:      e,
+		AmountIn:  r.AmountOut,
+		AmountOut: amountOut,
+	})
+
+	block := e.LastBlock()
+	if len(r.Hops) > 0 && r.Block < block {
+		block = r.Block
+	}
+
+	return Route{
+		Hops:      hops,
+		AmountIn:  r.AmountIn,
+		AmountOut: amountOut,
+		Block:     block,
+	}
+}
+
+// sortRoutes sorts routes by output amount, then by hop count
+func sortRoutes(routes []Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if c := routes[i].AmountOut.Cmp(routes[j].AmountOut); c != 0 {
+			return c > 0
+		}
+		return len(routes[i].Hops) < len(routes[j].Hops)
+	})
+}
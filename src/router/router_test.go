@@ -0,0 +1,78 @@
+package router_test
+
+import (
+	"PoolHelper/src/pool"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/router"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"bytes"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func newPool(tokenA, tokenB common.Address, reserveA, reserveB int64, block uint64) pool.Pool[uniswap.Reserves, any] {
+	p := uniswap.NewV2Pool(common.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"), common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"), 30, pair.Pair[any]{
+		TokenA: token.ERC20{Address: tokenA},
+		TokenB: token.ERC20{Address: tokenB},
+	})
+
+	// reserves are sorted by address
+	if bytes.Compare(tokenB.Bytes(), tokenA.Bytes()) < 0 {
+		reserveA, reserveB = reserveB, reserveA
+	}
+	p.Update(uniswap.Reserves{Reserve0: big.NewInt(reserveA), Reserve1: big.NewInt(reserveB)}, block)
+	return p
+}
+
+func TestRouter_Routes(t *testing.T) {
+	a, b, c, d := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c"), common.HexToAddress("0x0d")
+
+	// the direct pool is 1:1, the path through c is 1:2
+	r := router.NewRouter()
+	router.AddPools(r, []pool.Pool[uniswap.Reserves, any]{
+		newPool(a, b, 1_000_000, 1_000_000, 10),
+		newPool(a, c, 1_000_000, 1_000_000, 11),
+		newPool(c, b, 1_000_000, 2_000_000, 12),
+		newPool(a, d, 0, 0, 12),
+	})
+
+	routes, err := r.Routes(a, b, big.NewInt(1_000), 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+
+	// best route goes through c
+	best := routes[0]
+	if len(best.Hops) != 2 || best.Hops[0].TokenOut.Address != c {
+		t.Errorf("expected route through c, got %v", best.Tokens())
+	}
+	if best.AmountOut.Cmp(routes[1].AmountOut) <= 0 {
+		t.Errorf("routes are not sorted")
+	}
+	if best.Hops[1].AmountIn.Cmp(best.Hops[0].AmountOut) != 0 {
+		t.Errorf("hop amounts are not chained")
+	}
+	if best.Block != 11 {
+		t.Errorf("expected block 11, got %d", best.Block)
+	}
+
+	// single hop only finds the direct pool
+	routes, err = r.Routes(a, b, big.NewInt(1_000), 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].Hops[0].TokenOut.Address != b {
+		t.Errorf("expected the direct route")
+	}
+
+	// empty pools are skipped
+	if _, err := r.Routes(a, d, big.NewInt(1_000), 3, 5); !errors.Is(err, router.NoRoute) {
+		t.Errorf("expected no route, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"PoolHelper/src/cache"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"net/http"
+	"strings"
+)
+
+var (
+	StreamingUnsupported = errors.New("streaming unsupported")
+)
+
+// FeedBuffer is the number of events buffered for each feed subscriber
+// subscribers that fall further behind are disconnected
+const FeedBuffer = 16
+
+// PoolUpdate is the state change of a pool in a block
+type PoolUpdate struct {
+	Address common.Address `json:"address"`
+	Factory common.Address `json:"factory"`
+	Cache   string         `json:"cache"`
+	Token0  common.Address `json:"token0"`
+	Token1  common.Address `json:"token1"`
+
+	// Old is the previously published state, null for new pools
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// BlockUpdate is the list of pools whose state changed in a block
+type BlockUpdate struct {
+	Block     uint64       `json:"block"`
+	BlockHash common.Hash  `json:"blockHash"`
+	Pools     []PoolUpdate `json:"pools"`
+}
+
+// event is a Server-Sent Event of the feed
+type event struct {
+	name string
+	id   uint64
+	data any
+}
+
+// published is the last published state of a pool, with its encoding sent as the old state of the next update
+type published struct {
+	state any
+	data  json.RawMessage
+}
+
+// subscriber is a feed client with its filters
+type subscriber struct {
+	ch        chan event
+	pools     map[common.Address]bool
+	factories map[common.Address]bool
+	tokens    map[common.Address]bool
+}
+
+// Publish sends the pools whose state changed since the last published block to the feed subscribers
+// it is called after each synced block of the header subscription and returns the unfiltered update
+func (s *Server) Publish(block uint64, blockHash common.Hash) BlockUpdate {
+	update := BlockUpdate{
+		Block:     block,
+		BlockHash: blockHash,
+		Pools:     make([]PoolUpdate, 0),
+	}
+
+	s.m.RLock()
+	equal := make(map[string]func(any, any) bool, len(s.sources))
+	for _, src := range s.sources {
+		equal[src.name] = src.equal
+	}
+	s.m.RUnlock()
+
+	s.feedM.Lock()
+	defer s.feedM.Unlock()
+
+	// diff the pools against the published states, only the changed states are encoded
+	for _, p := range s.Pools() {
+		old, ok := s.published[p.Address]
+		if ok && equal[p.Cache](old.state, p.State.State) {
+			continue
+		}
+		state, err := json.Marshal(p.State.State)
+		if err != nil {
+			continue
+		}
+		s.published[p.Address] = published{state: p.State.State, data: state}
+
+		u := PoolUpdate{
+			Address: p.Address,
+			Factory: p.Factory,
+			Cache:   p.Cache,
+			Token0:  p.Token0.Address,
+			Token1:  p.Token1.Address,
+			New:     state,
+		}
+		if ok {
+			u.Old = old.data
+		}
+		update.Pools = append(update.Pools, u)
+	}
+
+	// send the filtered updates, disconnect subscribers that fall behind
+	for sub := range s.subscribers {
+		filtered := update
+		filtered.Pools = make([]PoolUpdate, 0)
+		for _, u := range update.Pools {
+			if sub.matches(u) {
+				filtered.Pools = append(filtered.Pools, u)
+			}
+		}
+
+		s.send(sub, event{name: "block", id: update.Block, data: filtered})
+	}
+	return update
+}
+
+// PublishReorg sends a reorg to every feed subscriber
+// it is called after the caches were rolled back, the pools of the new branch are published with the next block
+func (s *Server) PublishReorg(reorg cache.Reorg) {
+	s.feedM.Lock()
+	defer s.feedM.Unlock()
+
+	for sub := range s.subscribers {
+		s.send(sub, event{name: "reorg", id: reorg.Head.Number, data: reorg})
+	}
+}
+
+// send sends an event to a subscriber, subscribers that fall behind are disconnected
+// the feed lock must be held
+func (s *Server) send(sub *subscriber, e event) {
+	select {
+	case sub.ch <- e:
+	default:
+		delete(s.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// handleFeed serves GET /feed?pool=...&factory=...&token=... as Server-Sent Events
+// every filter accepts a comma separated list of addresses, every given filter must match
+// a "block" event is sent for each published block, even if no pool matched,
+// and an unfiltered "reorg" event for each reorg
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, StreamingUnsupported)
+		return
+	}
+
+	// parse filters
+	sub := &subscriber{ch: make(chan event, FeedBuffer)}
+	for _, filter := range []struct {
+		param string
+		set   *map[common.Address]bool
+	}{
+		{"pool", &sub.pools},
+		{"factory", &sub.factories},
+		{"token", &sub.tokens},
+	} {
+		set, err := parseAddresses(r.URL.Query()[filter.param])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		*filter.set = set
+	}
+
+	// subscribe
+	s.feedM.Lock()
+	s.subscribers[sub] = true
+	s.feedM.Unlock()
+	defer s.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// confirm the subscription with a comment
+	if _, err := fmt.Fprint(w, ": subscribed\n\n"); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(e.data)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", e.name, e.id, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// unsubscribe removes a subscriber if it is still subscribed
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.feedM.Lock()
+	defer s.feedM.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// matches returns true if the pool update passes the subscriber filters
+func (sub *subscriber) matches(u PoolUpdate) bool {
+	if len(sub.pools) > 0 && !sub.pools[u.Address] {
+		return false
+	}
+	if len(sub.factories) > 0 && !sub.factories[u.Factory] {
+		return false
+	}
+	if len(sub.tokens) > 0 && !sub.tokens[u.Token0] && !sub.tokens[u.Token1] {
+		return false
+	}
+	return true
+}
+
+// parseAddresses parses repeated or comma separated hex addresses
+func parseAddresses(values []string) (map[common.Address]bool, error) {
+	set := make(map[common.Address]bool)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			address, ok := parseAddress(strings.TrimSpace(part))
+			if !ok {
+				return nil, InvalidAddress
+			}
+			set[address] = true
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,131 @@
+package server_test
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/server"
+	"bufio"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// nextEvent reads the data of the next Server-Sent Event
+func nextEvent(t *testing.T, r *bufio.Reader) server.BlockUpdate {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			update := server.BlockUpdate{}
+			if err := json.Unmarshal([]byte(data), &update); err != nil {
+				t.Fatal(err)
+			}
+			return update
+		}
+	}
+}
+
+// subscribe connects to the feed and waits until the subscription is registered
+func subscribe(t *testing.T, url string) *bufio.Reader {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong status: %v", res.StatusCode)
+	}
+
+	r := bufio.NewReader(res.Body)
+	if line, err := r.ReadString('\n'); err != nil || line != ": subscribed\n" {
+		t.Fatalf("subscription not confirmed: %q %v", line, err)
+	}
+	return r
+}
+
+func TestServer_Feed(t *testing.T) {
+	ts, s, c := newTestFeed(t)
+	p := c.Pools()[0]
+
+	// publish the initial states before subscribing
+	if update := s.Publish(100, common.HexToHash("0x64")); len(update.Pools) != len(c.Pools()) || update.Pools[0].Old != nil {
+		t.Errorf("wrong initial update: %+v", update)
+	}
+
+	all := subscribe(t, ts.URL+"/feed")
+	filtered := subscribe(t, ts.URL+"/feed?token=0x0000000000000000000000000000000000000001")
+
+	// unchanged pools are not sent, even if they were synced again
+	reserves, _, _ := p.State()
+	p.Update(reserves, 101)
+	s.Publish(101, common.HexToHash("0x65"))
+	if update := nextEvent(t, all); update.Block != 101 || len(update.Pools) != 0 {
+		t.Errorf("wrong update: %+v", update)
+	}
+	nextEvent(t, filtered)
+
+	// changed pools are sent with their old & new state
+	p.Update(uniswap.Reserves{Reserve0: big.NewInt(1), Reserve1: big.NewInt(2)}, 102)
+	s.Publish(102, common.HexToHash("0x66"))
+
+	update := nextEvent(t, all)
+	if update.Block != 102 || update.BlockHash != common.HexToHash("0x66") || len(update.Pools) != 1 {
+		t.Fatalf("wrong update: %+v", update)
+	}
+	old, state := uniswap.Reserves{}, uniswap.Reserves{}
+	if err := json.Unmarshal(update.Pools[0].Old, &old); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(update.Pools[0].New, &state); err != nil {
+		t.Fatal(err)
+	}
+	if old.Reserve1.Int64() != 2_000_000_000_000 || state.Reserve0.Int64() != 1 || state.Reserve1.Int64() != 2 {
+		t.Errorf("wrong states: %v -> %v", old, state)
+	}
+
+	// filtered subscribers only receive matching pools
+	if update := nextEvent(t, filtered); update.Block != 102 || len(update.Pools) != 0 {
+		t.Errorf("wrong filtered update: %+v", update)
+	}
+}
+
+func TestServer_FeedInvalidFilter(t *testing.T) {
+	ts, _ := newTestServer(t)
+	get(t, ts, "/feed?pool=0x01", http.StatusBadRequest, nil)
+}
+
+func TestServer_FeedReorg(t *testing.T) {
+	ts, s, _ := newTestFeed(t)
+	r := subscribe(t, ts.URL+"/feed?token=0x0000000000000000000000000000000000000001")
+
+	// reorgs are sent to every subscriber
+	s.PublishReorg(cache.Reorg{
+		Ancestor: cache.Block{Number: 100, Hash: common.HexToHash("0x64")},
+		Dropped:  []cache.Block{{Number: 101, Hash: common.HexToHash("0x65")}},
+		Head:     cache.Block{Number: 101, Hash: common.HexToHash("0x66")},
+	})
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name, ok := strings.CutPrefix(line, "event: "); ok && name != "reorg\n" {
+			t.Fatalf("wrong event: %q", name)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			reorg := cache.Reorg{}
+			if err := json.Unmarshal([]byte(data), &reorg); err != nil {
+				t.Fatal(err)
+			}
+			if reorg.Ancestor.Number != 100 || len(reorg.Dropped) != 1 || reorg.Head.Hash != common.HexToHash("0x66") {
+				t.Errorf("wrong reorg: %+v", reorg)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,632 @@
+package server
+
+import (
+	"PoolHelper/src/cache"
+	"PoolHelper/src/pool"
+	"PoolHelper/src/router"
+	"PoolHelper/src/structs/token"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	InvalidAddress = errors.New("invalid address")
+	InvalidAmount  = errors.New("invalid amount")
+	InvalidParam   = errors.New("invalid query parameter")
+	NotFound       = errors.New("not found")
+	NotAllowed     = errors.New("method not allowed")
+)
+
+// defaults of the quote endpoint
+const (
+	DefaultMaxHops = 3
+	DefaultLimit   = 1
+	MaxLimit       = 20
+)
+
+// Token is a cached ERC20 token
+type Token = token.ERC20
+
+// Pool is a cached pool with its last synced state
+type Pool struct {
+	Address common.Address `json:"address"`
+	Factory common.Address `json:"factory"`
+	Cache   string         `json:"cache"`
+	Token0  Token          `json:"token0"`
+	Token1  Token          `json:"token1"`
+	Options any            `json:"options,omitempty"`
+
+	// Price is the price of one token0 in token1 adjusted by the token decimals
+	Price *float64 `json:"price,omitempty"`
+
+	State
+}
+
+// State is the last synced state of a pool
+type State struct {
+	State     any    `json:"state"`
+	Block     uint64 `json:"block"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// PriceChange is the change of the price of one token0 in token1 of a pool between two synced states
+type PriceChange struct {
+	FromBlock uint64  `json:"fromBlock"`
+	ToBlock   uint64  `json:"toBlock"`
+	From      float64 `json:"from"`
+	To        float64 `json:"to"`
+	// Change is the relative change of the price, e.g. 0.01 for +1%
+	Change float64 `json:"change"`
+}
+
+// Hop is a quoted swap through a pool
+type Hop struct {
+	Pool      common.Address `json:"pool"`
+	Factory   common.Address `json:"factory"`
+	TokenIn   common.Address `json:"tokenIn"`
+	TokenOut  common.Address `json:"tokenOut"`
+	AmountIn  *big.Int       `json:"amountIn"`
+	AmountOut *big.Int       `json:"amountOut"`
+}
+
+// Quote is a quoted route
+type Quote struct {
+	AmountIn  *big.Int `json:"amountIn"`
+	AmountOut *big.Int `json:"amountOut"`
+	Block     uint64   `json:"block"`
+	Hops      []Hop    `json:"hops"`
+}
+
+// source is a type erased view of a DEX cache
+type source struct {
+	name      string
+	tokens    func() ([]token.ERC20, error)
+	pool      func(common.Address) (Pool, bool)
+	pools     func() []Pool
+	historian func(common.Address) (historian, bool)
+	equal     func(any, any) bool
+}
+
+// historian is a type erased view of the state history of a pool
+type historian struct {
+	stateAt     func(uint64) (State, error)
+	states      func(uint64, uint64) []State
+	priceChange func(uint64) (PriceChange, error)
+}
+
+// Server serves the cached tokens, pools and quotes as JSON over HTTP
+// requests only take the read locks of the caches, so they do not block syncing
+type Server struct {
+	sources []source
+	router  *router.Router
+	mux     *http.ServeMux
+	m       sync.RWMutex
+
+	// feed subscribers & the last published pool states
+	subscribers map[*subscriber]bool
+	published   map[common.Address]published
+	feedM       sync.Mutex
+}
+
+// NewServer creates a new server, quotes are routed through r
+func NewServer(r *router.Router) *Server {
+	s := &Server{
+		sources: make([]source, 0),
+		router:  r,
+		mux:     http.NewServeMux(),
+		m:       sync.RWMutex{},
+
+		subscribers: make(map[*subscriber]bool),
+		published:   make(map[common.Address]published),
+		feedM:       sync.Mutex{},
+	}
+
+	s.mux.HandleFunc("/tokens", s.handleTokens)
+	s.mux.HandleFunc("/tokens/", s.handleToken)
+	s.mux.HandleFunc("/pools", s.handlePools)
+	s.mux.HandleFunc("/pools/", s.handlePool)
+	s.mux.HandleFunc("/quote", s.handleQuote)
+	s.mux.HandleFunc("/feed", s.handleFeed)
+	return s
+}
+
+// AddCache adds a DEX cache to the server
+// name identifies the cache in pool responses (e.g. "v2")
+func AddCache[ReserveType any, OptionType any](s *Server, name string, c cache.DEXCache[ReserveType, OptionType]) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.sources = append(s.sources, source{
+		name:   name,
+		tokens: c.Tokens,
+		pool: func(address common.Address) (Pool, bool) {
+			p, err := c.Pool(address)
+			if err != nil {
+				return Pool{}, false
+			}
+			return newPool(name, p), true
+		},
+		pools: func() []Pool {
+			cached := c.Pools()
+			pools := make([]Pool, 0, len(cached))
+			for _, p := range cached {
+				pools = append(pools, newPool(name, p))
+			}
+			return pools
+		},
+		historian: func(address common.Address) (historian, bool) {
+			p, err := c.Pool(address)
+			if err != nil {
+				return historian{}, false
+			}
+			return newHistorian(p), true
+		},
+		equal: func(a any, b any) bool {
+			stateA, okA := a.(ReserveType)
+			stateB, okB := b.(ReserveType)
+			return okA && okB && equalState(stateA, stateB)
+		},
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, NotAllowed)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+///
+/// Handlers
+///
+
+// handleTokens serves GET /tokens
+func (s *Server) handleTokens(w http.ResponseWriter, _ *http.Request) {
+	tokens, err := s.Tokens()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// handleToken serves GET /tokens/{address}
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	address, ok := parseAddress(strings.TrimPrefix(r.URL.Path, "/tokens/"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, InvalidAddress)
+		return
+	}
+
+	tokens, err := s.Tokens()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, t := range tokens {
+		if t.Address == address {
+			writeJSON(w, http.StatusOK, t)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, NotFound)
+}
+
+// handlePools serves GET /pools?token=...&tokenA=...&tokenB=...&factory=...
+// every given filter must match, tokenA and tokenB match either pool token
+func (s *Server) handlePools(w http.ResponseWriter, r *http.Request) {
+	filters := make([]func(Pool) bool, 0)
+	for _, param := range []string{"token", "tokenA", "tokenB", "factory"} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+
+		address, ok := parseAddress(value)
+		if !ok {
+			writeError(w, http.StatusBadRequest, InvalidAddress)
+			return
+		}
+		if param == "factory" {
+			filters = append(filters, func(p Pool) bool { return p.Factory == address })
+		} else {
+			filters = append(filters, func(p Pool) bool { return p.Token0.Address == address || p.Token1.Address == address })
+		}
+	}
+
+	pools := make([]Pool, 0)
+	for _, p := range s.Pools() {
+		if matches(p, filters) {
+			pools = append(pools, p)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, pools)
+}
+
+// handlePool serves GET /pools/{address}, GET /pools/{address}/state?block=...,
+// GET /pools/{address}/history?from=...&to=... and GET /pools/{address}/change?blocks=...
+// the state at a block, the history and the price change are served from the synced states kept by the pool
+func (s *Server) handlePool(w http.ResponseWriter, r *http.Request) {
+	path, view, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/pools/"), "/")
+
+	address, ok := parseAddress(path)
+	if !ok {
+		writeError(w, http.StatusBadRequest, InvalidAddress)
+		return
+	}
+
+	p, ok := s.Pool(address)
+	if !ok {
+		writeError(w, http.StatusNotFound, NotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	switch view {
+	case "":
+		writeJSON(w, http.StatusOK, p)
+	case "state":
+		if query.Get("block") == "" {
+			writeJSON(w, http.StatusOK, p.State)
+			return
+		}
+		block, err := parseInt(query.Get("block"), 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		state, err := s.StateAt(address, uint64(block))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, state)
+	case "history":
+		from, err := parseInt(query.Get("from"), 1)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		to, err := parseInt(query.Get("to"), int(p.Block))
+		if err != nil || to < from {
+			writeError(w, http.StatusBadRequest, InvalidParam)
+			return
+		}
+		states, _ := s.States(address, uint64(from), uint64(to))
+		writeJSON(w, http.StatusOK, states)
+	case "change":
+		blocks, err := parseInt(query.Get("blocks"), 0)
+		if err != nil || blocks == 0 {
+			writeError(w, http.StatusBadRequest, InvalidParam)
+			return
+		}
+		change, err := s.PriceChange(address, uint64(blocks))
+		if errors.Is(err, pool.StateNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, change)
+	default:
+		writeError(w, http.StatusNotFound, NotFound)
+	}
+}
+
+// handleQuote serves GET /quote?tokenIn=...&tokenOut=...&amountIn=...&maxHops=...&limit=...
+// amountIn is in the smallest unit of tokenIn
+func (s *Server) handleQuote(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	tokenIn, okIn := parseAddress(query.Get("tokenIn"))
+	tokenOut, okOut := parseAddress(query.Get("tokenOut"))
+	if !okIn || !okOut {
+		writeError(w, http.StatusBadRequest, InvalidAddress)
+		return
+	}
+	amountIn, ok := new(big.Int).SetString(query.Get("amountIn"), 10)
+	if !ok || amountIn.Sign() <= 0 {
+		writeError(w, http.StatusBadRequest, InvalidAmount)
+		return
+	}
+	maxHops, err := parseInt(query.Get("maxHops"), DefaultMaxHops)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parseInt(query.Get("limit"), DefaultLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	quotes, err := s.Quote(tokenIn, tokenOut, amountIn, maxHops, min(limit, MaxLimit))
+	if errors.Is(err, router.NoRoute) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, quotes)
+}
+
+///
+/// Sources
+///
+
+// Tokens returns the tokens of all caches sorted by address
+func (s *Server) Tokens() ([]Token, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	seen := make(map[common.Address]bool)
+	tokens := make([]Token, 0)
+	for _, src := range s.sources {
+		cached, err := src.tokens()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range cached {
+			if !seen[t.Address] {
+				seen[t.Address] = true
+				tokens = append(tokens, t)
+			}
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return bytes.Compare(tokens[i].Address.Bytes(), tokens[j].Address.Bytes()) < 0
+	})
+	return tokens, nil
+}
+
+// Pool returns a pool of any cache
+func (s *Server) Pool(address common.Address) (Pool, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	for _, src := range s.sources {
+		if p, ok := src.pool(address); ok {
+			return p, true
+		}
+	}
+	return Pool{}, false
+}
+
+// Pools returns the pools of all caches sorted by address
+func (s *Server) Pools() []Pool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	pools := make([]Pool, 0)
+	for _, src := range s.sources {
+		pools = append(pools, src.pools()...)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return bytes.Compare(pools[i].Address.Bytes(), pools[j].Address.Bytes()) < 0
+	})
+	return pools
+}
+
+// StateAt returns the state of a pool at a block, the last state synced at or before it
+func (s *Server) StateAt(address common.Address, block uint64) (State, error) {
+	h, ok := s.historian(address)
+	if !ok {
+		return State{}, NotFound
+	}
+	return h.stateAt(block)
+}
+
+// States returns the states of a pool synced between two blocks (inclusive), oldest first
+func (s *Server) States(address common.Address, from uint64, to uint64) ([]State, error) {
+	h, ok := s.historian(address)
+	if !ok {
+		return nil, NotFound
+	}
+	return h.states(from, to), nil
+}
+
+// PriceChange returns the change of the price of a pool over the last blocks
+func (s *Server) PriceChange(address common.Address, blocks uint64) (PriceChange, error) {
+	h, ok := s.historian(address)
+	if !ok {
+		return PriceChange{}, NotFound
+	}
+	return h.priceChange(blocks)
+}
+
+// historian returns the state history of a pool of any cache
+func (s *Server) historian(address common.Address) (historian, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	for _, src := range s.sources {
+		if h, ok := src.historian(address); ok {
+			return h, true
+		}
+	}
+	return historian{}, false
+}
+
+// Quote returns up to limit of the best routes for amountIn of tokenIn to tokenOut
+func (s *Server) Quote(tokenIn common.Address, tokenOut common.Address, amountIn *big.Int, maxHops int, limit int) ([]Quote, error) {
+	routes, err := s.router.Routes(tokenIn, tokenOut, amountIn, maxHops, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make([]Quote, 0, len(routes))
+	for _, route := range routes {
+		quotes = append(quotes, NewQuote(route))
+	}
+	return quotes, nil
+}
+
+///
+/// Utils
+///
+
+// newPool creates the response of a cached pool
+// equalState compares two pool states with their Equal method, states without one are compared by value
+func equalState[ReserveType any](a ReserveType, b ReserveType) bool {
+	if e, ok := any(a).(interface{ Equal(ReserveType) bool }); ok {
+		return e.Equal(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func newPool[ReserveType any, OptionType any](name string, p pool.Pool[ReserveType, OptionType]) Pool {
+	state, block, timestamp := p.State()
+	poolPair := p.Pair()
+	token0, token1 := poolPair.SortTokens()
+
+	res := Pool{
+		Address: p.Address(),
+		Factory: p.Factory(),
+		Cache:   name,
+		Token0:  token0,
+		Token1:  token1,
+		Options: poolPair.PairOptions,
+		State: State{
+			State:     state,
+			Block:     block,
+			Timestamp: timestamp,
+		},
+	}
+
+	// price of token0 in token1
+	if price, err := p.Price(); err == nil {
+		f := price.AInBFloat()
+		if poolPair.TokenA.Address != token0.Address {
+			f = price.BInAFloat()
+		}
+		res.Price = &f
+	}
+
+	return res
+}
+
+// newHistorian creates the type erased state history of a pool
+// prices are the price of one token0 in token1 like the pool response
+func newHistorian[ReserveType any, OptionType any](p pool.Pool[ReserveType, OptionType]) historian {
+	poolPair := p.Pair()
+	token0, _ := poolPair.SortTokens()
+	inverse := poolPair.TokenA.Address != token0.Address
+
+	return historian{
+		stateAt: func(block uint64) (State, error) {
+			r, err := p.StateAt(block)
+			if err != nil {
+				return State{}, err
+			}
+			return State{State: r.State, Block: r.Block, Timestamp: r.Timestamp}, nil
+		},
+		states: func(from uint64, to uint64) []State {
+			records := p.States(from, to)
+			states := make([]State, 0, len(records))
+			for _, r := range records {
+				states = append(states, State{State: r.State, Block: r.Block, Timestamp: r.Timestamp})
+			}
+			return states
+		},
+		priceChange: func(blocks uint64) (PriceChange, error) {
+			c, err := p.PriceChange(blocks)
+			if err != nil {
+				return PriceChange{}, err
+			}
+
+			res := PriceChange{
+				FromBlock: c.FromBlock,
+				ToBlock:   c.ToBlock,
+				From:      c.From.AInBFloat(),
+				To:        c.To.AInBFloat(),
+				Change:    c.AInBFloat(),
+			}
+			if inverse {
+				res.From, res.To, res.Change = c.From.BInAFloat(), c.To.BInAFloat(), c.BInAFloat()
+			}
+			return res, nil
+		},
+	}
+}
+
+// NewQuote creates the response of a route
+func NewQuote(r router.Route) Quote {
+	q := Quote{
+		AmountIn:  r.AmountIn,
+		AmountOut: r.AmountOut,
+		Block:     r.Block,
+		Hops:      make([]Hop, 0, len(r.Hops)),
+	}
+	for _, h := range r.Hops {
+		q.Hops = append(q.Hops, Hop{
+			Pool:      h.Pool,
+			Factory:   h.Factory,
+			TokenIn:   h.TokenIn.Address,
+			TokenOut:  h.TokenOut.Address,
+			AmountIn:  h.AmountIn,
+			AmountOut: h.AmountOut,
+		})
+	}
+	return q
+}
+
+// matches returns true if the pool matches every filter
+func matches(p Pool, filters []func(Pool) bool) bool {
+	for _, f := range filters {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAddress parses a hex address
+func parseAddress(s string) (common.Address, bool) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, false
+	}
+	return common.HexToAddress(s), true
+}
+
+// parseInt parses a positive integer query parameter, empty values use the default
+func parseInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil || i <= 0 {
+		return 0, InvalidParam
+	}
+	return i, nil
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,197 @@
+package server_test
+
+import (
+	"PoolHelper/src/cache"
+	cacheUniswap "PoolHelper/src/cache/uniswap"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/router"
+	"PoolHelper/src/server"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	weth = token.ERC20{Address: common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"), Decimals: big.NewInt(18), Symbol: "WETH", Name: "Wrapped Ether"}
+	usdt = token.ERC20{Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), Decimals: big.NewInt(6), Symbol: "USDT", Name: "Tether USD"}
+
+	v2Factory = factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+)
+
+// newTestServer serves a V2 cache with a WETH/USDT pool of 1000 WETH and 2,000,000 USDT synced at block 100
+func newTestServer(t *testing.T) (*httptest.Server, common.Address) {
+	ts, _, c := newTestFeed(t)
+	return ts, c.Pools()[0].Address()
+}
+
+// newTestFeed is newTestServer returning the server and cache to publish updates
+func newTestFeed(t *testing.T) (*httptest.Server, *server.Server, *cacheUniswap.V2Cache) {
+	p := uniswap.NewV2Pool(v2Factory.Address, v2Factory.InitHash, v2Factory.SwapFee, pair.NewPair[any](weth, usdt, nil))
+	reserve0, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	c := cacheUniswap.NewV2Cache()
+	err := c.Restore(cache.Snapshot[uniswap.Reserves, any]{
+		Version:   cache.SnapshotVersion,
+		Block:     100,
+		Tokens:    []token.ERC20{weth, usdt},
+		Factories: []factory.Factory[any]{v2Factory},
+		Pools: []cache.PoolSnapshot[uniswap.Reserves, any]{{
+			Address: p.Address(),
+			Factory: v2Factory.Address,
+			TokenA:  weth.Address,
+			TokenB:  usdt.Address,
+			State:   uniswap.Reserves{Reserve0: reserve0, Reserve1: big.NewInt(2_000_000_000_000)},
+			Block:   100,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := router.NewRouter()
+	router.AddPools(r, c.Pools())
+	s := server.NewServer(r)
+	server.AddCache[uniswap.Reserves, any](s, "v2", c)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts, s, c
+}
+
+// get requests a path and decodes the JSON response
+func get(t *testing.T, ts *httptest.Server, path string, status int, v any) {
+	res, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		t.Fatalf("wrong status for %s: %v (expected %v)", path, res.StatusCode, status)
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServer_Tokens(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	var tokens []token.ERC20
+	get(t, ts, "/tokens", http.StatusOK, &tokens)
+	if len(tokens) != 2 {
+		t.Fatalf("wrong number of tokens: %v", len(tokens))
+	}
+
+	var tkn token.ERC20
+	get(t, ts, "/tokens/"+usdt.Address.Hex(), http.StatusOK, &tkn)
+	if tkn.Symbol != "USDT" || tkn.Decimals.Int64() != 6 {
+		t.Errorf("wrong token: %+v", tkn)
+	}
+
+	get(t, ts, "/tokens/0x01", http.StatusBadRequest, nil)
+	get(t, ts, "/tokens/0x0000000000000000000000000000000000000001", http.StatusNotFound, nil)
+}
+
+func TestServer_Pools(t *testing.T) {
+	ts, poolAddr := newTestServer(t)
+
+	var pools []server.Pool
+	get(t, ts, "/pools?tokenA="+weth.Address.Hex()+"&tokenB="+usdt.Address.Hex(), http.StatusOK, &pools)
+	if len(pools) != 1 || pools[0].Address != poolAddr || pools[0].Cache != "v2" {
+		t.Fatalf("wrong pools: %+v", pools)
+	}
+	if pools[0].Price == nil || *pools[0].Price != 2000 {
+		t.Errorf("wrong price: %v", pools[0].Price)
+	}
+
+	get(t, ts, "/pools?factory=0x0000000000000000000000000000000000000001", http.StatusOK, &pools)
+	if len(pools) != 0 {
+		t.Errorf("wrong number of pools: %v", len(pools))
+	}
+
+	var state struct {
+		State uniswap.Reserves `json:"state"`
+		Block uint64           `json:"block"`
+	}
+	get(t, ts, "/pools/"+poolAddr.Hex()+"/state", http.StatusOK, &state)
+	if state.Block != 100 || state.State.Reserve1.Int64() != 2_000_000_000_000 {
+		t.Errorf("wrong state: %+v", state)
+	}
+
+	get(t, ts, "/pools/0x0000000000000000000000000000000000000001", http.StatusNotFound, nil)
+}
+
+func TestServer_PoolHistory(t *testing.T) {
+	ts, _, c := newTestFeed(t)
+	p := c.Pools()[0]
+	reserve0, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	p.Update(uniswap.Reserves{Reserve0: reserve0, Reserve1: big.NewInt(2_200_000_000_000)}, 110)
+	path := "/pools/" + p.Address().Hex()
+
+	var state struct {
+		State uniswap.Reserves `json:"state"`
+		Block uint64           `json:"block"`
+	}
+	get(t, ts, path+"/state?block=105", http.StatusOK, &state)
+	if state.Block != 100 || state.State.Reserve1.Int64() != 2_000_000_000_000 {
+		t.Errorf("wrong state at 105: %+v", state)
+	}
+	get(t, ts, path+"/state?block=99", http.StatusNotFound, nil)
+	get(t, ts, path+"/state?block=abc", http.StatusBadRequest, nil)
+
+	var states []json.RawMessage
+	get(t, ts, path+"/history?from=100", http.StatusOK, &states)
+	if len(states) != 2 {
+		t.Errorf("wrong number of states: %v", len(states))
+	}
+	get(t, ts, path+"/history?from=110&to=100", http.StatusBadRequest, nil)
+
+	var change server.PriceChange
+	get(t, ts, path+"/change?blocks=10", http.StatusOK, &change)
+	if change.FromBlock != 100 || change.ToBlock != 110 || change.From != 2000 || change.To != 2200 || math.Abs(change.Change-0.1) > 1e-9 {
+		t.Errorf("wrong price change: %+v", change)
+	}
+	get(t, ts, path+"/change?blocks=20", http.StatusNotFound, nil)
+	get(t, ts, path+"/change", http.StatusBadRequest, nil)
+	get(t, ts, path+"/unknown", http.StatusNotFound, nil)
+}
+
+func TestServer_Quote(t *testing.T) {
+	ts, poolAddr := newTestServer(t)
+
+	var quotes []server.Quote
+	get(t, ts, "/quote?tokenIn="+weth.Address.Hex()+"&tokenOut="+usdt.Address.Hex()+"&amountIn=1000000000000000", http.StatusOK, &quotes)
+	if len(quotes) != 1 || len(quotes[0].Hops) != 1 || quotes[0].Hops[0].Pool != poolAddr {
+		t.Fatalf("wrong quotes: %+v", quotes)
+	}
+	if quotes[0].AmountOut.Int64() != 1993998 || quotes[0].Block != 100 {
+		t.Errorf("wrong quote: %v at block %v", quotes[0].AmountOut, quotes[0].Block)
+	}
+
+	get(t, ts, "/quote?tokenIn="+weth.Address.Hex()+"&tokenOut="+usdt.Address.Hex()+"&amountIn=-1", http.StatusBadRequest, nil)
+	get(t, ts, "/quote?tokenIn="+weth.Address.Hex()+"&tokenOut=0x0000000000000000000000000000000000000001&amountIn=1", http.StatusNotFound, nil)
+
+	res, err := http.Post(ts.URL+"/quote", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status: %v", res.StatusCode)
+	}
+}
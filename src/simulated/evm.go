@@ -0,0 +1,279 @@
+package simulated
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"math/big"
+)
+
+///
+/// Assembler
+///
+
+// program assembles EVM bytecode with jump labels
+type program struct {
+	code   []byte
+	labels map[string]int
+	jumps  map[int]string
+}
+
+func newProgram() *program {
+	return &program{
+		code:   make([]byte, 0),
+		labels: make(map[string]int),
+		jumps:  make(map[int]string),
+	}
+}
+
+// op appends opcodes
+func (p *program) op(ops ...vm.OpCode) *program {
+	for _, op := range ops {
+		p.code = append(p.code, byte(op))
+	}
+	return p
+}
+
+// push appends the shortest push of a value, PUSH0 is avoided for older forks
+func (p *program) push(value uint64) *program {
+	data := new(big.Int).SetUint64(value).Bytes()
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	p.code = append(p.code, byte(vm.PUSH1)+byte(len(data)-1))
+	p.code = append(p.code, data...)
+	return p
+}
+
+// pushLabel appends a push of the position of a label
+func (p *program) pushLabel(name string) *program {
+	p.code = append(p.code, byte(vm.PUSH2))
+	p.jumps[len(p.code)] = name
+	p.code = append(p.code, 0, 0)
+	return p
+}
+
+// jump appends a jump to a label
+func (p *program) jump(name string) *program {
+	return p.pushLabel(name).op(vm.JUMP)
+}
+
+// jumpIf appends a jump to a label if the top of the stack is not zero
+func (p *program) jumpIf(name string) *program {
+	return p.pushLabel(name).op(vm.JUMPI)
+}
+
+// label marks the position of a label with a jump destination
+func (p *program) label(name string) *program {
+	p.labels[name] = len(p.code)
+	return p.op(vm.JUMPDEST)
+}
+
+// load appends a load of a memory variable
+func (p *program) load(variable uint64) *program {
+	return p.push(variable).op(vm.MLOAD)
+}
+
+// store appends a store of the top of the stack into a memory variable
+func (p *program) store(variable uint64) *program {
+	return p.push(variable).op(vm.MSTORE)
+}
+
+// bytes returns the bytecode with the label positions filled in
+func (p *program) bytes() []byte {
+	code := append([]byte(nil), p.code...)
+	for pos, name := range p.jumps {
+		target, ok := p.labels[name]
+		if !ok {
+			panic("undefined label " + name)
+		}
+		binary.BigEndian.PutUint16(code[pos:], uint16(target))
+	}
+	return code
+}
+
+///
+/// Multicall3
+///
+
+// memory variables of the multicall code, the results are encoded after them
+const (
+	varCount   = 0x00
+	varBase    = 0x20
+	varIndex   = 0x40
+	varPtr     = 0x60
+	varTuple   = 0x80
+	varBytes   = 0xa0
+	varSuccess = 0xc0
+	varAllow   = 0xe0
+	output     = 0x100
+)
+
+// multicallCode returns the runtime code of a Multicall3 subset, aggregate3 and tryBlockAndAggregate
+func multicallCode() []byte {
+	p := newProgram()
+
+	// dispatch on the function selector
+	p.push(0).op(vm.CALLDATALOAD).push(224).op(vm.SHR)
+	p.op(vm.DUP1).push(0x82ad56cb).op(vm.EQ).jumpIf("aggregate3")
+	p.op(vm.DUP1).push(0x399542e9).op(vm.EQ).jumpIf("tryBlockAndAggregate")
+	p.push(0).op(vm.DUP1, vm.REVERT)
+
+	// aggregate3(Call3[]) returns (Result[])
+	p.label("aggregate3").op(vm.POP)
+	p.push(0x20).store(output)
+	p.push(4).op(vm.CALLDATALOAD).push(4).op(vm.ADD)
+	aggregate(p, "aggregate3", 1, true)
+
+	// tryBlockAndAggregate(bool, Call[]) returns (uint256, bytes32, Result[])
+	p.label("tryBlockAndAggregate").op(vm.POP)
+	p.op(vm.NUMBER).store(output)
+	p.op(vm.NUMBER, vm.BLOCKHASH).store(output + 0x20)
+	p.push(0x60).store(output + 0x40)
+	p.push(4).op(vm.CALLDATALOAD, vm.ISZERO).store(varAllow)
+	p.push(36).op(vm.CALLDATALOAD).push(4).op(vm.ADD)
+	aggregate(p, "tryBlockAndAggregate", 3, false)
+
+	return p.bytes()
+}
+
+// aggregate appends the loop over the calls of an array whose calldata position is on the stack
+// headWords is the number of return values before the results array,
+// call3 decodes calls with an allowFailure flag instead of the requireSuccess argument
+func aggregate(p *program, name string, headWords uint64, call3 bool) {
+	elements := uint64(output + 0x20*(headWords+1))
+	bytesOffset := uint64(0x20)
+	if call3 {
+		bytesOffset = 0x40
+	}
+
+	// the results start after their offsets
+	p.op(vm.DUP1, vm.CALLDATALOAD).store(varCount)
+	p.push(0x20).op(vm.ADD).store(varBase)
+	p.load(varCount).store(elements - 0x20)
+	p.load(varCount).push(5).op(vm.SHL).push(elements).op(vm.ADD).store(varPtr)
+	p.push(0).store(varIndex)
+
+	p.label(name + "Loop")
+	p.load(varCount).load(varIndex).op(vm.LT, vm.ISZERO).jumpIf(name + "End")
+
+	// decode the call
+	p.load(varIndex).push(5).op(vm.SHL).load(varBase).op(vm.ADD, vm.CALLDATALOAD).load(varBase).op(vm.ADD).store(varTuple)
+	if call3 {
+		p.load(varTuple).push(0x20).op(vm.ADD, vm.CALLDATALOAD).store(varAllow)
+	}
+	p.load(varTuple).push(bytesOffset).op(vm.ADD, vm.CALLDATALOAD).load(varTuple).op(vm.ADD).store(varBytes)
+
+	// copy the call data after the result head and make the call
+	p.load(varBytes).op(vm.CALLDATALOAD)
+	p.load(varBytes).push(0x20).op(vm.ADD)
+	p.load(varPtr).push(0x60).op(vm.ADD)
+	p.op(vm.CALLDATACOPY)
+	p.push(0).push(0)
+	p.load(varBytes).op(vm.CALLDATALOAD)
+	p.load(varPtr).push(0x60).op(vm.ADD)
+	p.push(0)
+	p.load(varTuple).op(vm.CALLDATALOAD)
+	p.op(vm.GAS, vm.CALL)
+
+	// revert if a required call failed
+	p.op(vm.DUP1).store(varSuccess)
+	p.load(varAllow).op(vm.OR).jumpIf(name + "Ok")
+	p.push(0).op(vm.DUP1, vm.REVERT)
+	p.label(name + "Ok")
+
+	// encode the result and its offset
+	p.push(elements).load(varPtr).op(vm.SUB)
+	p.load(varIndex).push(5).op(vm.SHL).push(elements).op(vm.ADD, vm.MSTORE)
+	p.load(varSuccess).load(varPtr).op(vm.MSTORE)
+	p.push(0x40).load(varPtr).push(0x20).op(vm.ADD, vm.MSTORE)
+	p.op(vm.RETURNDATASIZE).load(varPtr).push(0x40).op(vm.ADD, vm.MSTORE)
+	p.op(vm.RETURNDATASIZE).push(0).load(varPtr).push(0x60).op(vm.ADD, vm.RETURNDATACOPY)
+	p.push(0).op(vm.RETURNDATASIZE).load(varPtr).push(0x60).op(vm.ADD, vm.ADD, vm.MSTORE)
+
+	// move to the next result, return data is padded to words
+	p.op(vm.RETURNDATASIZE).push(31).op(vm.ADD).push(5).op(vm.SHR).push(5).op(vm.SHL)
+	p.push(0x60).op(vm.ADD).load(varPtr).op(vm.ADD).store(varPtr)
+	p.load(varIndex).push(1).op(vm.ADD).store(varIndex)
+	p.jump(name + "Loop")
+
+	p.label(name + "End")
+	p.push(output).load(varPtr).op(vm.SUB).push(output).op(vm.RETURN)
+}
+
+///
+/// Stub
+///
+
+// setSelector is the selector of the stub function that stores a response
+const setSelector = 0xffffffff
+
+// emitSelector is the selector of the stub function that emits a log
+const emitSelector = 0xfffffffe
+
+// stubCode returns the runtime code of a stub contract, it answers calls with stored responses
+// the response of a call is stored at the hash of its call data as its length followed by its words,
+// calls without a response return a zero word like unset mapping getters.
+// a call with the set selector, a key, a length and the response words stores a response,
+// a call with the emit selector, a topic count, the topics and the log data emits a log
+func stubCode() []byte {
+	p := newProgram()
+
+	p.push(0).op(vm.CALLDATALOAD).push(224).op(vm.SHR)
+	p.op(vm.DUP1).push(setSelector).op(vm.EQ).jumpIf("set")
+	p.op(vm.DUP1).push(emitSelector).op(vm.EQ).jumpIf("emit")
+	p.op(vm.POP)
+
+	// load the response of the call data
+	p.op(vm.CALLDATASIZE).push(0).push(0).op(vm.CALLDATACOPY)
+	p.op(vm.CALLDATASIZE).push(0).op(vm.KECCAK256)
+	p.op(vm.DUP1, vm.SLOAD)
+	p.op(vm.DUP1, vm.ISZERO).jumpIf("zero")
+	p.push(0)
+	p.label("load")
+	p.op(vm.DUP2, vm.DUP2).push(5).op(vm.SHL, vm.LT, vm.ISZERO).jumpIf("return")
+	p.op(vm.DUP1, vm.DUP4, vm.ADD).push(1).op(vm.ADD, vm.SLOAD)
+	p.op(vm.DUP2).push(5).op(vm.SHL, vm.MSTORE)
+	p.push(1).op(vm.ADD)
+	p.jump("load")
+	p.label("return")
+	p.op(vm.POP).push(0).op(vm.RETURN)
+	p.label("zero")
+	p.push(0).push(0).op(vm.MSTORE)
+	p.push(0x20).push(0).op(vm.RETURN)
+
+	// store a response
+	p.label("set").op(vm.POP)
+	p.push(36).op(vm.CALLDATALOAD).push(4).op(vm.CALLDATALOAD, vm.SSTORE)
+	p.push(0)
+	p.label("store")
+	p.push(68).op(vm.CALLDATASIZE, vm.SUB, vm.DUP2).push(5).op(vm.SHL, vm.LT, vm.ISZERO).jumpIf("stored")
+	p.op(vm.DUP1).push(5).op(vm.SHL).push(68).op(vm.ADD, vm.CALLDATALOAD)
+	p.op(vm.DUP2).push(4).op(vm.CALLDATALOAD, vm.ADD).push(1).op(vm.ADD, vm.SSTORE)
+	p.push(1).op(vm.ADD)
+	p.jump("store")
+	p.label("stored")
+	p.op(vm.STOP)
+
+	// copy the log data after the topics, then emit it with 1 to 4 topics
+	p.label("emit").op(vm.POP)
+	p.push(4).op(vm.CALLDATALOAD)
+	p.op(vm.DUP1).push(5).op(vm.SHL).push(36).op(vm.ADD)
+	p.op(vm.DUP1, vm.CALLDATASIZE, vm.SUB)
+	p.op(vm.DUP1, vm.DUP3).push(0).op(vm.CALLDATACOPY)
+	p.op(vm.SWAP1, vm.POP)
+	for topics := uint64(1); topics <= 4; topics++ {
+		p.op(vm.DUP2).push(topics).op(vm.EQ).jumpIf(fmt.Sprintf("log%d", topics))
+	}
+	p.push(0).op(vm.DUP1, vm.REVERT)
+	for topics := uint64(1); topics <= 4; topics++ {
+		p.label(fmt.Sprintf("log%d", topics))
+		for i := topics; i >= 1; i-- {
+			p.push(4 + 32*i).op(vm.CALLDATALOAD)
+		}
+		p.op(vm.DUP1 + vm.OpCode(topics)).push(0)
+		p.op(vm.LOG0+vm.OpCode(topics), vm.STOP)
+	}
+
+	return p.bytes()
+}
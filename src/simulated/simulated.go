@@ -0,0 +1,573 @@
+package simulated
+
+import (
+	"PoolHelper/src/chain"
+	"PoolHelper/src/multicall/generic"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/provider"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	UnknownStub = errors.New("unknown stub")
+)
+
+// GasLimit is the block gas limit of a simulated chain
+const GasLimit = 30_000_000
+
+// topics of the pool events emitted by the stubs
+var (
+	syncTopic = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+	swapTopic = crypto.Keccak256Hash([]byte("Swap(address,address,int256,int256,uint160,uint128,int24)"))
+	mintTopic = crypto.Keccak256Hash([]byte("Mint(address,address,int24,int24,uint128,uint256,uint256)"))
+	burnTopic = crypto.Keccak256Hash([]byte("Burn(address,int24,int24,uint128,uint256,uint256)"))
+)
+
+// multicallABI is the subset of the Multicall3 ABI implemented by the simulated contract
+const multicallABI = `[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"},{"inputs":[{"name":"requireSuccess","type":"bool"},{"components":[{"name":"target","type":"address"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"tryBlockAndAggregate","outputs":[{"name":"blockNumber","type":"uint256"},{"name":"blockHash","type":"bytes32"},{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+///
+/// Genesis
+///
+
+// Genesis collects the contracts of a simulated chain before it starts
+// Multicall3 is deployed at its usual address, tokens, factories and pools are stubs
+// that answer their view functions with fixed responses, pools are deployed at their CREATE2 addresses
+type Genesis struct {
+	stubs     map[common.Address]map[common.Hash][]byte
+	stateKeys map[common.Address][]common.Hash
+}
+
+// NewGenesis creates a genesis with only the Multicall3 contract
+func NewGenesis() *Genesis {
+	return &Genesis{
+		stubs:     make(map[common.Address]map[common.Hash][]byte),
+		stateKeys: make(map[common.Address][]common.Hash),
+	}
+}
+
+// AddToken deploys a token answering decimals, symbol and name
+func (g *Genesis) AddToken(t token.ERC20) {
+	g.Respond(t.Address, call("decimals()"), word(t.Decimals))
+	g.Respond(t.Address, call("symbol()"), abiString(t.Symbol))
+	g.Respond(t.Address, call("name()"), abiString(t.Name))
+}
+
+// AddV2Pair deploys a pair with its reserves and registers it at the factory
+func (g *Genesis) AddV2Pair(f factory.Factory[any], p pair.Pair[any], reserves uniswap.Reserves) common.Address {
+	address := uniswap.NewV2Pool(f.Address, f.InitHash, f.SwapFee, p).Address()
+	token0, token1 := p.SortAddresses()
+
+	g.Respond(f.Address, call("getPair(address,address)", token0.Bytes(), token1.Bytes()), address.Bytes())
+	g.Respond(f.Address, call("getPair(address,address)", token1.Bytes(), token0.Bytes()), address.Bytes())
+	g.Respond(address, call("factory()"), f.Address.Bytes())
+	g.Respond(address, call("token0()"), token0.Bytes())
+	g.Respond(address, call("token1()"), token1.Bytes())
+	g.setState(address, v2Responses(reserves))
+	return address
+}
+
+// AddV3Pool deploys a pool with its state and registers it at the factory
+// the tick bitmap is built from the initialized ticks of the state
+func (g *Genesis) AddV3Pool(f factory.Factory[uniswap.V3FeeType], p pair.Pair[uniswap.V3FeeType], state uniswap.V3State) common.Address {
+	address := uniswap.NewV3Pool(f.Address, f.InitHash, p).Address()
+	token0, token1 := p.SortAddresses()
+	fee := new(big.Int).SetUint64(uint64(p.PairOptions)).Bytes()
+
+	g.Respond(f.Address, call("getPool(address,address,uint24)", token0.Bytes(), token1.Bytes(), fee), address.Bytes())
+	g.Respond(f.Address, call("getPool(address,address,uint24)", token1.Bytes(), token0.Bytes(), fee), address.Bytes())
+	g.Respond(address, call("factory()"), f.Address.Bytes())
+	g.Respond(address, call("token0()"), token0.Bytes())
+	g.Respond(address, call("token1()"), token1.Bytes())
+	g.Respond(address, call("fee()"), fee)
+	g.setState(address, v3Responses(state))
+	return address
+}
+
+// Respond deploys a stub answering a call with raw return data, e.g. a bytes32 symbol
+// responses shorter than a word are left padded
+func (g *Genesis) Respond(target common.Address, data []byte, response []byte) {
+	if _, ok := g.stubs[target]; !ok {
+		g.stubs[target] = make(map[common.Hash][]byte)
+	}
+	g.stubs[target][crypto.Keccak256Hash(data)] = common.LeftPadBytes(response, 32)
+}
+
+// setState stores the responses of the state of a pool
+func (g *Genesis) setState(target common.Address, responses map[common.Hash][]byte) {
+	for key, response := range responses {
+		if _, ok := g.stubs[target]; !ok {
+			g.stubs[target] = make(map[common.Hash][]byte)
+		}
+		g.stubs[target][key] = response
+		g.stateKeys[target] = append(g.stateKeys[target], key)
+	}
+}
+
+// alloc returns the genesis accounts with the contract codes and the stub storages
+func (g *Genesis) alloc() core.GenesisAlloc {
+	alloc := core.GenesisAlloc{
+		chain.Multicall3: {Code: multicallCode(), Balance: big.NewInt(0)},
+	}
+
+	code := stubCode()
+	for target, responses := range g.stubs {
+		storage := make(map[common.Hash]common.Hash)
+		for key, response := range responses {
+			for slot, value := range stubStorage(key, response) {
+				storage[slot] = value
+			}
+		}
+		alloc[target] = core.GenesisAccount{Code: code, Storage: storage, Balance: big.NewInt(0)}
+	}
+	return alloc
+}
+
+///
+/// Chain
+///
+
+// Chain is an in-process chain for hermetic tests
+// it runs on backends.SimulatedBackend, which go-ethereum v1.14 replaces with ethclient/simulated,
+// the module pins go-ethereum v1.13.8 which only has the former
+type Chain struct {
+	// Backend is the simulated backend, it is the RPC client of the chain
+	Backend *backends.SimulatedBackend
+	// Client is an in-process RPC client, it serves newHeads subscriptions
+	Client *rpc.Client
+
+	m         sync.Mutex
+	server    *rpc.Server
+	key       *ecdsa.PrivateKey
+	stateKeys map[common.Address][]common.Hash
+	// blockKeys are the state keys after each committed block, to fork from it
+	blockKeys map[common.Hash]map[common.Address][]common.Hash
+}
+
+// NewChain starts a chain from the genesis
+func NewChain(g *Genesis) (*Chain, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	alloc := g.alloc()
+	alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: new(big.Int).Lsh(big.NewInt(1), 100)}
+	backend := backends.NewSimulatedBackend(alloc, GasLimit)
+
+	// serve subscriptions over an in-process connection
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &headService{backend: backend}); err != nil {
+		_ = backend.Close()
+		return nil, err
+	}
+
+	genesis, err := backend.HeaderByNumber(context.Background(), big.NewInt(0))
+	if err != nil {
+		_ = backend.Close()
+		return nil, err
+	}
+	stateKeys := copyStateKeys(g.stateKeys)
+
+	return &Chain{
+		Backend:   backend,
+		Client:    rpc.DialInProc(server),
+		server:    server,
+		key:       key,
+		stateKeys: stateKeys,
+		blockKeys: map[common.Hash]map[common.Address][]common.Hash{genesis.Hash(): copyStateKeys(stateKeys)},
+	}, nil
+}
+
+// Close stops the chain
+func (c *Chain) Close() {
+	c.Client.Close()
+	c.server.Stop()
+	_ = c.Backend.Close()
+}
+
+// Commit mines the pending transactions into a new block and returns its header
+func (c *Chain) Commit() *types.Header {
+	c.m.Lock()
+	hash := c.Backend.Commit()
+	c.blockKeys[hash] = copyStateKeys(c.stateKeys)
+	c.m.Unlock()
+
+	header, err := c.Backend.HeaderByHash(context.Background(), hash)
+	if err != nil {
+		panic(err)
+	}
+	return header
+}
+
+// Fork starts a side chain on a committed block, the next commits build on it
+// the side chain becomes canonical once it is longer than the current chain, which reorgs its blocks away
+func (c *Chain) Fork(parent common.Hash) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	keys, ok := c.blockKeys[parent]
+	if !ok {
+		return errors.New(fmt.Sprintf("unknown block: %s", parent.Hex()))
+	}
+	if err := c.Backend.Fork(context.Background(), parent); err != nil {
+		return err
+	}
+	c.stateKeys = copyStateKeys(keys)
+	return nil
+}
+
+// Mine commits a block every interval until stopped, each block is a new head for subscriptions
+func (c *Chain) Mine(interval time.Duration) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.Commit()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Caller creates a multicall caller of the Multicall3 contract of the chain
+func (c *Chain) Caller(callCost uint64, maxGas uint64) *generic.MulticallContract {
+	cAbi, err := abi.JSON(strings.NewReader(multicallABI))
+	if err != nil {
+		panic(err)
+	}
+	return generic.NewCaller(chain.Multicall3, callCost, maxGas, cAbi, c.Backend)
+}
+
+// Endpoint returns the chain as an endpoint of a dispatcher
+func (c *Chain) Endpoint() provider.Endpoint {
+	return provider.Endpoint{URL: "simulated", Client: c.Backend, Subscriber: c.Client}
+}
+
+// SetReserves changes the reserves of a V2 pair in the next committed block and emits its Sync log
+func (c *Chain) SetReserves(pool common.Address, reserves uniswap.Reserves) error {
+	if err := c.setState(pool, v2Responses(reserves)); err != nil {
+		return err
+	}
+	return c.emit(pool, []common.Hash{syncTopic}, words(reserves.Reserve0, reserves.Reserve1))
+}
+
+// SetV3State changes the state of a V3 pool in the next committed block without emitting a log
+func (c *Chain) SetV3State(pool common.Address, state uniswap.V3State) error {
+	return c.setState(pool, v3Responses(state))
+}
+
+// Position is a liquidity change of a V3 position
+// Amount is the liquidity, Amount0 and Amount1 are the token amounts
+type Position struct {
+	Owner     common.Address
+	TickLower int
+	TickUpper int
+	Amount    *big.Int
+	Amount0   *big.Int
+	Amount1   *big.Int
+}
+
+// SwapV3 changes the state of a V3 pool in the next committed block and emits the Swap log of the change,
+// the log has the price, liquidity and tick of the state and the token amounts of the swap
+func (c *Chain) SwapV3(pool common.Address, state uniswap.V3State, amount0 *big.Int, amount1 *big.Int) error {
+	if err := c.setState(pool, v3Responses(state)); err != nil {
+		return err
+	}
+	sender := common.BytesToHash(c.sender().Bytes())
+	data := words(amount0, amount1, state.Slot0.SqrtPriceX96, state.Liquidity, state.Slot0.Tick)
+	return c.emit(pool, []common.Hash{swapTopic, sender, sender}, data)
+}
+
+// MintV3 changes the state of a V3 pool in the next committed block and emits the Mint log of a position
+func (c *Chain) MintV3(pool common.Address, state uniswap.V3State, position Position) error {
+	if err := c.setState(pool, v3Responses(state)); err != nil {
+		return err
+	}
+	data := append(common.LeftPadBytes(c.sender().Bytes(), 32), words(position.Amount, position.Amount0, position.Amount1)...)
+	return c.emit(pool, positionTopics(mintTopic, position), data)
+}
+
+// BurnV3 changes the state of a V3 pool in the next committed block and emits the Burn log of a position
+func (c *Chain) BurnV3(pool common.Address, state uniswap.V3State, position Position) error {
+	if err := c.setState(pool, v3Responses(state)); err != nil {
+		return err
+	}
+	return c.emit(pool, positionTopics(burnTopic, position), words(position.Amount, position.Amount0, position.Amount1))
+}
+
+// setState replaces the state responses of a pool, responses of the previous state are cleared
+func (c *Chain) setState(target common.Address, responses map[common.Hash][]byte) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	previous, ok := c.stateKeys[target]
+	if !ok {
+		return UnknownStub
+	}
+	for _, key := range previous {
+		if _, ok := responses[key]; !ok {
+			if err := c.store(target, key, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]common.Hash, 0, len(responses))
+	for key, response := range responses {
+		if err := c.store(target, key, response); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	c.stateKeys[target] = keys
+	return nil
+}
+
+// store sends a transaction storing the response of a stub, an empty response is cleared
+func (c *Chain) store(target common.Address, key common.Hash, response []byte) error {
+	data := append(common.LeftPadBytes(big.NewInt(setSelector).Bytes(), 4), key.Bytes()...)
+	data = append(data, word(big.NewInt(int64(len(response))))...)
+	data = append(data, common.RightPadBytes(response, (len(response)+31)/32*32)...)
+
+	if err := c.send(target, data, uint64(50_000+25_000*((len(response)+31)/32))); err != nil {
+		return errors.New(fmt.Sprintf("failed to store response: %s", err))
+	}
+	return nil
+}
+
+// emit sends a transaction making a stub emit a log with 1 to 4 topics
+func (c *Chain) emit(target common.Address, topics []common.Hash, logData []byte) error {
+	data := append(common.LeftPadBytes(big.NewInt(emitSelector).Bytes(), 4), word(big.NewInt(int64(len(topics))))...)
+	for _, topic := range topics {
+		data = append(data, topic.Bytes()...)
+	}
+	data = append(data, logData...)
+
+	if err := c.send(target, data, uint64(50_000+1_000*len(logData)/32)); err != nil {
+		return errors.New(fmt.Sprintf("failed to emit log: %s", err))
+	}
+	return nil
+}
+
+// send sends a transaction to a stub
+func (c *Chain) send(target common.Address, data []byte, gas uint64) error {
+	ctx := context.Background()
+
+	nonce, err := c.Backend.PendingNonceAt(ctx, c.sender())
+	if err != nil {
+		return err
+	}
+	gasPrice, err := c.Backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: new(big.Int).Mul(gasPrice, big.NewInt(2)),
+		Gas:      gas,
+		To:       &target,
+		Data:     data,
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(big.NewInt(1337)), c.key)
+	if err != nil {
+		return err
+	}
+	return c.Backend.SendTransaction(ctx, signed)
+}
+
+// sender returns the account sending the transactions of the chain
+func (c *Chain) sender() common.Address {
+	return crypto.PubkeyToAddress(c.key.PublicKey)
+}
+
+///
+/// Subscriptions
+///
+
+// headService serves the newHeads subscriptions of the backend
+type headService struct {
+	backend *backends.SimulatedBackend
+}
+
+// NewHeads notifies the headers of the committed blocks
+func (s *headService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+
+	headers := make(chan *types.Header)
+	headSub, err := s.backend.SubscribeNewHead(context.Background(), headers)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := notifier.CreateSubscription()
+	go func() {
+		defer headSub.Unsubscribe()
+		for {
+			select {
+			case header := <-headers:
+				_ = notifier.Notify(sub.ID, header)
+			case <-sub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+///
+/// Responses
+///
+
+// v2Responses returns the state responses of a V2 pair
+func v2Responses(reserves uniswap.Reserves) map[common.Hash][]byte {
+	return map[common.Hash][]byte{
+		crypto.Keccak256Hash(call("getReserves()")): words(reserves.Reserve0, reserves.Reserve1, nil),
+	}
+}
+
+// v3Responses returns the state responses of a V3 pool
+func v3Responses(state uniswap.V3State) map[common.Hash][]byte {
+	slot := state.Slot0
+	unlocked := big.NewInt(0)
+	if slot.Unlocked {
+		unlocked = big.NewInt(1)
+	}
+
+	responses := map[common.Hash][]byte{
+		crypto.Keccak256Hash(call("slot0()")): words(
+			slot.SqrtPriceX96, slot.Tick, slot.ObservationIndex, slot.ObservationCardinality,
+			slot.ObservationCardinalityNext, slot.FeeProtocol, unlocked,
+		),
+		crypto.Keccak256Hash(call("liquidity()")):   words(state.Liquidity),
+		crypto.Keccak256Hash(call("tickSpacing()")): words(big.NewInt(int64(state.TickSpacing))),
+	}
+	if state.TickSpacing <= 0 {
+		return responses
+	}
+
+	// initialized ticks and their bits in the bitmap words
+	bitmap := make(map[int]*big.Int)
+	for _, tick := range state.Ticks {
+		compressed := tick.Index / state.TickSpacing
+		if tick.Index < 0 && tick.Index%state.TickSpacing != 0 {
+			compressed--
+		}
+		if _, ok := bitmap[compressed>>8]; !ok {
+			bitmap[compressed>>8] = big.NewInt(0)
+		}
+		bitmap[compressed>>8].SetBit(bitmap[compressed>>8], compressed&0xff, 1)
+
+		index := math.U256Bytes(big.NewInt(int64(tick.Index)))
+		responses[crypto.Keccak256Hash(call("ticks(int24)", index))] = words(
+			tick.LiquidityGross, tick.LiquidityNet, nil, nil, nil, nil, nil, big.NewInt(1),
+		)
+	}
+	for position, bits := range bitmap {
+		index := math.U256Bytes(big.NewInt(int64(position)))
+		responses[crypto.Keccak256Hash(call("tickBitmap(int16)", index))] = words(bits)
+	}
+
+	return responses
+}
+
+///
+/// Encoding
+///
+
+// call encodes a call of a function with static word arguments
+func call(signature string, args ...[]byte) []byte {
+	data := append([]byte(nil), crypto.Keccak256([]byte(signature))[:4]...)
+	for _, arg := range args {
+		data = append(data, common.LeftPadBytes(arg, 32)...)
+	}
+	return data
+}
+
+// positionTopics returns the topics of a Mint or Burn log of a position
+func positionTopics(topic common.Hash, position Position) []common.Hash {
+	return []common.Hash{
+		topic,
+		common.BytesToHash(position.Owner.Bytes()),
+		common.BytesToHash(word(big.NewInt(int64(position.TickLower)))),
+		common.BytesToHash(word(big.NewInt(int64(position.TickUpper)))),
+	}
+}
+
+// copyStateKeys returns a copy of the state keys of the stubs
+func copyStateKeys(stateKeys map[common.Address][]common.Hash) map[common.Address][]common.Hash {
+	keys := make(map[common.Address][]common.Hash, len(stateKeys))
+	for target, targetKeys := range stateKeys {
+		keys[target] = append([]common.Hash(nil), targetKeys...)
+	}
+	return keys
+}
+
+// word encodes an integer as a two's complement word, nil encodes to zero
+func word(value *big.Int) []byte {
+	if value == nil {
+		return make([]byte, 32)
+	}
+	return math.U256Bytes(new(big.Int).Set(value))
+}
+
+// words encodes integers as consecutive words
+func words(values ...*big.Int) []byte {
+	data := make([]byte, 0, len(values)*32)
+	for _, value := range values {
+		data = append(data, word(value)...)
+	}
+	return data
+}
+
+// abiString encodes a string return value
+func abiString(s string) []byte {
+	data := append(word(big.NewInt(32)), word(big.NewInt(int64(len(s))))...)
+	return append(data, common.RightPadBytes([]byte(s), (len(s)+31)/32*32)...)
+}
+
+// stubStorage returns the storage slots of a stub response
+func stubStorage(key common.Hash, response []byte) map[common.Hash]common.Hash {
+	storage := map[common.Hash]common.Hash{
+		key: common.BigToHash(big.NewInt(int64(len(response)))),
+	}
+	for i := 0; i*32 < len(response); i++ {
+		slot := new(big.Int).Add(key.Big(), big.NewInt(int64(i+1)))
+		storage[common.BigToHash(slot)] = common.BytesToHash(common.RightPadBytes(response[i*32:min(len(response), (i+1)*32)], 32))
+	}
+	return storage
+}
@@ -0,0 +1,312 @@
+package simulated_test
+
+import (
+	"PoolHelper/src/multicall/generic"
+	"PoolHelper/src/pool/uniswap"
+	"PoolHelper/src/simulated"
+	"PoolHelper/src/structs/factory"
+	"PoolHelper/src/structs/pair"
+	"PoolHelper/src/structs/token"
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	weth = token.ERC20{Address: common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"), Decimals: big.NewInt(18), Symbol: "WETH", Name: "Wrapped Ether"}
+	usdc = token.ERC20{Address: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Decimals: big.NewInt(6), Symbol: "USDC", Name: "USD Coin"}
+	v2   = factory.Factory[any]{
+		Name:     "UniswapV2",
+		Address:  common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+		InitHash: common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"),
+		SwapFee:  30,
+	}
+	v3 = factory.Factory[uniswap.V3FeeType]{
+		Name:     "UniswapV3",
+		Address:  common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984"),
+		InitHash: common.HexToHash("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54"),
+		FeeTypes: []uniswap.V3FeeType{uniswap.NORMAL},
+	}
+)
+
+// reservesCall is a getReserves call of a pair
+func reservesCall(pool common.Address) generic.Call3 {
+	return generic.Call3{Target: pool, CallData: crypto.Keccak256([]byte("getReserves()"))[:4], AllowFailure: true}
+}
+
+func TestChain_Multicall(t *testing.T) {
+	g := simulated.NewGenesis()
+	g.AddToken(weth)
+	g.AddToken(usdc)
+	pool := g.AddV2Pair(v2, pair.NewPair[any](weth, usdc, nil), uniswap.Reserves{Reserve0: big.NewInt(1_000), Reserve1: big.NewInt(2_000)})
+
+	c, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	head := c.Commit()
+
+	calls := []generic.Call3{
+		{Target: usdc.Address, CallData: crypto.Keccak256([]byte("decimals()"))[:4]},
+		reservesCall(pool),
+		{Target: usdc.Address, CallData: crypto.Keccak256([]byte("balanceOf(address)"))[:4], AllowFailure: true},
+	}
+
+	for _, method := range []generic.Method{generic.Aggregate3, generic.TryBlockAndAggregate} {
+		m := c.Caller(10_000, 1_000_000)
+		m.SetMethod(method)
+		results, err := m.Aggregate(context.Background(), calls, 0)
+		if err != nil {
+			t.Fatalf("%s: %s", method, err)
+		}
+		if len(results) != len(calls) {
+			t.Fatalf("%s: wrong number of results: %v", method, len(results))
+		}
+		for _, result := range results {
+			if !result.Success || result.Err != nil {
+				t.Errorf("%s: failed call: %+v", method, result)
+			}
+		}
+
+		// responses are returned as stored, unknown calls return a zero word
+		if new(big.Int).SetBytes(results[0].ReturnData).Int64() != 6 {
+			t.Errorf("%s: wrong decimals: %x", method, results[0].ReturnData)
+		}
+		if len(results[1].ReturnData) != 96 || new(big.Int).SetBytes(results[1].ReturnData[32:64]).Int64() != 2_000 {
+			t.Errorf("%s: wrong reserves: %x", method, results[1].ReturnData)
+		}
+		if len(results[2].ReturnData) != 32 || new(big.Int).SetBytes(results[2].ReturnData).Sign() != 0 {
+			t.Errorf("%s: wrong default response: %x", method, results[2].ReturnData)
+		}
+		for _, result := range results {
+			if result.Block != head.Number.Uint64() || result.BlockHash != head.Hash() {
+				t.Errorf("%s: wrong executed block: %v %v", method, result.Block, result.BlockHash)
+			}
+		}
+	}
+}
+
+func TestChain_MulticallBlock(t *testing.T) {
+	g := simulated.NewGenesis()
+	pool := g.AddV2Pair(v2, pair.NewPair[any](weth, usdc, nil), uniswap.Reserves{Reserve0: big.NewInt(1), Reserve1: big.NewInt(1)})
+
+	c, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Commit()
+	head := c.Commit()
+
+	// the latest and the requested block both resolve to the head, failed calls carry it as well
+	calls := []generic.Call3{reservesCall(pool), {Target: pool, CallData: []byte{0xff, 0xff, 0xff, 0xff}}}
+	for _, method := range []generic.Method{generic.Aggregate3, generic.TryBlockAndAggregate} {
+		for _, block := range []uint64{0, head.Number.Uint64()} {
+			m := c.Caller(10_000, 1_000_000)
+			m.SetMethod(method)
+			m.SetRetries(0, 0)
+			results, err := m.Aggregate(context.Background(), calls, block)
+			if err != nil {
+				t.Fatalf("%s: %s", method, err)
+			}
+			if results[0].Err != nil || results[1].Err == nil {
+				t.Errorf("%s: expected the second call to fail: %+v", method, results)
+			}
+			for _, result := range results {
+				if result.Block != head.Number.Uint64() || result.BlockHash != head.Hash() {
+					t.Errorf("%s at %v: wrong executed block: %v %v", method, block, result.Block, result.BlockHash)
+				}
+			}
+		}
+	}
+
+	// a block that does not exist fails
+	if _, err := c.Caller(10_000, 1_000_000).Aggregate(context.Background(), calls, head.Number.Uint64()+10); err == nil {
+		t.Errorf("expected an unknown block to fail")
+	}
+}
+
+func TestChain_SetReserves(t *testing.T) {
+	g := simulated.NewGenesis()
+	pool := g.AddV2Pair(v2, pair.NewPair[any](weth, usdc, nil), uniswap.Reserves{Reserve0: big.NewInt(1), Reserve1: big.NewInt(1)})
+
+	c, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Commit()
+
+	m := c.Caller(10_000, 1_000_000)
+	reserve := func(block uint64) int64 {
+		results, err := m.Aggregate(context.Background(), []generic.Call3{reservesCall(pool)}, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return new(big.Int).SetBytes(results[0].ReturnData[0:32]).Int64()
+	}
+
+	// the change takes effect in the next block
+	if err := c.SetReserves(pool, uniswap.Reserves{Reserve0: big.NewInt(5), Reserve1: big.NewInt(7)}); err != nil {
+		t.Fatal(err)
+	}
+	if r := reserve(0); r != 1 {
+		t.Errorf("wrong reserve before the commit: %v", r)
+	}
+	head := c.Commit()
+	if r := reserve(head.Number.Uint64()); r != 5 {
+		t.Errorf("wrong reserve after the commit: %v", r)
+	}
+
+	if err := c.SetReserves(common.HexToAddress("0x01"), uniswap.Reserves{}); err != simulated.UnknownStub {
+		t.Errorf("expected an unknown stub, got %v", err)
+	}
+}
+
+func TestChain_Logs(t *testing.T) {
+	g := simulated.NewGenesis()
+	pool := g.AddV2Pair(v2, pair.NewPair[any](weth, usdc, nil), uniswap.Reserves{Reserve0: big.NewInt(1), Reserve1: big.NewInt(1)})
+	v3Pool := g.AddV3Pool(v3, pair.NewPair(weth, usdc, uniswap.NORMAL), uniswap.V3State{TickSpacing: 60})
+
+	c, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Commit()
+
+	// state changes emit the logs of the pools
+	if err := c.SetReserves(pool, uniswap.Reserves{Reserve0: big.NewInt(5), Reserve1: big.NewInt(7)}); err != nil {
+		t.Fatal(err)
+	}
+	state := uniswap.V3State{
+		Slot0:       uniswap.Slot0{SqrtPriceX96: new(big.Int).Lsh(big.NewInt(1), 96), Tick: big.NewInt(-1)},
+		Liquidity:   big.NewInt(1_000),
+		TickSpacing: 60,
+	}
+	position := simulated.Position{Owner: common.HexToAddress("0x01"), TickLower: -60, TickUpper: 60, Amount: big.NewInt(1_000)}
+	if err := c.SwapV3(v3Pool, state, big.NewInt(-1), big.NewInt(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MintV3(v3Pool, state, position); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BurnV3(v3Pool, state, position); err != nil {
+		t.Fatal(err)
+	}
+	head := c.Commit()
+
+	logs, err := c.Backend.FilterLogs(context.Background(), ethereum.FilterQuery{FromBlock: head.Number, ToBlock: head.Number})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		address common.Address
+		event   string
+		topics  int
+		data    int
+	}{
+		{pool, "Sync(uint112,uint112)", 1, 64},
+		{v3Pool, "Swap(address,address,int256,int256,uint160,uint128,int24)", 3, 160},
+		{v3Pool, "Mint(address,address,int24,int24,uint128,uint256,uint256)", 4, 128},
+		{v3Pool, "Burn(address,int24,int24,uint128,uint256,uint256)", 4, 96},
+	}
+	if len(logs) != len(expected) {
+		t.Fatalf("wrong number of logs: %v", len(logs))
+	}
+	for i, e := range expected {
+		l := logs[i]
+		if l.Address != e.address || len(l.Topics) != e.topics || l.Topics[0] != crypto.Keccak256Hash([]byte(e.event)) || len(l.Data) != e.data {
+			t.Errorf("wrong %s log: %+v", e.event, l)
+		}
+	}
+	if new(big.Int).SetBytes(logs[0].Data[32:64]).Int64() != 7 {
+		t.Errorf("wrong sync data: %x", logs[0].Data)
+	}
+	if tick := new(big.Int).SetBytes(logs[1].Data[128:160]); tick.Cmp(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))) != 0 {
+		t.Errorf("wrong swap tick: %x", logs[1].Data[128:160])
+	}
+	if tickLower := logs[2].Topics[2]; tickLower != common.BigToHash(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(60))) {
+		t.Errorf("wrong mint tick: %x", tickLower)
+	}
+}
+
+func TestChain_Fork(t *testing.T) {
+	g := simulated.NewGenesis()
+	pool := g.AddV2Pair(v2, pair.NewPair[any](weth, usdc, nil), uniswap.Reserves{Reserve0: big.NewInt(1), Reserve1: big.NewInt(1)})
+
+	c, err := simulated.NewChain(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ancestor := c.Commit()
+
+	if err := c.SetReserves(pool, uniswap.Reserves{Reserve0: big.NewInt(5), Reserve1: big.NewInt(5)}); err != nil {
+		t.Fatal(err)
+	}
+	c.Commit()
+
+	// a longer side chain from the ancestor becomes canonical with its own state
+	if err := c.Fork(ancestor.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetReserves(pool, uniswap.Reserves{Reserve0: big.NewInt(9), Reserve1: big.NewInt(9)}); err != nil {
+		t.Fatal(err)
+	}
+	c.Commit()
+	head := c.Commit()
+
+	latest, err := c.Backend.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Hash() != head.Hash() || head.Number.Uint64() != ancestor.Number.Uint64()+2 {
+		t.Fatalf("side chain is not canonical: %v", latest.Number)
+	}
+	results, err := c.Caller(10_000, 1_000_000).Aggregate(context.Background(), []generic.Call3{reservesCall(pool)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := new(big.Int).SetBytes(results[0].ReturnData[0:32]).Int64(); r != 9 {
+		t.Errorf("wrong reserve on the side chain: %v", r)
+	}
+
+	if err := c.Fork(common.HexToHash("0x01")); err == nil {
+		t.Errorf("expected an unknown block")
+	}
+}
+
+func TestChain_NewHeads(t *testing.T) {
+	c, err := simulated.NewChain(simulated.NewGenesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	headers := make(chan *types.Header)
+	sub, err := c.Client.EthSubscribe(context.Background(), headers, "newHeads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	stop := c.Mine(10 * time.Millisecond)
+	defer stop()
+	for i := uint64(1); i <= 3; i++ {
+		select {
+		case header := <-headers:
+			if header.Number.Uint64() != i {
+				t.Errorf("wrong head: %v", header.Number)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
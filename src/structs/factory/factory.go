@@ -10,10 +10,15 @@ type Factory[FeeType any] struct {
 	Address  common.Address
 	InitHash common.Hash
 	FeeTypes []FeeType
+
+	// SwapFee is the swap fee charged by the factory pools in basis points
+	// (e.g. 30 for 0.3%), only used by factories with a single fee tier
+	SwapFee uint64
 }
 
 func (f Factory[any]) IsValid() bool {
 	return f.Name != "" &&
 		!bytes.EqualFold(f.Address.Bytes(), common.Address{}.Bytes()) &&
-		!bytes.EqualFold(f.InitHash.Bytes(), common.Hash{}.Bytes())
+		!bytes.EqualFold(f.InitHash.Bytes(), common.Hash{}.Bytes()) &&
+		f.SwapFee < 10_000
 }
@@ -27,14 +27,14 @@ func (p Pair[any]) Equals(other Pair[any]) bool {
 }
 
 func (p Pair[any]) SortAddresses() (common.Address, common.Address) {
-	if p.TokenA.Address.Hex() < p.TokenB.Address.Hex() {
+	if bytes.Compare(p.TokenA.Address.Bytes(), p.TokenB.Address.Bytes()) < 0 {
 		return p.TokenA.Address, p.TokenB.Address
 	}
 	return p.TokenB.Address, p.TokenA.Address
 }
 
 func (p Pair[any]) SortTokens() (token.ERC20, token.ERC20) {
-	if p.TokenA.Address.Hex() < p.TokenB.Address.Hex() {
+	if bytes.Compare(p.TokenA.Address.Bytes(), p.TokenB.Address.Bytes()) < 0 {
 		return p.TokenA, p.TokenB
 	}
 	return p.TokenB, p.TokenA
@@ -14,6 +14,7 @@ import (
 var (
 	AlreadySubscribedError = errors.New("already subscribed")
 	MaxRetriesError        = errors.New("max retries reached")
+	ClosedError            = errors.New("subscription closed")
 )
 
 type RPCClientDispatcher interface {
@@ -228,7 +229,12 @@ func (c *Subscription[Type]) listen() {
 					Item:    header,
 					Context: ctx,
 				}
-			case err := <-c.innerSub.Err():
+			case err, ok := <-c.innerSub.Err():
+				// a closed error channel means the inner subscription was closed without an error
+				if !ok {
+					err = ClosedError
+				}
+
 				// skip if the error is nil
 				if err == nil {
 					continue
@@ -246,9 +252,7 @@ func (c *Subscription[Type]) listen() {
 				}
 
 				// lock the header context & try to resubscribe
-				ok := c.resubscribe()
-
-				if !ok {
+				if !c.resubscribe() {
 					// stop listening if max retries reached
 					c.unsubscribe()
 					return
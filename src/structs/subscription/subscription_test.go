@@ -1,36 +1,38 @@
 package subscription_test
 
 import (
+	"PoolHelper/src/simulated"
 	"PoolHelper/src/structs/subscription"
 	"context"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/core/types"
 	"testing"
 	"time"
 )
 
-func subscribe[T comparable](namespace string) (*rpc.Client, *subscription.Subscription[T]) {
-	// connect to rpc
-	client, err := rpc.Dial("wss://ethereum.publicnode.com")
+func subscribe[T comparable](t *testing.T, namespace string) (*simulated.Chain, *subscription.Subscription[T]) {
+	// start a chain mining a block every 100ms
+	c, err := simulated.NewChain(simulated.NewGenesis())
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
+	t.Cleanup(c.Close)
+	t.Cleanup(c.Mine(100 * time.Millisecond))
 
 	// create subscription
 	timeout, maxTimeout, maxRetries := 5*time.Second, 15*time.Second, 5
-	sub := subscription.NewSubscription[T](client, namespace, timeout, maxTimeout, maxRetries)
+	sub := subscription.NewSubscription[T](c.Client, namespace, timeout, maxTimeout, maxRetries)
 
 	// subscribe
 	err = sub.Subscribe(context.Background())
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	return client, sub
+	return c, sub
 }
 
 func TestSubscription_Subscribe(t *testing.T) {
-	_, sub := subscribe[*common.Hash]("newPendingTransactions")
+	_, sub := subscribe[*types.Header](t, "newHeads")
 	if sub == nil {
 		t.Errorf("subscription not created")
 	}
@@ -38,7 +40,7 @@ func TestSubscription_Subscribe(t *testing.T) {
 }
 
 func TestSubscription_Receive(t *testing.T) {
-	_, sub := subscribe[*common.Hash]("newPendingTransactions")
+	_, sub := subscribe[*types.Header](t, "newHeads")
 	if sub == nil {
 		t.Errorf("subscription not created")
 	}
@@ -54,7 +56,7 @@ func TestSubscription_Receive(t *testing.T) {
 }
 
 func TestSubscription_Reconnect(t *testing.T) {
-	_, sub := subscribe[*common.Hash]("newPendingTransactions")
+	_, sub := subscribe[*types.Header](t, "newHeads")
 	if sub == nil {
 		t.Errorf("subscription not created")
 	}
@@ -65,12 +67,12 @@ func TestSubscription_Reconnect(t *testing.T) {
 		sub.InnerSub().Unsubscribe()
 	}()
 
-	// receive headers
+	// receive headers until one arrives after the reconnection
 	errReceived, itemReceived := 0, 0
 	for i := 0; errReceived != 1 || itemReceived < errReceived; i++ {
 		select {
 		case <-sub.Items():
-			itemReceived += 1
+			itemReceived += errReceived
 		case <-sub.Err():
 			errReceived += 1
 		case <-time.After(15 * time.Second):
@@ -82,7 +84,7 @@ func TestSubscription_Reconnect(t *testing.T) {
 }
 
 func TestSubscription_Context_Refresh(t *testing.T) {
-	_, sub := subscribe[*common.Hash]("newPendingTransactions")
+	_, sub := subscribe[*types.Header](t, "newHeads")
 	if sub == nil {
 		t.Errorf("subscription not created")
 	}
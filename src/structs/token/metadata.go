@@ -0,0 +1,72 @@
+package token
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	InvalidString   = errors.New("invalid string return data")
+	InvalidDecimals = errors.New("invalid decimals return data")
+)
+
+// maxStringLength bounds the length of decoded symbols and names
+const maxStringLength = 256
+
+// DecodeDecimals decodes the return data of decimals()
+// the value is an ABI encoded uint8, longer return data is accepted if its first word is a valid uint8
+func DecodeDecimals(data []byte) (*big.Int, error) {
+	if len(data) < 32 {
+		return nil, errors.New(fmt.Sprintf("%s: %d bytes", InvalidDecimals, len(data)))
+	}
+	decimals := new(big.Int).SetBytes(data[:32])
+	if decimals.BitLen() > 8 {
+		return nil, errors.New(fmt.Sprintf("%s: %s is not an uint8", InvalidDecimals, decimals))
+	}
+	return decimals, nil
+}
+
+// DecodeString decodes the return data of symbol() or name()
+// the value is an ABI encoded string or, for older tokens like MKR, a zero padded bytes32
+func DecodeString(data []byte) (string, error) {
+	var raw []byte
+	switch {
+	case len(data) >= 64:
+		// offset, length and the padded bytes of the string
+		offset := new(big.Int).SetBytes(data[:32])
+		if !offset.IsUint64() || offset.Uint64() > uint64(len(data)-32) {
+			return "", errors.New(fmt.Sprintf("%s: offset %s out of bounds", InvalidString, offset))
+		}
+		start := offset.Uint64() + 32
+		length := new(big.Int).SetBytes(data[start-32 : start])
+		if !length.IsUint64() || length.Uint64() > uint64(len(data))-start {
+			return "", errors.New(fmt.Sprintf("%s: length %s out of bounds", InvalidString, length))
+		}
+		raw = data[start : start+length.Uint64()]
+	case len(data) == 32:
+		raw = bytes.TrimRight(data, "\x00")
+	default:
+		return "", errors.New(fmt.Sprintf("%s: %d bytes", InvalidString, len(data)))
+	}
+
+	if !utf8.Valid(raw) {
+		return "", errors.New(fmt.Sprintf("%s: not utf-8", InvalidString))
+	}
+	if len(raw) > maxStringLength {
+		return "", errors.New(fmt.Sprintf("%s: %d bytes long", InvalidString, len(raw)))
+	}
+
+	// drop control characters, the remaining text is kept as is
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, string(raw))
+	return strings.TrimSpace(s), nil
+}
@@ -0,0 +1,67 @@
+package token_test
+
+import (
+	"PoolHelper/src/structs/token"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// abiString encodes a string return value
+func abiString(s string) []byte {
+	data := common.LeftPadBytes(big.NewInt(32).Bytes(), 32)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(s))).Bytes(), 32)...)
+	padded := (len(s) + 31) / 32 * 32
+	return append(data, common.RightPadBytes([]byte(s), padded)...)
+}
+
+func TestDecodeString(t *testing.T) {
+	long := strings.Repeat("Wrapped ", 5)
+	outOfBounds := abiString("USDC")
+	outOfBounds[63] = 0xff
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected string
+		err      bool
+	}{
+		{"string", abiString("USDC"), "USDC", false},
+		{"long string", abiString(long), strings.TrimSpace(long), false},
+		{"string starting with a letter length", abiString(strings.Repeat("A", 0x41)), strings.Repeat("A", 0x41), false},
+		{"empty string", abiString(""), "", false},
+		{"bytes32", common.RightPadBytes([]byte("MKR"), 32), "MKR", false},
+		{"control characters", common.RightPadBytes([]byte("\x01DAI\n"), 32), "DAI", false},
+		{"no data", nil, "", true},
+		{"short data", []byte("MKR"), "", true},
+		{"length out of bounds", outOfBounds, "", true},
+		{"offset out of bounds", append(common.LeftPadBytes([]byte{0xff}, 32), make([]byte, 32)...), "", true},
+		{"invalid utf-8", common.RightPadBytes([]byte{0xff, 0xfe}, 32), "", true},
+	} {
+		s, err := token.DecodeString(test.data)
+		if s != test.expected || (err != nil) != test.err {
+			t.Errorf("%s: got %q %v", test.name, s, err)
+		}
+	}
+}
+
+func TestDecodeDecimals(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected int64
+		err      bool
+	}{
+		{"uint8", common.LeftPadBytes([]byte{18}, 32), 18, false},
+		{"longer data", append(common.LeftPadBytes([]byte{6}, 32), make([]byte, 32)...), 6, false},
+		{"no data", nil, 0, true},
+		{"short data", []byte{18}, 0, true},
+		{"not an uint8", common.LeftPadBytes([]byte{1, 0}, 32), 0, true},
+	} {
+		decimals, err := token.DecodeDecimals(test.data)
+		if (err != nil) != test.err || (err == nil && decimals.Int64() != test.expected) {
+			t.Errorf("%s: got %v %v", test.name, decimals, err)
+		}
+	}
+}
@@ -7,16 +7,17 @@ import (
 )
 
 type ERC20 struct {
-	Address  common.Address
-	Decimals *big.Int
-	Name     string
-	Symbol   string
+	Address  common.Address `json:"address"`
+	Decimals *big.Int       `json:"decimals"`
+	Name     string         `json:"name"`
+	Symbol   string         `json:"symbol"`
 }
 
 func (t ERC20) IsValid() bool {
-	return bytes.EqualFold(t.Address.Bytes(), common.Address{}.Bytes()) &&
+	return !bytes.EqualFold(t.Address.Bytes(), common.Address{}.Bytes()) &&
 		t.Decimals != nil &&
-		t.Decimals.Int64() > 0 &&
+		t.Decimals.Sign() >= 0 &&
+		t.Decimals.Cmp(big.NewInt(255)) <= 0 &&
 		t.Name != "" &&
 		t.Symbol != ""
 }
@@ -0,0 +1,165 @@
+package tokenlist
+
+import (
+	"PoolHelper/src/structs/token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	NoLists = errors.New("no token lists found")
+)
+
+// List is a token list in the Uniswap token list schema (https://tokenlists.org)
+// fields that are not needed to import the tokens (logos, keywords, extensions) are ignored
+type List struct {
+	Name    string  `json:"name"`
+	Version Version `json:"version"`
+	Tokens  []Token `json:"tokens"`
+}
+
+// Version is the semantic version of a list
+type Version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// Token is a token of a list, a list holds the tokens of several chains
+type Token struct {
+	ChainID  uint64   `json:"chainId"`
+	Address  string   `json:"address"`
+	Name     string   `json:"name"`
+	Symbol   string   `json:"symbol"`
+	Decimals uint8    `json:"decimals"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// Filter selects the tokens of a chain, tokens with any of the tags are selected, no tags select every token
+type Filter struct {
+	ChainID uint64
+	Tags    []string
+}
+
+// Report counts the tokens of the lists left out by a filter
+type Report struct {
+	// Listed is the number of tokens of the lists on every chain
+	Listed int `json:"listed"`
+	// Selected is the number of distinct tokens selected
+	Selected int `json:"selected"`
+	// Duplicates is the number of tokens listed again (by another list or the same one), the first listing is kept
+	Duplicates int `json:"duplicates"`
+	// Invalid is the number of tokens of the chain with an invalid address
+	Invalid int `json:"invalid"`
+}
+
+///
+/// Loading
+///
+
+// Load reads the token list of a file, or the token lists of the .json files of a directory in name order
+func Load(path string) ([]List, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+	if len(files) == 0 {
+		return nil, errors.New(fmt.Sprintf("%s: %s", NoLists, path))
+	}
+
+	lists := make([]List, 0, len(files))
+	for _, file := range files {
+		l, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, nil
+}
+
+// loadFile reads the token list of a file
+func loadFile(path string) (List, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return List{}, err
+	}
+
+	l := List{}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return List{}, errors.New(fmt.Sprintf("invalid token list %s: %s", path, err))
+	}
+	return l, nil
+}
+
+///
+/// Filtering
+///
+
+// Select returns the distinct tokens of the lists matching the filter, in list order
+// the listed metadata is kept to be reconciled with the on-chain metadata when the tokens are imported
+func Select(lists []List, filter Filter) ([]token.ERC20, Report) {
+	report := Report{}
+	tokens := make([]token.ERC20, 0)
+	seen := make(map[common.Address]bool)
+
+	for _, l := range lists {
+		report.Listed += len(l.Tokens)
+		for _, t := range l.Tokens {
+			if t.ChainID != filter.ChainID || !t.matches(filter.Tags) {
+				continue
+			}
+			if !common.IsHexAddress(t.Address) {
+				report.Invalid++
+				continue
+			}
+
+			address := common.HexToAddress(t.Address)
+			if seen[address] {
+				report.Duplicates++
+				continue
+			}
+			seen[address] = true
+
+			tokens = append(tokens, token.ERC20{
+				Address:  address,
+				Decimals: big.NewInt(int64(t.Decimals)),
+				Symbol:   t.Symbol,
+				Name:     t.Name,
+			})
+		}
+	}
+
+	report.Selected = len(tokens)
+	return tokens, report
+}
+
+// matches returns true if the token has one of the tags or if there are no tags
+func (t Token) matches(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, tokenTag := range t.Tags {
+			if strings.EqualFold(tag, tokenTag) {
+				return true
+			}
+		}
+	}
+	return false
+}
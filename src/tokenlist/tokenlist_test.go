@@ -0,0 +1,89 @@
+package tokenlist_test
+
+import (
+	"PoolHelper/src/tokenlist"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	// a directory is read in name order
+	lists, err := tokenlist.Load("testdata/lists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || lists[0].Name != "Default" || lists[1].Name != "Extended" || lists[1].Version.Major != 3 {
+		t.Fatalf("wrong lists: %+v", lists)
+	}
+
+	// a single file
+	lists, err = tokenlist.Load("testdata/lists/b_extended.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || len(lists[0].Tokens) != 3 {
+		t.Errorf("wrong list: %+v", lists)
+	}
+
+	for _, path := range []string{"testdata/invalid.json", "testdata/missing.json", t.TempDir()} {
+		if _, err := tokenlist.Load(path); err == nil {
+			t.Errorf("expected an error for %s", path)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	lists, err := tokenlist.Load("testdata/lists")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		filter   tokenlist.Filter
+		expected []string
+		report   tokenlist.Report
+	}{
+		{
+			"every token of the chain",
+			tokenlist.Filter{ChainID: 1},
+			[]string{"WETH", "USDC", "GALA", "USDT", "GALA"},
+			tokenlist.Report{Listed: 9, Selected: 5, Duplicates: 2, Invalid: 1},
+		},
+		{
+			"tagged tokens, tags are case insensitive",
+			tokenlist.Filter{ChainID: 1, Tags: []string{"stablecoin"}},
+			[]string{"USDC", "USDT"},
+			tokenlist.Report{Listed: 9, Selected: 2, Duplicates: 1},
+		},
+		{
+			"another chain",
+			tokenlist.Filter{ChainID: 10},
+			[]string{"USDC"},
+			tokenlist.Report{Listed: 9, Selected: 1},
+		},
+		{
+			"unknown tag",
+			tokenlist.Filter{ChainID: 1, Tags: []string{"meme"}},
+			[]string{},
+			tokenlist.Report{Listed: 9},
+		},
+	} {
+		tokens, report := tokenlist.Select(lists, test.filter)
+		if report != test.report || len(tokens) != len(test.expected) {
+			t.Errorf("%s: wrong selection: %+v %+v", test.name, report, tokens)
+			continue
+		}
+		for i, symbol := range test.expected {
+			if tokens[i].Symbol != symbol {
+				t.Errorf("%s: wrong token %d: %+v", test.name, i, tokens[i])
+			}
+		}
+	}
+
+	// the first listing of a token is kept
+	tokens, _ := tokenlist.Select(lists, tokenlist.Filter{ChainID: 1})
+	if tokens[1].Address != common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48") || tokens[1].Name != "USD Coin" || tokens[1].Decimals.Int64() != 6 {
+		t.Errorf("wrong listing kept: %+v", tokens[1])
+	}
+}